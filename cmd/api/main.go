@@ -9,6 +9,11 @@
 // Authorization: Bearer ${access_token}
 // ```
 //
+// Machine clients may authenticate by an API key instead, created at `/v1/users/me/api-keys`:
+// ```
+// X-API-Key: ${api_key}
+// ```
+//
 // For testing directly on this Swagger page, use the `Authorize` button right here bellow.
 //
 // Terms Of Service: N/A
@@ -26,6 +31,7 @@
 //	Security:
 //	- login: []
 //	- bearer: []
+//	- apikey: []
 //
 //	SecurityDefinitions:
 //	login:
@@ -37,25 +43,46 @@
 //	     type: apiKey
 //	     name: Authorization
 //	     in: header
+//	apikey:
+//	     type: apiKey
+//	     name: X-API-Key
+//	     in: header
 //
 // swagger:meta
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"log/slog"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/M15t/ghoul/config"
+	"github.com/M15t/ghoul/internal/api/apikey"
 	"github.com/M15t/ghoul/internal/api/auth"
 	"github.com/M15t/ghoul/internal/api/country"
+	"github.com/M15t/ghoul/internal/api/organization"
+	"github.com/M15t/ghoul/internal/api/policy"
 	"github.com/M15t/ghoul/internal/api/user"
+	"github.com/M15t/ghoul/internal/model"
 	"github.com/M15t/ghoul/internal/rbac"
 	dbutil "github.com/M15t/ghoul/internal/util/db"
 	_ "github.com/M15t/ghoul/internal/util/swagger" // Swagger stuffs
+	pkgrbac "github.com/M15t/ghoul/pkg/rbac"
 	"github.com/M15t/ghoul/pkg/server"
 	"github.com/M15t/ghoul/pkg/server/middleware/jwt"
+	"github.com/M15t/ghoul/pkg/server/middleware/keyauth"
 	"github.com/M15t/ghoul/pkg/server/middleware/slogger"
+	"github.com/M15t/ghoul/pkg/server/middleware/tenant"
 	"github.com/M15t/ghoul/pkg/util/crypter"
+	pkgdbutil "github.com/M15t/ghoul/pkg/util/db"
+	"github.com/M15t/ghoul/pkg/util/email"
+	"github.com/M15t/ghoul/pkg/util/oidc"
+	"github.com/M15t/ghoul/pkg/util/pwdpolicy"
+
+	"github.com/labstack/echo/v4"
 )
 
 func main() {
@@ -74,14 +101,21 @@ func main() {
 	sqlDB, err := db.DB()
 	defer sqlDB.Close()
 
+	// the cursors signed by a random secret are only valid on the instance issuing them, fine for local development only
+	if cfg.CursorSecret == "" && cfg.Stage != "development" {
+		checkErr(fmt.Errorf("CURSOR_SECRET is required in the %q stage", cfg.Stage))
+	}
+	pkgdbutil.SetCursorSecret(cfg.CursorSecret)
+
 	// Initialize HTTP server
 	e := server.New(&server.Config{
-		Stage:        cfg.Stage,
-		Port:         cfg.Port,
-		ReadTimeout:  cfg.ReadTimeout,
-		WriteTimeout: cfg.WriteTimeout,
-		AllowOrigins: cfg.AllowOrigins,
-		Debug:        cfg.Debug,
+		Stage:          cfg.Stage,
+		Port:           cfg.Port,
+		ReadTimeout:    cfg.ReadTimeout,
+		WriteTimeout:   cfg.WriteTimeout,
+		AllowOrigins:   cfg.AllowOrigins,
+		Debug:          cfg.Debug,
+		TrustedProxies: cfg.TrustedProxies,
 	})
 
 	// Middleware
@@ -90,6 +124,7 @@ func main() {
 
 	e.Use(slogger.NewWithConfig(logger, slogger.Config{
 		WithUserAgent:    true,
+		WithUser:         true,
 		WithRequestBody:  true,
 		WithResponseBody: true,
 		Filters:          filters,
@@ -100,30 +135,181 @@ func main() {
 
 	// Initialize DB interfaces
 	userDB := user.NewDB()
-	countryDB := country.NewDB()
+	sessionDB := auth.NewSessionDB()
+	userTokenDB := auth.NewUserTokenDB()
+	recoveryCodeDB := auth.NewRecoveryCodeDB()
+	loginFailureDB := auth.NewLoginFailureDB()
+	pwdHistoryDB := auth.NewPasswordHistoryDB()
+	oauthStateDB := auth.NewOAuthStateDB()
+	userIdentityDB := auth.NewUserIdentityDB()
+	countryRepo := country.NewRepo()
+	apiKeyDB := apikey.NewDB()
+	orgDB := organization.NewDB()
+	membershipDB := organization.NewMembershipDB()
 
 	// Initialize services
-	crypterSvc := crypter.New()
-	rbacSvc := rbac.New(cfg.Debug)
-	jwtSvc := jwt.New(cfg.JwtAlgorithm, cfg.JwtSecret, cfg.JwtDuration)
-	authSvc := auth.New(db, userDB, jwtSvc, crypterSvc)
-	userSvc := user.New(db, userDB, rbacSvc, crypterSvc)
-	countrySvc := country.New(db, countryDB, rbacSvc)
+	crypterSvc := crypter.NewWithConfig(crypter.Config{
+		Algorithm:  cfg.PwdAlgorithm,
+		BcryptCost: cfg.PwdBcryptCost,
+	})
+	emailSvc := email.New(email.Config{
+		Sender: cfg.EmailSender,
+		Region: cfg.EmailRegion,
+		WebURL: cfg.WebURL,
+	})
+	rbacCfg := rbac.Config{
+		EnableLog:    cfg.Debug,
+		Watcher:      cfg.RBACWatcher,
+		PollInterval: time.Duration(cfg.RBACPollIntv) * time.Second,
+		TopicARN:     cfg.RBACTopicARN,
+		QueueURL:     cfg.RBACQueueURL,
+	}
+	rbacSvc, err := rbac.New(db, rbacCfg)
+	checkErr(err)
+	// roles of the members, enforced per organization
+	domainRBAC, err := rbac.NewDomain(db, rbacCfg)
+	checkErr(err)
+	jwtKeys, err := newJWTKeySet(cfg)
+	checkErr(err)
+	jwtSvc := jwt.NewWithConfig(jwt.Config{
+		Algorithm:       cfg.JwtAlgorithm,
+		Secret:          cfg.JwtSecret,
+		KeySet:          jwtKeys,
+		Duration:        cfg.JwtDuration,
+		Issuer:          cfg.JwtIssuer,
+		Audience:        cfg.JwtAudience,
+		Leeway:          time.Duration(cfg.JwtLeeway) * time.Second,
+		RevocationStore: jwt.NewDBStore(db),
+	})
+	pwdPolicy := pwdpolicy.New(pwdpolicy.Policy{
+		MinLength:     cfg.PwdMinLength,
+		MaxLength:     pwdpolicy.DefaultPolicy.MaxLength,
+		RequireUpper:  cfg.PwdUpper,
+		RequireLower:  cfg.PwdLower,
+		RequireDigit:  cfg.PwdDigit,
+		RequireSymbol: cfg.PwdSymbol,
+		Denylist:      cfg.PwdDenylist,
+		HistorySize:   cfg.PwdHistory,
+	})
+	oauthProviders, err := newOAuthProviders(cfg)
+	checkErr(err)
+	authSvc := auth.New(db, userDB, sessionDB, userTokenDB, recoveryCodeDB, loginFailureDB, pwdHistoryDB, oauthStateDB, userIdentityDB, jwtSvc, crypterSvc, emailSvc, logger, auth.Config{
+		SessionDuration:       time.Duration(cfg.SessionDuration) * time.Second,
+		PasswordPolicy:        pwdPolicy,
+		ResetPasswordDuration: time.Duration(cfg.ResetPwDuration) * time.Second,
+		RegistrationEnabled:   cfg.RegEnabled,
+		VerifyEmailDuration:   time.Duration(cfg.VerifyEmailDur) * time.Second,
+		LoginMaxFailures:      cfg.LoginMaxFails,
+		LoginLockoutDuration:  time.Duration(cfg.LoginLockout) * time.Second,
+		LoginIPMaxFailures:    cfg.LoginIPMaxFails,
+		LoginIPWindow:         time.Duration(cfg.LoginIPWindow) * time.Second,
+		MFAIssuer:             cfg.MFAIssuer,
+		MFARequiredRoles:      cfg.MFARoles,
+		WebURL:                cfg.WebURL,
+		TemplateDir:           cfg.TemplateDir,
+		ImpersonationDuration: time.Duration(cfg.ImpersonateDur) * time.Second,
+		OAuthProviders:        oauthProviders,
+	})
+	userSvc := user.New(db, userDB, rbacSvc, crypterSvc, authSvc, authSvc, authSvc)
+	countrySvc := country.New(db, countryRepo, rbacSvc)
+	apiKeySvc := apikey.New(db, apiKeyDB, userDB, rbacSvc, crypterSvc)
+	policySvc := policy.New(rbacSvc)
+	orgSvc := organization.New(db, orgDB, membershipDB, userDB, rbacSvc, domainRBAC)
 
 	// Initialize root API
-	auth.NewHTTP(authSvc, e)
+	auth.NewHTTP(authSvc, e, jwtSvc.MWFunc())
 
 	// Initialize v1 API
 	v1Router := e.Group("/v1")
-	v1Router.Use(jwtSvc.MWFunc())
+	// authenticated by either an API key or a bearer JWT
+	v1Router.Use(keyauth.New(keyauth.Config{
+		Validator: apiKeySvc.Validate,
+		Fallback:  jwtSvc.MWFunc(),
+	}))
+	// resolves the organization of the request and the role of the user in it
+	v1Router.Use(tenant.New(tenant.Config{
+		Resolver: organization.NewResolver(orgSvc, authSvc),
+	}))
+
+	// permissions of the routes, enforced before their handlers
+	routes := pkgrbac.NewRoutes()
+	routes.Register("/v1/users", user.Permissions...)
+	routes.Register("/v1/countries", country.Permissions...)
+	routes.Register("/v1/rbac", policy.Permissions...)
+	v1Router.Use(pkgrbac.Middleware(pkgrbac.MiddlewareConfig{
+		Routes:   routes,
+		Enforcer: rbacSvc,
+		Subject:  func(c echo.Context) string { return authSvc.User(c).Role },
+	}))
+	if cfg.Debug {
+		checkErr(routes.PrintMatrix(os.Stdout, rbacSvc, model.RoleSuperAdmin, model.RoleAdmin, model.RoleUser))
+	}
 
 	user.NewHTTP(userSvc, authSvc, v1Router.Group("/users"))
+	apikey.NewHTTP(apiKeySvc, authSvc, v1Router.Group("/users"))
 	country.NewHTTP(countrySvc, authSvc, v1Router.Group("/countries"))
+	policy.NewHTTP(policySvc, authSvc, v1Router.Group("/rbac"))
+	policy.NewUserHTTP(policySvc, authSvc, v1Router.Group("/users"))
+	organization.NewHTTP(orgSvc, authSvc, v1Router.Group("/organizations"))
 
 	// Start the HTTP server
 	server.Start(e, cfg.Stage == "development")
 }
 
+// newJWTKeySet loads the keys for asymmetric JWT algorithms, returns nil for HMAC ones which use the JWT secret
+func newJWTKeySet(cfg *config.Configuration) (*jwt.KeySet, error) {
+	if strings.HasPrefix(cfg.JwtAlgorithm, "HS") {
+		return nil, nil
+	}
+
+	ks, err := jwt.LoadKeySet(cfg.JwtAlgorithm, cfg.JwtKeyFiles, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.JwtPrivateKey != "" {
+		key, err := jwt.ParseKeyPEM(cfg.JwtActiveKey, cfg.JwtAlgorithm, []byte(cfg.JwtPrivateKey))
+		if err != nil {
+			return nil, err
+		}
+		ks.Add(key)
+	}
+	if cfg.JwtActiveKey != "" {
+		if err := ks.SetActive(cfg.JwtActiveKey); err != nil {
+			return nil, err
+		}
+	}
+	for _, kid := range cfg.JwtRetiredKeys {
+		if err := ks.Retire(kid); err != nil {
+			return nil, err
+		}
+	}
+
+	return ks, nil
+}
+
+// newOAuthProviders creates the OpenID provider clients from the JSON config
+func newOAuthProviders(cfg *config.Configuration) ([]auth.OAuthProvider, error) {
+	if cfg.OIDCProviders == "" {
+		return nil, nil
+	}
+
+	var configs []oidc.Config
+	if err := json.Unmarshal([]byte(cfg.OIDCProviders), &configs); err != nil {
+		return nil, err
+	}
+	providers := make([]auth.OAuthProvider, 0, len(configs))
+	for _, c := range configs {
+		c.Leeway = time.Duration(cfg.JwtLeeway) * time.Second
+		p, err := oidc.NewProvider(c)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, p)
+	}
+
+	return providers, nil
+}
+
 func checkErr(err error) {
 	if err != nil {
 		panic(err)
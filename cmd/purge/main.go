@@ -0,0 +1,13 @@
+package main
+
+import "github.com/M15t/ghoul/internal/functions/purge"
+
+func main() {
+	checkErr(purge.Run())
+}
+
+func checkErr(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
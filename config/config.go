@@ -9,18 +9,57 @@ import (
 
 // Configuration holds data necessery for configuring application
 type Configuration struct {
-	Stage        string   `env:"STAGE"`
-	Host         string   `env:"HOST"`
-	Port         int      `env:"PORT"`
-	ReadTimeout  int      `env:"READ_TIMEOUT"`
-	WriteTimeout int      `env:"WRITE_TIMEOUT"`
-	AllowOrigins []string `env:"ALLOW_ORIGINS"`
-	Debug        bool     `env:"DEBUG"`
-	DbLog        bool     `env:"DB_LOG"`
-	DbDsn        string   `env:"DB_DSN"`
-	JwtSecret    string   `env:"JWT_SECRET"`
-	JwtDuration  int      `env:"JWT_DURATION"`
-	JwtAlgorithm string   `env:"JWT_ALGORITHM"`
+	Stage           string   `env:"STAGE"`
+	Host            string   `env:"HOST"`
+	Port            int      `env:"PORT"`
+	ReadTimeout     int      `env:"READ_TIMEOUT"`
+	WriteTimeout    int      `env:"WRITE_TIMEOUT"`
+	AllowOrigins    []string `env:"ALLOW_ORIGINS"`
+	Debug           bool     `env:"DEBUG"`
+	DbLog           bool     `env:"DB_LOG"`
+	DbDsn           string   `env:"DB_DSN"`
+	JwtSecret       string   `env:"JWT_SECRET"`
+	JwtDuration     int      `env:"JWT_DURATION"`
+	JwtAlgorithm    string   `env:"JWT_ALGORITHM"`
+	JwtKeyFiles     []string `env:"JWT_KEY_FILES"`
+	JwtPrivateKey   string   `env:"JWT_PRIVATE_KEY"`
+	JwtActiveKey    string   `env:"JWT_ACTIVE_KEY"`
+	JwtRetiredKeys  []string `env:"JWT_RETIRED_KEYS"`
+	JwtIssuer       string   `env:"JWT_ISSUER"`
+	JwtAudience     string   `env:"JWT_AUDIENCE"`
+	JwtLeeway       int      `env:"JWT_LEEWAY"`
+	SessionDuration int      `env:"SESSION_DURATION"`
+	ResetPwDuration int      `env:"RESET_PASSWORD_DURATION"`
+	RegEnabled      bool     `env:"REGISTRATION_ENABLED"`
+	VerifyEmailDur  int      `env:"VERIFY_EMAIL_DURATION"`
+	PwdAlgorithm    string   `env:"PASSWORD_HASH_ALGORITHM"`
+	PwdBcryptCost   int      `env:"PASSWORD_BCRYPT_COST"`
+	PwdMinLength    int      `env:"PASSWORD_MIN_LENGTH"`
+	PwdUpper        bool     `env:"PASSWORD_REQUIRE_UPPER"`
+	PwdLower        bool     `env:"PASSWORD_REQUIRE_LOWER"`
+	PwdDigit        bool     `env:"PASSWORD_REQUIRE_DIGIT"`
+	PwdSymbol       bool     `env:"PASSWORD_REQUIRE_SYMBOL"`
+	PwdDenylist     []string `env:"PASSWORD_DENYLIST"`
+	PwdHistory      int      `env:"PASSWORD_HISTORY"`
+	LoginMaxFails   int      `env:"LOGIN_MAX_FAILURES"`
+	LoginLockout    int      `env:"LOGIN_LOCKOUT_DURATION"`
+	LoginIPMaxFails int      `env:"LOGIN_IP_MAX_FAILURES"`
+	LoginIPWindow   int      `env:"LOGIN_IP_WINDOW"`
+	MFAIssuer       string   `env:"MFA_ISSUER"`
+	MFARoles        []string `env:"MFA_REQUIRED_ROLES"`
+	WebURL          string   `env:"WEB_URL"`
+	EmailSender     string   `env:"EMAIL_SENDER"`
+	EmailRegion     string   `env:"EMAIL_REGION"`
+	TemplateDir     string   `env:"TEMPLATE_DIR"`
+	OIDCProviders   string   `env:"OIDC_PROVIDERS"`
+	ImpersonateDur  int      `env:"IMPERSONATION_DURATION"`
+	RBACWatcher     string   `env:"RBAC_WATCHER"`
+	RBACPollIntv    int      `env:"RBAC_POLL_INTERVAL"`
+	RBACTopicARN    string   `env:"RBAC_SNS_TOPIC_ARN"`
+	RBACQueueURL    string   `env:"RBAC_SQS_QUEUE_URL"`
+	PurgeRetention  int      `env:"PURGE_RETENTION_DAYS"`
+	CursorSecret    string   `env:"CURSOR_SECRET"`
+	TrustedProxies  []string `env:"TRUSTED_PROXIES"`
 }
 
 // Load returns Configuration struct
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/M15t/ghoul/internal/functions/purge"
+
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// main is meant to be triggered on schedule, e.g: daily by an EventBridge rule
+func main() {
+	lambda.Start(func() (string, error) {
+		err := purge.Run()
+		if err != nil {
+			return "ERROR", fmt.Errorf("ERROR: %+v", err)
+		}
+
+		return "OK", nil
+	})
+}
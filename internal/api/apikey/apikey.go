@@ -0,0 +1,163 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/M15t/ghoul/internal/model"
+	"github.com/M15t/ghoul/pkg/rbac"
+	"github.com/M15t/ghoul/pkg/server"
+	"github.com/M15t/ghoul/pkg/server/middleware/jwt"
+
+	jwtgo "github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// Custom errors
+var (
+	ErrInvalidAPIKey    = server.NewHTTPError(http.StatusUnauthorized, "INVALID_API_KEY", "API key is invalid, expired or revoked")
+	ErrAPIKeyNotFound   = server.NewHTTPError(http.StatusBadRequest, "API_KEY_NOTFOUND", "API key not found")
+	ErrAPIKeyNotAllowed = server.NewHTTPError(http.StatusForbidden, "API_KEY_NOT_ALLOWED", "API keys may not be managed when authenticated by an API key or impersonating")
+	ErrUserNotFound     = server.NewHTTPError(http.StatusBadRequest, "USER_NOTFOUND", "User not found")
+	ErrInvalidExpiry    = server.NewHTTPValidationError("Expiry must be in the future")
+)
+
+// lastUsedInterval limits the writes of the last used time, which is updated on every authenticated request otherwise
+const lastUsedInterval = time.Minute
+
+// Create creates a new API key for the user, returns the full key which is shown only once
+func (s *APIKey) Create(authUsr *model.AuthUser, uid int, data CreationData) (*CreationResp, error) {
+	if err := s.enforce(authUsr, uid, model.ActionCreateAll); err != nil {
+		return nil, err
+	}
+	if data.ExpiresAt != nil && !data.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidExpiry
+	}
+	if existed, err := s.udb.Exist(s.db, uid); err != nil || !existed {
+		return nil, ErrUserNotFound.SetInternal(err)
+	}
+
+	prefix, err := randomHex(6)
+	if err != nil {
+		return nil, server.NewHTTPInternalError("Error generating API key").SetInternal(err)
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, server.NewHTTPInternalError("Error generating API key").SetInternal(err)
+	}
+
+	rec := &model.APIKey{
+		UserID:     uid,
+		Name:       data.Name,
+		Prefix:     prefix,
+		SecretHash: s.cr.HashToken(secret),
+		Scopes:     strings.Join(data.Scopes, " "),
+		ExpiresAt:  data.ExpiresAt,
+	}
+	if err := s.kdb.Create(s.db, rec); err != nil {
+		return nil, server.NewHTTPInternalError("Error creating API key").SetInternal(err)
+	}
+
+	return &CreationResp{APIKey: rec, Key: model.APIKeyPrefix + "_" + prefix + "_" + secret}, nil
+}
+
+// List returns the API keys of the user, newest first
+func (s *APIKey) List(authUsr *model.AuthUser, uid int) ([]*model.APIKey, error) {
+	if err := s.enforce(authUsr, uid, model.ActionViewAll); err != nil {
+		return nil, err
+	}
+
+	var data []*model.APIKey
+	if err := s.kdb.List(s.db.Where("user_id = ?", uid).Order("id DESC"), &data, nil, nil); err != nil {
+		return nil, server.NewHTTPInternalError("Error listing API keys").SetInternal(err)
+	}
+
+	return data, nil
+}
+
+// Revoke revokes the API key of the user
+func (s *APIKey) Revoke(authUsr *model.AuthUser, uid, id int) error {
+	if err := s.enforce(authUsr, uid, model.ActionDeleteAll); err != nil {
+		return err
+	}
+
+	revoked, err := s.kdb.Revoke(s.db, uid, id)
+	if err != nil {
+		return server.NewHTTPInternalError("Error revoking API key").SetInternal(err)
+	}
+	if !revoked {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+// Validate validates the API key, returns the claims of its owner restricted to the key scopes.
+// It is the validator of the keyauth middleware.
+func (s *APIKey) Validate(c echo.Context, key string) (*jwt.Claims, error) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != model.APIKeyPrefix {
+		return nil, ErrInvalidAPIKey
+	}
+
+	rec, err := s.kdb.FindByPrefix(s.db, parts[1])
+	if err != nil {
+		return nil, ErrInvalidAPIKey.SetInternal(err)
+	}
+	now := time.Now()
+	if subtle.ConstantTimeCompare([]byte(rec.SecretHash), []byte(s.cr.HashToken(parts[2]))) != 1 ||
+		rec.RevokedAt != nil || (rec.ExpiresAt != nil && rec.ExpiresAt.Before(now)) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	usr := new(model.User)
+	if err := s.udb.View(s.db, usr, rec.UserID); err != nil {
+		return nil, ErrInvalidAPIKey.SetInternal(err)
+	}
+	if usr.Blocked {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if rec.LastUsedAt == nil || now.Sub(*rec.LastUsedAt) > lastUsedInterval {
+		if err := s.kdb.Update(s.db, map[string]interface{}{"last_used_at": now}, rec.ID); err != nil {
+			return nil, server.NewHTTPInternalError("Error updating API key").SetInternal(err)
+		}
+	}
+
+	return &jwt.Claims{
+		RegisteredClaims: jwtgo.RegisteredClaims{Subject: strconv.Itoa(usr.ID)},
+		Username:         usr.Username,
+		Email:            usr.Email,
+		Role:             usr.Role,
+		Scope:            rec.Scopes,
+	}, nil
+}
+
+// enforce checks user permission to manage the API keys of the given user.
+// The keys may only be managed by the interactive logins, neither by API keys nor by impersonators.
+func (s *APIKey) enforce(authUsr *model.AuthUser, uid int, action string) error {
+	if len(authUsr.Scopes) > 0 || authUsr.Actor != nil {
+		return ErrAPIKeyNotAllowed
+	}
+	if authUsr.ID == uid {
+		return nil
+	}
+	if !s.rbac.Enforce(authUsr.Role, model.ObjectAPIKey, action) {
+		return rbac.ErrForbiddenAction
+	}
+	return nil
+}
+
+// randomHex returns n random bytes, hex encoded
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,39 @@
+package apikey
+
+import (
+	"time"
+
+	"github.com/M15t/ghoul/internal/model"
+	dbutil "github.com/M15t/ghoul/pkg/util/db"
+
+	"gorm.io/gorm"
+)
+
+// NewDB returns a new API key database instance
+func NewDB() *DB {
+	return &DB{dbutil.NewDB(model.APIKey{})}
+}
+
+// DB represents the client for api_keys table
+type DB struct {
+	*dbutil.DB
+}
+
+// FindByPrefix queries for single key by its prefix
+func (d *DB) FindByPrefix(db *gorm.DB, prefix string) (*model.APIKey, error) {
+	rec := new(model.APIKey)
+	if err := d.View(db, rec, "prefix = ?", prefix); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// Revoke revokes the active key of the user.
+// Returns false if there is no such active key.
+func (d *DB) Revoke(db *gorm.DB, uid, id int) (bool, error) {
+	rows, err := d.UpdateRows(db, map[string]interface{}{"revoked_at": time.Now()}, map[string]interface{}{"id": id, "user_id": uid, "revoked_at": nil})
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
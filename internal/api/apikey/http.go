@@ -0,0 +1,277 @@
+package apikey
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/M15t/ghoul/internal/model"
+	"github.com/M15t/ghoul/pkg/server"
+	httputil "github.com/M15t/ghoul/pkg/util/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HTTP represents API key http service
+type HTTP struct {
+	svc  Service
+	auth model.Auth
+}
+
+// Service represents API key application interface
+type Service interface {
+	Create(*model.AuthUser, int, CreationData) (*CreationResp, error)
+	List(*model.AuthUser, int) ([]*model.APIKey, error)
+	Revoke(*model.AuthUser, int, int) error
+}
+
+// NewHTTP creates new API key http service, `eg` is the users group
+func NewHTTP(svc Service, auth model.Auth, eg *echo.Group) {
+	h := HTTP{svc, auth}
+
+	// swagger:operation POST /v1/users/me/api-keys apikeys apikeysCreateMine
+	// ---
+	// summary: Creates new API key for the authenticated user
+	// description: The key is returned only once, send it in the `X-API-Key` header to authenticate.
+	//   API keys may not be managed when authenticated by an API key.
+	// parameters:
+	// - name: request
+	//   in: body
+	//   description: Request body
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/APIKeyCreationData"
+	// responses:
+	//   "200":
+	//     description: The new API key
+	//     schema:
+	//       "$ref": "#/definitions/APIKeyCreationResp"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "403":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	eg.POST("/me/api-keys", h.createMine)
+
+	// swagger:operation GET /v1/users/me/api-keys apikeys apikeysListMine
+	// ---
+	// summary: Returns the API keys of the authenticated user
+	// responses:
+	//   "200":
+	//     description: List of API keys
+	//     schema:
+	//       "$ref": "#/definitions/APIKeyListResp"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "403":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	eg.GET("/me/api-keys", h.listMine)
+
+	// swagger:operation DELETE /v1/users/me/api-keys/{key_id} apikeys apikeysRevokeMine
+	// ---
+	// summary: Revokes an API key of the authenticated user
+	// parameters:
+	// - name: key_id
+	//   in: path
+	//   description: id of API key
+	//   type: integer
+	//   required: true
+	// responses:
+	//   "200":
+	//     "$ref": "#/responses/ok"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "403":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	eg.DELETE("/me/api-keys/:key_id", h.revokeMine)
+
+	// swagger:operation POST /v1/users/{id}/api-keys apikeys apikeysCreate
+	// ---
+	// summary: Creates new API key for an user, e.g. a service account
+	// description: The key is returned only once, send it in the `X-API-Key` header to authenticate.
+	// parameters:
+	// - name: id
+	//   in: path
+	//   description: id of user
+	//   type: integer
+	//   required: true
+	// - name: request
+	//   in: body
+	//   description: Request body
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/APIKeyCreationData"
+	// responses:
+	//   "200":
+	//     description: The new API key
+	//     schema:
+	//       "$ref": "#/definitions/APIKeyCreationResp"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "403":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	eg.POST("/:id/api-keys", h.create)
+
+	// swagger:operation GET /v1/users/{id}/api-keys apikeys apikeysList
+	// ---
+	// summary: Returns the API keys of an user
+	// parameters:
+	// - name: id
+	//   in: path
+	//   description: id of user
+	//   type: integer
+	//   required: true
+	// responses:
+	//   "200":
+	//     description: List of API keys
+	//     schema:
+	//       "$ref": "#/definitions/APIKeyListResp"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "403":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	eg.GET("/:id/api-keys", h.list)
+
+	// swagger:operation DELETE /v1/users/{id}/api-keys/{key_id} apikeys apikeysRevoke
+	// ---
+	// summary: Revokes an API key of an user
+	// parameters:
+	// - name: id
+	//   in: path
+	//   description: id of user
+	//   type: integer
+	//   required: true
+	// - name: key_id
+	//   in: path
+	//   description: id of API key
+	//   type: integer
+	//   required: true
+	// responses:
+	//   "200":
+	//     "$ref": "#/responses/ok"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "403":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	eg.DELETE("/:id/api-keys/:key_id", h.revoke)
+}
+
+// CreationData contains API key data from json request
+// swagger:model APIKeyCreationData
+type CreationData struct {
+	// example: CI deployment
+	Name string `json:"name" validate:"required,max=100"`
+	// The write scope implies the read scope
+	// example: ["read"]
+	Scopes []string `json:"scopes" validate:"required,min=1,dive,oneof=read write"`
+	// The key never expires if omitted
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreationResp contains the new API key
+// swagger:model APIKeyCreationResp
+type CreationResp struct {
+	*model.APIKey
+	// The full API key, it is shown only once
+	Key string `json:"key"`
+}
+
+// ListResp contains list of API keys
+// swagger:model APIKeyListResp
+type ListResp struct {
+	Data []*model.APIKey `json:"data"`
+}
+
+func (h *HTTP) createMine(c echo.Context) error {
+	return h.doCreate(c, h.auth.User(c).ID)
+}
+
+func (h *HTTP) listMine(c echo.Context) error {
+	return h.doList(c, h.auth.User(c).ID)
+}
+
+func (h *HTTP) revokeMine(c echo.Context) error {
+	return h.doRevoke(c, h.auth.User(c).ID)
+}
+
+func (h *HTTP) create(c echo.Context) error {
+	id, err := httputil.ReqID(c)
+	if err != nil {
+		return err
+	}
+	return h.doCreate(c, id)
+}
+
+func (h *HTTP) list(c echo.Context) error {
+	id, err := httputil.ReqID(c)
+	if err != nil {
+		return err
+	}
+	return h.doList(c, id)
+}
+
+func (h *HTTP) revoke(c echo.Context) error {
+	id, err := httputil.ReqID(c)
+	if err != nil {
+		return err
+	}
+	return h.doRevoke(c, id)
+}
+
+func (h *HTTP) doCreate(c echo.Context, uid int) error {
+	r := CreationData{}
+	if err := c.Bind(&r); err != nil {
+		return err
+	}
+	r.Name = strings.TrimSpace(r.Name)
+
+	resp, err := h.svc.Create(h.auth.User(c), uid, r)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (h *HTTP) doList(c echo.Context, uid int) error {
+	resp, err := h.svc.List(h.auth.User(c), uid)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, ListResp{resp})
+}
+
+func (h *HTTP) doRevoke(c echo.Context, uid int) error {
+	kid, err := strconv.Atoi(c.Param("key_id"))
+	if err != nil {
+		return server.NewHTTPValidationError("Invalid API key ID")
+	}
+	if err := h.svc.Revoke(h.auth.User(c), uid, kid); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
@@ -0,0 +1,41 @@
+package apikey
+
+import (
+	"github.com/M15t/ghoul/internal/model"
+	"github.com/M15t/ghoul/pkg/rbac"
+	dbutil "github.com/M15t/ghoul/pkg/util/db"
+
+	"gorm.io/gorm"
+)
+
+// New creates new API key application service
+func New(db *gorm.DB, kdb MyDB, udb dbutil.Intf, rbacSvc rbac.Intf, cr Crypter) *APIKey {
+	return &APIKey{
+		db:   db,
+		kdb:  kdb,
+		udb:  udb,
+		rbac: rbacSvc,
+		cr:   cr,
+	}
+}
+
+// APIKey represents API key application service
+type APIKey struct {
+	db   *gorm.DB
+	kdb  MyDB
+	udb  dbutil.Intf
+	rbac rbac.Intf
+	cr   Crypter
+}
+
+// MyDB represents API key repository interface
+type MyDB interface {
+	dbutil.Intf
+	FindByPrefix(*gorm.DB, string) (*model.APIKey, error)
+	Revoke(db *gorm.DB, uid, id int) (bool, error)
+}
+
+// Crypter represents security interface
+type Crypter interface {
+	HashToken(string) string
+}
@@ -2,78 +2,270 @@ package auth
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/M15t/ghoul/internal/model"
 	"github.com/M15t/ghoul/pkg/server"
+	"github.com/M15t/ghoul/pkg/server/middleware/jwt"
+	"github.com/M15t/ghoul/pkg/server/middleware/tenant"
+	dbutil "github.com/M15t/ghoul/pkg/util/db"
 
+	jwtgo "github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
 )
 
 // Custom errors
 var (
-	ErrInvalidCredentials  = server.NewHTTPError(http.StatusUnauthorized, "INVALID_CREDENTIALS", "Username or password is incorrect")
-	ErrUserBlocked         = server.NewHTTPError(http.StatusUnauthorized, "USER_BLOCKED", "Your account has been blocked and may not login")
-	ErrInvalidRefreshToken = server.NewHTTPError(http.StatusUnauthorized, "INVALID_REFRESH_TOKEN", "Invalid refresh token")
+	ErrInvalidCredentials    = server.NewHTTPError(http.StatusUnauthorized, "INVALID_CREDENTIALS", "Username or password is incorrect")
+	ErrUserBlocked           = server.NewHTTPError(http.StatusUnauthorized, "USER_BLOCKED", "Your account has been blocked and may not login")
+	ErrInvalidRefreshToken   = server.NewHTTPError(http.StatusUnauthorized, "INVALID_REFRESH_TOKEN", "Invalid refresh token")
+	ErrRefreshTokenReused    = server.NewHTTPError(http.StatusUnauthorized, "REFRESH_TOKEN_REUSED", "Refresh token has already been used, the session has been revoked")
+	ErrInvalidResetToken     = server.NewHTTPError(http.StatusBadRequest, "INVALID_RESET_TOKEN", "Password reset token is invalid or has expired")
+	ErrEmailNotVerified      = server.NewHTTPError(http.StatusUnauthorized, "EMAIL_NOT_VERIFIED", "Your email address has not been verified yet")
+	ErrRegistrationClosed    = server.NewHTTPError(http.StatusForbidden, "REGISTRATION_DISABLED", "Registration is currently disabled")
+	ErrUsernameExisted       = server.NewHTTPValidationError("Username already existed")
+	ErrEmailExisted          = server.NewHTTPValidationError("Email already existed")
+	ErrInvalidVerifyToken    = server.NewHTTPError(http.StatusBadRequest, "INVALID_VERIFY_TOKEN", "Email verification token is invalid or has expired")
+	ErrTooManyRequests       = server.NewHTTPError(http.StatusTooManyRequests, "TOO_MANY_REQUESTS", "Too many requests, please try again later")
+	ErrAccountLocked         = server.NewHTTPError(http.StatusTooManyRequests, "ACCOUNT_LOCKED", "Your account has been temporarily locked due to too many failed login attempts, please try again later")
+	ErrPasswordReused        = server.NewHTTPValidationError("Password has been used recently, please choose another one")
+	ErrUserNotFound          = server.NewHTTPError(http.StatusBadRequest, "USER_NOTFOUND", "User not found")
+	ErrInvalidMFAToken       = server.NewHTTPError(http.StatusUnauthorized, "INVALID_MFA_TOKEN", "MFA token is invalid or has expired, please login again")
+	ErrInvalidMFACode        = server.NewHTTPError(http.StatusBadRequest, "INVALID_MFA_CODE", "Authentication code is incorrect")
+	ErrMFAAlreadyEnabled     = server.NewHTTPError(http.StatusBadRequest, "MFA_ALREADY_ENABLED", "Two-factor authentication is already enabled")
+	ErrMFANotEnrolled        = server.NewHTTPError(http.StatusBadRequest, "MFA_NOT_ENROLLED", "Two-factor authentication has not been enrolled")
+	ErrMFARequired           = server.NewHTTPError(http.StatusForbidden, "MFA_REQUIRED", "Two-factor authentication is required for your role")
+	ErrImpersonating         = server.NewHTTPError(http.StatusForbidden, "IMPERSONATING", "This action is not allowed while impersonating")
+	ErrServiceAccount        = server.NewHTTPError(http.StatusUnauthorized, "SERVICE_ACCOUNT", "Service accounts may only authenticate by API keys")
+	ErrOAuthProviderNotFound = server.NewHTTPError(http.StatusNotFound, "OAUTH_PROVIDER_NOTFOUND", "Login provider not found")
+	ErrInvalidOAuthState     = server.NewHTTPError(http.StatusBadRequest, "INVALID_OAUTH_STATE", "Login request is invalid or has expired, please try again")
+	ErrOAuthFailed           = server.NewHTTPError(http.StatusUnauthorized, "OAUTH_FAILED", "Could not login with the provider")
+	ErrOAuthEmailNotVerified = server.NewHTTPError(http.StatusUnauthorized, "OAUTH_EMAIL_NOT_VERIFIED", "The email address has not been verified by the provider")
+	ErrOAuthAccountNotFound  = server.NewHTTPError(http.StatusUnauthorized, "OAUTH_ACCOUNT_NOTFOUND", "There is no account of this email address")
+	ErrAccountDeleted        = server.NewHTTPError(http.StatusUnauthorized, "ACCOUNT_DELETED", "The account of this email address has been deleted")
 )
 
-// LoginUser logs in the given user, returns access token
-func (s *Auth) LoginUser(u *model.User) (*model.AuthToken, error) {
-	claims := map[string]interface{}{
-		"id":       u.ID,
-		"username": u.Username,
-		"email":    u.Email,
-		"role":     u.Role,
+// refreshTokenSep separates the session family and the secret in a refresh token
+const refreshTokenSep = "."
+
+// LoginUser logs in the given user on a new session, returns access token
+func (s *Auth) LoginUser(c echo.Context, u *model.User) (*model.AuthToken, error) {
+	now := time.Now()
+	secret := s.cr.UID()
+	sess := &model.Session{
+		UserID:     u.ID,
+		FamilyID:   s.cr.UID(),
+		TokenHash:  s.cr.HashToken(secret),
+		UserAgent:  truncate(c.Request().UserAgent(), 255),
+		IP:         c.RealIP(),
+		LastUsedAt: &now,
 	}
-	token, expiresin, err := s.jwt.GenerateToken(claims, nil)
-	if err != nil {
-		return nil, server.NewHTTPInternalError("Error generating token").SetInternal(err)
+	if s.cfg.SessionDuration > 0 {
+		expiresAt := now.Add(s.cfg.SessionDuration)
+		sess.ExpiresAt = &expiresAt
 	}
 
-	refreshToken := s.cr.UID()
-	err = s.udb.Update(s.db, map[string]interface{}{"refresh_token": refreshToken, "last_login": time.Now()}, u.ID)
-	if err != nil {
-		return nil, server.NewHTTPInternalError("Error updating user").SetInternal(err)
+	if err := dbutil.Transaction(s.db, func(tx *gorm.DB) error {
+		if err := s.sdb.Create(tx, sess); err != nil {
+			return err
+		}
+		return s.udb.Update(tx, map[string]interface{}{"last_login": now}, u.ID)
+	}); err != nil {
+		return nil, server.NewHTTPInternalError("Error creating session").SetInternal(err)
 	}
 
-	return &model.AuthToken{AccessToken: token, TokenType: "bearer", ExpiresIn: expiresin, RefreshToken: refreshToken}, nil
+	return s.issueToken(u, sess, secret)
 }
 
 // Authenticate tries to authenticate the user provided by given credentials
 func (s *Auth) Authenticate(c echo.Context, data Credentials) (*model.AuthToken, error) {
+	if err := s.checkIPThrottle(c); err != nil {
+		return nil, err
+	}
+
 	usr, err := s.udb.FindByUsername(s.db, data.Username)
 	if err != nil || usr == nil {
+		if err := s.recordLoginFailure(c, data.Username); err != nil {
+			return nil, err
+		}
 		return nil, ErrInvalidCredentials.SetInternal(err)
 	}
+	if usr.LockedUntil != nil && usr.LockedUntil.After(time.Now()) {
+		return nil, ErrAccountLocked
+	}
 	if !s.cr.CompareHashAndPassword(usr.Password, data.Password) {
-		return nil, ErrInvalidCredentials
+		return nil, s.loginFailed(c, usr)
+	}
+	if usr.ServiceAccount {
+		return nil, ErrServiceAccount
 	}
+	if err := s.resetLoginFailures(usr); err != nil {
+		return nil, err
+	}
+	s.rehashPassword(c, usr, data.Password)
 	if usr.Blocked {
 		return nil, ErrUserBlocked
 	}
+	if usr.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+	if usr.MFAEnabled || s.mfaRequired(usr.Role) {
+		return s.mfaChallenge(usr)
+	}
 
-	return s.LoginUser(usr)
+	return s.LoginUser(c, usr)
 }
 
-// RefreshToken returns the new access token with expired time extended
+// RefreshToken rotates the given refresh token and returns the new access token.
+// Presenting a refresh token that has already been rotated revokes the whole session.
 func (s *Auth) RefreshToken(c echo.Context, data RefreshTokenData) (*model.AuthToken, error) {
-	usr, err := s.udb.FindByRefreshToken(s.db, data.RefreshToken)
-	if err != nil || usr == nil {
+	family, secret, ok := strings.Cut(data.RefreshToken, refreshTokenSep)
+	if !ok {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	sess, err := s.sdb.FindByFamily(s.db, family)
+	if err != nil {
 		return nil, ErrInvalidRefreshToken.SetInternal(err)
 	}
-	return s.LoginUser(usr)
+	now := time.Now()
+	if sess.RevokedAt != nil || (sess.ExpiresAt != nil && sess.ExpiresAt.Before(now)) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	oldHash := s.cr.HashToken(secret)
+	if oldHash != sess.TokenHash {
+		return nil, s.revokeReusedSession(sess)
+	}
+
+	usr := new(model.User)
+	if err := s.udb.View(s.db, usr, sess.UserID); err != nil {
+		return nil, ErrInvalidRefreshToken.SetInternal(err)
+	}
+	if usr.Blocked {
+		return nil, ErrUserBlocked
+	}
+
+	newSecret := s.cr.UID()
+	rotated, err := s.sdb.Rotate(s.db, sess, oldHash, s.cr.HashToken(newSecret), map[string]interface{}{
+		"last_used_at": now,
+		"user_agent":   truncate(c.Request().UserAgent(), 255),
+		"ip":           c.RealIP(),
+	})
+	if err != nil {
+		return nil, server.NewHTTPInternalError("Error rotating refresh token").SetInternal(err)
+	}
+	if !rotated {
+		// another request has just rotated the same token
+		return nil, s.revokeReusedSession(sess)
+	}
+
+	return s.issueToken(usr, sess, newSecret)
 }
 
-// User returns user data stored in jwt token
+// Logout revokes the current session and its access token
+func (s *Auth) Logout(c echo.Context) error {
+	claims, ok := jwt.GetClaims(c)
+	if !ok {
+		return jwt.ErrUnauthorized
+	}
+
+	if claims.SessionID != "" {
+		if err := s.sdb.Revoke(s.db, map[string]interface{}{"family_id": claims.SessionID}); err != nil {
+			return server.NewHTTPInternalError("Error revoking session").SetInternal(err)
+		}
+	}
+
+	if err := s.jwt.RevokeToken(claims.ID, claims.ExpiresAt.Time); err != nil {
+		return server.NewHTTPInternalError("Error revoking token").SetInternal(err)
+	}
+
+	return nil
+}
+
+// LogoutAll revokes all sessions and access tokens of the authenticated user
+func (s *Auth) LogoutAll(c echo.Context) error {
+	usr := s.User(c)
+	if usr.Actor != nil {
+		return ErrImpersonating
+	}
+	return s.RevokeUserSessions(usr.ID)
+}
+
+// RevokeUserSessions revokes all sessions and access tokens of the given user
+func (s *Auth) RevokeUserSessions(uid int) error {
+	if err := s.sdb.Revoke(s.db, map[string]interface{}{"user_id": uid}); err != nil {
+		return server.NewHTTPInternalError("Error revoking sessions").SetInternal(err)
+	}
+	if err := s.jwt.RevokeSubject(strconv.Itoa(uid)); err != nil {
+		return server.NewHTTPInternalError("Error revoking tokens").SetInternal(err)
+	}
+	return nil
+}
+
+// JWKS returns the public keys to verify the access tokens
+func (s *Auth) JWKS() *jwt.JWKS {
+	return s.jwt.JWKS()
+}
+
+// User returns user data stored in jwt token.
+// An empty user (which has no role, thus no permission) is returned if the request is not authenticated.
 func (s *Auth) User(c echo.Context) *model.AuthUser {
-	id, _ := c.Get("id").(float64)
-	user, _ := c.Get("username").(string)
-	email, _ := c.Get("email").(string)
-	role, _ := c.Get("role").(string)
-	return &model.AuthUser{
-		ID:       int(id),
-		Username: user,
-		Email:    email,
-		Role:     role,
+	claims, ok := jwt.GetClaims(c)
+	if !ok {
+		return &model.AuthUser{}
+	}
+	id, _ := strconv.Atoi(claims.Subject)
+	usr := &model.AuthUser{
+		ID:       id,
+		Username: claims.Username,
+		Email:    claims.Email,
+		Role:     claims.Role,
+		Scopes:   strings.Fields(claims.Scope),
+	}
+	if claims.Actor != nil {
+		actorID, _ := strconv.Atoi(claims.Actor.Subject)
+		usr.Actor = &model.AuthUser{ID: actorID, Username: claims.Actor.Username}
+	}
+	if t, ok := tenant.Get(c); ok {
+		usr.OrgID, _ = strconv.Atoi(t.ID)
+		usr.OrgRole = t.Role
+	}
+
+	return usr
+}
+
+// issueToken generates the access token for the given user session
+func (s *Auth) issueToken(u *model.User, sess *model.Session, secret string) (*model.AuthToken, error) {
+	claims := &jwt.Claims{
+		RegisteredClaims: jwtgo.RegisteredClaims{Subject: strconv.Itoa(u.ID)},
+		SessionID:        sess.FamilyID,
+		Username:         u.Username,
+		Email:            u.Email,
+		Role:             u.Role,
+	}
+	token, expiresin, err := s.jwt.GenerateToken(claims, nil)
+	if err != nil {
+		return nil, server.NewHTTPInternalError("Error generating token").SetInternal(err)
+	}
+
+	return &model.AuthToken{AccessToken: token, TokenType: "bearer", ExpiresIn: expiresin, RefreshToken: sess.FamilyID + refreshTokenSep + secret}, nil
+}
+
+// revokeReusedSession revokes the whole session family once a rotated refresh token is replayed
+func (s *Auth) revokeReusedSession(sess *model.Session) error {
+	if err := s.sdb.Revoke(s.db, map[string]interface{}{"id": sess.ID}); err != nil {
+		return server.NewHTTPInternalError("Error revoking session").SetInternal(err)
+	}
+	return ErrRefreshTokenReused
+}
+
+func truncate(s string, max int) string {
+	if len(s) > max {
+		return s[:max]
 	}
+	return s
 }
@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/M15t/ghoul/internal/model"
+	dbutil "github.com/M15t/ghoul/pkg/util/db"
+
+	"gorm.io/gorm"
+)
+
+// NewSessionDB returns a new session database instance
+func NewSessionDB() *SessionDB {
+	return &SessionDB{dbutil.NewDB(model.Session{})}
+}
+
+// SessionDB represents the client for session table
+type SessionDB struct {
+	*dbutil.DB
+}
+
+// FindByFamily queries for single session by its family ID
+func (d *SessionDB) FindByFamily(db *gorm.DB, family string) (*model.Session, error) {
+	rec := new(model.Session)
+	if err := d.View(db, rec, "family_id = ?", family); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// Rotate replaces the refresh token hash of the session, only if the current hash is still `oldHash`.
+// Returns false if the token has been rotated by another request in the meantime.
+func (d *SessionDB) Rotate(db *gorm.DB, rec *model.Session, oldHash, newHash string, updates map[string]interface{}) (bool, error) {
+	updates["token_hash"] = newHash
+	rows, err := d.UpdateRows(db, updates, map[string]interface{}{"id": rec.ID, "token_hash": oldHash, "revoked_at": nil})
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// Revoke revokes all active sessions matching the given conditions
+func (d *SessionDB) Revoke(db *gorm.DB, cond map[string]interface{}) error {
+	cond["revoked_at"] = nil
+	return d.Update(db, map[string]interface{}{"revoked_at": time.Now()}, cond)
+}
+
+// NewUserTokenDB returns a new user token database instance
+func NewUserTokenDB() *UserTokenDB {
+	return &UserTokenDB{dbutil.NewDB(model.UserToken{})}
+}
+
+// UserTokenDB represents the client for user_tokens table
+type UserTokenDB struct {
+	*dbutil.DB
+}
+
+// FindValid queries for single unused and unexpired token by its purpose and hash
+func (d *UserTokenDB) FindValid(db *gorm.DB, purpose, hash string) (*model.UserToken, error) {
+	rec := new(model.UserToken)
+	if err := d.View(db, rec, "purpose = ? AND token_hash = ? AND used_at IS NULL AND expires_at > ?", purpose, hash, time.Now()); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// Consume marks the token as used, only if it has not been used yet.
+// Returns false if the token has been consumed by another request in the meantime.
+func (d *UserTokenDB) Consume(db *gorm.DB, rec *model.UserToken) (bool, error) {
+	rows, err := d.UpdateRows(db, map[string]interface{}{"used_at": time.Now()}, map[string]interface{}{"id": rec.ID, "used_at": nil})
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// CountSince returns the number of tokens issued to the user for the given purpose since the given time
+func (d *UserTokenDB) CountSince(db *gorm.DB, uid int, purpose string, since time.Time) (int64, error) {
+	var count int64
+	err := db.Model(d.Model).Where("user_id = ? AND purpose = ? AND created_at >= ?", uid, purpose, since).Count(&count).Error
+	return count, err
+}
+
+// IncrAttempts increases the failed attempts counter of the token
+func (d *UserTokenDB) IncrAttempts(db *gorm.DB, rec *model.UserToken) error {
+	rec.Attempts++
+	return d.Update(db, map[string]interface{}{"attempts": gorm.Expr("attempts + 1")}, rec.ID)
+}
+
+// Invalidate marks all unused tokens of the user for the given purpose as used
+func (d *UserTokenDB) Invalidate(db *gorm.DB, uid int, purpose string) error {
+	return d.Update(db, map[string]interface{}{"used_at": time.Now()}, map[string]interface{}{"user_id": uid, "purpose": purpose, "used_at": nil})
+}
+
+// NewRecoveryCodeDB returns a new recovery code database instance
+func NewRecoveryCodeDB() *RecoveryCodeDB {
+	return &RecoveryCodeDB{dbutil.NewDB(model.RecoveryCode{})}
+}
+
+// RecoveryCodeDB represents the client for recovery_codes table
+type RecoveryCodeDB struct {
+	*dbutil.DB
+}
+
+// Replace deletes all recovery codes of the user then creates the new ones from given hashes
+func (d *RecoveryCodeDB) Replace(db *gorm.DB, uid int, hashes []string) error {
+	if err := d.Delete(db, map[string]interface{}{"user_id": uid}); err != nil {
+		return err
+	}
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	recs := make([]*model.RecoveryCode, 0, len(hashes))
+	for _, h := range hashes {
+		recs = append(recs, &model.RecoveryCode{UserID: uid, CodeHash: h})
+	}
+	return d.CreateInBatches(db, recs, len(recs))
+}
+
+// Consume marks the unused recovery code of the user as used.
+// Returns false if there is no such unused code.
+func (d *RecoveryCodeDB) Consume(db *gorm.DB, uid int, hash string) (bool, error) {
+	rows, err := d.UpdateRows(db, map[string]interface{}{"used_at": time.Now()}, map[string]interface{}{"user_id": uid, "code_hash": hash, "used_at": nil})
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// NewLoginFailureDB returns a new login failure database instance
+func NewLoginFailureDB() *LoginFailureDB {
+	return &LoginFailureDB{dbutil.NewDB(model.LoginFailure{})}
+}
+
+// LoginFailureDB represents the client for login_failures table
+type LoginFailureDB struct {
+	*dbutil.DB
+}
+
+// CountSince returns the number of failed login attempts from the IP address since the given time
+func (d *LoginFailureDB) CountSince(db *gorm.DB, ip string, since time.Time) (int64, error) {
+	var count int64
+	err := db.Model(d.Model).Where("ip = ? AND created_at >= ?", ip, since).Count(&count).Error
+	return count, err
+}
+
+// LastAt returns the time of the last failed login attempt from the IP address, zero if none
+func (d *LoginFailureDB) LastAt(db *gorm.DB, ip string) (time.Time, error) {
+	rec := new(model.LoginFailure)
+	err := db.Model(d.Model).Where("ip = ?", ip).Order("id DESC").Limit(1).Find(rec).Error
+	return rec.CreatedAt, err
+}
+
+// Purge deletes the failed login attempts created before the given time
+func (d *LoginFailureDB) Purge(db *gorm.DB, before time.Time) error {
+	return d.Delete(db, "created_at < ?", before)
+}
+
+// NewPasswordHistoryDB returns a new password history database instance
+func NewPasswordHistoryDB() *PasswordHistoryDB {
+	return &PasswordHistoryDB{dbutil.NewDB(model.PasswordHistory{})}
+}
+
+// PasswordHistoryDB represents the client for password_histories table
+type PasswordHistoryDB struct {
+	*dbutil.DB
+}
+
+// Recent returns the hashes of the last passwords of the user, newest first
+func (d *PasswordHistoryDB) Recent(db *gorm.DB, uid int, limit int) ([]string, error) {
+	var hashes []string
+	err := db.Model(d.Model).Where("user_id = ?", uid).Order("id DESC").Limit(limit).Pluck("hash", &hashes).Error
+	return hashes, err
+}
+
+// Prune deletes the passwords of the user except the last `keep` ones
+func (d *PasswordHistoryDB) Prune(db *gorm.DB, uid int, keep int) error {
+	var ids []int
+	if err := db.Model(d.Model).Where("user_id = ?", uid).Order("id DESC").Limit(keep).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) < keep {
+		return nil
+	}
+	return d.Delete(db, "user_id = ? AND id < ?", uid, ids[len(ids)-1])
+}
+
+// NewOAuthStateDB returns a new OAuth state database instance
+func NewOAuthStateDB() *OAuthStateDB {
+	return &OAuthStateDB{dbutil.NewDB(model.OAuthState{})}
+}
+
+// OAuthStateDB represents the client for oauth_states table
+type OAuthStateDB struct {
+	*dbutil.DB
+}
+
+// Consume deletes the unexpired state of the given hash, returns it.
+// gorm.ErrRecordNotFound is returned if there is no such state or it has been consumed by another request.
+func (d *OAuthStateDB) Consume(db *gorm.DB, hash string) (*model.OAuthState, error) {
+	rec := new(model.OAuthState)
+	if err := d.View(db, rec, "state_hash = ? AND expires_at > ?", hash, time.Now()); err != nil {
+		return nil, err
+	}
+	rows, err := d.DeleteRows(db, rec.ID)
+	if err != nil {
+		return nil, err
+	}
+	if rows == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return rec, nil
+}
+
+// Purge deletes the states expired before the given time
+func (d *OAuthStateDB) Purge(db *gorm.DB, before time.Time) error {
+	return d.Delete(db, "expires_at < ?", before)
+}
+
+// NewUserIdentityDB returns a new user identity database instance
+func NewUserIdentityDB() *UserIdentityDB {
+	return &UserIdentityDB{dbutil.NewDB(model.UserIdentity{})}
+}
+
+// UserIdentityDB represents the client for user_identities table
+type UserIdentityDB struct {
+	*dbutil.DB
+}
+
+// FindBySubject queries for the identity of the given provider & subject
+func (d *UserIdentityDB) FindBySubject(db *gorm.DB, provider, subject string) (*model.UserIdentity, error) {
+	rec := new(model.UserIdentity)
+	if err := d.View(db, rec, "provider = ? AND subject = ?", provider, subject); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
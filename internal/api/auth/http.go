@@ -2,8 +2,10 @@ package auth
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/M15t/ghoul/internal/model"
+	"github.com/M15t/ghoul/pkg/server/middleware/jwt"
 
 	"github.com/labstack/echo/v4"
 )
@@ -17,15 +19,33 @@ type HTTP struct {
 type Service interface {
 	Authenticate(echo.Context, Credentials) (*model.AuthToken, error)
 	RefreshToken(echo.Context, RefreshTokenData) (*model.AuthToken, error)
+	Logout(echo.Context) error
+	LogoutAll(echo.Context) error
+	JWKS() *jwt.JWKS
+	ForgotPassword(echo.Context, ForgotPasswordData) error
+	ResetPassword(echo.Context, ResetPasswordData) error
+	Register(echo.Context, RegisterData) (*model.User, error)
+	VerifyEmail(echo.Context, VerifyEmailData) error
+	ResendVerification(echo.Context, ResendVerificationData) error
+	LoginMFA(echo.Context, MFALoginData) (*model.AuthToken, error)
+	EnrollMFAOnLogin(echo.Context, MFAEnrollData) (*MFAEnrollment, error)
+	EnrollMFA(echo.Context) (*MFAEnrollment, error)
+	ConfirmMFA(echo.Context, MFACodeData) (*RecoveryCodesResp, error)
+	DisableMFA(echo.Context, MFACodeData) error
+	RegenerateRecoveryCodes(echo.Context, MFACodeData) (*RecoveryCodesResp, error)
+	OAuthAuthorize(echo.Context, string) (string, error)
+	OAuthLogin(echo.Context, string, OAuthCallbackData) (*model.AuthToken, error)
 }
 
-// NewHTTP creates new auth http service
-func NewHTTP(svc Service, e *echo.Echo) {
+// NewHTTP creates new auth http service.
+// `authMW` is the authentication middleware protecting the endpoints of the logged in user
+func NewHTTP(svc Service, e *echo.Echo, authMW echo.MiddlewareFunc) {
 	h := HTTP{svc}
 
 	// swagger:operation POST /login auth authLogin
 	// ---
 	// summary: Logs in user by username and password
+	// description: If the second factor is required, only `mfa_token` is returned. Exchange it at `/login/mfa`.
 	// parameters:
 	// - name: request
 	//   in: body
@@ -44,6 +64,111 @@ func NewHTTP(svc Service, e *echo.Echo) {
 	//     "$ref": "#/responses/errDetails"
 	e.POST("/login", h.login)
 
+	// swagger:operation POST /login/mfa auth authLoginMFA
+	// ---
+	// summary: Completes the login by the second factor
+	// description: Exchanges the `mfa_token` given by `/login` and the TOTP code (or a recovery code) for the access token.
+	//   If the enrollment is required, the code confirms it and `recovery_codes` are returned as well.
+	// security: []
+	// parameters:
+	// - name: request
+	//   in: body
+	//   description: Request body
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/MFALoginData"
+	// responses:
+	//   "200":
+	//     description: Access token
+	//     schema:
+	//       "$ref": "#/definitions/AuthToken"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	e.POST("/login/mfa", h.loginMFA)
+
+	// swagger:operation POST /login/mfa/enroll auth authLoginMFAEnroll
+	// ---
+	// summary: Starts the TOTP enrollment on login, when `mfa_enroll_required` is returned by `/login`
+	// security: []
+	// parameters:
+	// - name: request
+	//   in: body
+	//   description: Request body
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/MFAEnrollData"
+	// responses:
+	//   "200":
+	//     description: TOTP secret and its URI for QR code
+	//     schema:
+	//       "$ref": "#/definitions/MFAEnrollment"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	e.POST("/login/mfa/enroll", h.enrollMFAOnLogin)
+
+	// swagger:operation GET /oauth/{provider}/authorize auth authOAuthAuthorize
+	// ---
+	// summary: Starts the login with an OpenID provider
+	// description: Redirects to the provider consent page. The provider then redirects back to the configured
+	//   redirect URL of the web app with `code` & `state` query parameters, to be posted to `/oauth/{provider}/callback`.
+	// security: []
+	// parameters:
+	// - name: provider
+	//   in: path
+	//   description: Provider name, e.g. google
+	//   type: string
+	//   required: true
+	// responses:
+	//   "302":
+	//     description: Redirect to the provider consent page
+	//   "404":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	e.GET("/oauth/:provider/authorize", h.oauthAuthorize)
+
+	// swagger:operation POST /oauth/{provider}/callback auth authOAuthCallback
+	// ---
+	// summary: Completes the login with an OpenID provider
+	// description: The identity is linked to the account of the same email address if the provider has verified it.
+	//   If there is no such account and the registration is enabled, a new one is created.
+	//   If the second factor is required, only `mfa_token` is returned. Exchange it at `/login/mfa`.
+	// security: []
+	// parameters:
+	// - name: provider
+	//   in: path
+	//   description: Provider name, e.g. google
+	//   type: string
+	//   required: true
+	// - name: request
+	//   in: body
+	//   description: Request body
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/OAuthCallbackData"
+	// responses:
+	//   "200":
+	//     description: Access token
+	//     schema:
+	//       "$ref": "#/definitions/AuthToken"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "404":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	e.POST("/oauth/:provider/callback", h.oauthCallback)
+
 	// swagger:operation POST /refresh-token auth authRefreshToken
 	// ---
 	// summary: Refresh access token
@@ -64,6 +189,239 @@ func NewHTTP(svc Service, e *echo.Echo) {
 	//   "500":
 	//     "$ref": "#/responses/errDetails"
 	e.POST("/refresh-token", h.refreshToken)
+
+	// swagger:operation POST /logout auth authLogout
+	// ---
+	// summary: Logs out the current session, revokes its refresh token and access token
+	// security:
+	// - bearer: []
+	// responses:
+	//   "200":
+	//     "$ref": "#/responses/ok"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	e.POST("/logout", h.logout, authMW)
+
+	// swagger:operation POST /logout-all auth authLogoutAll
+	// ---
+	// summary: Logs out all sessions of the authenticated user on all devices
+	// security:
+	// - bearer: []
+	// responses:
+	//   "200":
+	//     "$ref": "#/responses/ok"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	e.POST("/logout-all", h.logoutAll, authMW)
+
+	// swagger:operation GET /.well-known/jwks.json auth authJWKS
+	// ---
+	// summary: Returns the public keys to verify the access tokens, for downstream services
+	// security: []
+	// responses:
+	//   "200":
+	//     description: JSON Web Key Set
+	//     schema:
+	//       "$ref": "#/definitions/JWKS"
+	e.GET("/.well-known/jwks.json", h.jwks)
+
+	// swagger:operation POST /forgot-password auth authForgotPassword
+	// ---
+	// summary: Sends password reset link to the given email address
+	// description: The response is the same whether or not an account exists for the email address.
+	// security: []
+	// parameters:
+	// - name: request
+	//   in: body
+	//   description: Request body
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/ForgotPasswordData"
+	// responses:
+	//   "200":
+	//     "$ref": "#/responses/ok"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	e.POST("/forgot-password", h.forgotPassword)
+
+	// swagger:operation POST /reset-password auth authResetPassword
+	// ---
+	// summary: Resets password by the token sent to the user's email, logs out all sessions
+	// security: []
+	// parameters:
+	// - name: request
+	//   in: body
+	//   description: Request body
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/ResetPasswordData"
+	// responses:
+	//   "200":
+	//     "$ref": "#/responses/ok"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	e.POST("/reset-password", h.resetPassword)
+
+	// swagger:operation POST /register auth authRegister
+	// ---
+	// summary: Signs up new user account, the verification link is sent to the given email address
+	// description: The user may not login until the email address is verified. Only available if the registration is enabled.
+	// security: []
+	// parameters:
+	// - name: request
+	//   in: body
+	//   description: Request body
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/RegisterData"
+	// responses:
+	//   "200":
+	//     description: The created user
+	//     schema:
+	//       "$ref": "#/definitions/User"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "403":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	e.POST("/register", h.register)
+
+	// swagger:operation POST /verify-email auth authVerifyEmail
+	// ---
+	// summary: Verifies email address by the token sent to the user's email
+	// security: []
+	// parameters:
+	// - name: request
+	//   in: body
+	//   description: Request body
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/VerifyEmailData"
+	// responses:
+	//   "200":
+	//     "$ref": "#/responses/ok"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	e.POST("/verify-email", h.verifyEmail)
+
+	// swagger:operation POST /resend-verification auth authResendVerification
+	// ---
+	// summary: Resends the verification link to the given email address
+	// description: The response is the same whether or not an unverified account exists for the email address, the links are throttled silently.
+	// security: []
+	// parameters:
+	// - name: request
+	//   in: body
+	//   description: Request body
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/ResendVerificationData"
+	// responses:
+	//   "200":
+	//     "$ref": "#/responses/ok"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	e.POST("/resend-verification", h.resendVerification)
+
+	mfa := e.Group("/v1/users/me/mfa", authMW)
+
+	// swagger:operation POST /v1/users/me/mfa auth authEnrollMFA
+	// ---
+	// summary: Starts the TOTP enrollment of the authenticated user
+	// responses:
+	//   "200":
+	//     description: TOTP secret and its URI for QR code
+	//     schema:
+	//       "$ref": "#/definitions/MFAEnrollment"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	mfa.POST("", h.enrollMFA)
+
+	// swagger:operation POST /v1/users/me/mfa/confirm auth authConfirmMFA
+	// ---
+	// summary: Confirms the TOTP enrollment of the authenticated user
+	// parameters:
+	// - name: request
+	//   in: body
+	//   description: Request body
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/MFACodeData"
+	// responses:
+	//   "200":
+	//     description: Recovery codes, they are shown only once
+	//     schema:
+	//       "$ref": "#/definitions/RecoveryCodesResp"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	mfa.POST("/confirm", h.confirmMFA)
+
+	// swagger:operation POST /v1/users/me/mfa/recovery-codes auth authRegenerateRecoveryCodes
+	// ---
+	// summary: Replaces the recovery codes of the authenticated user
+	// parameters:
+	// - name: request
+	//   in: body
+	//   description: Request body
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/MFACodeData"
+	// responses:
+	//   "200":
+	//     description: Recovery codes, they are shown only once
+	//     schema:
+	//       "$ref": "#/definitions/RecoveryCodesResp"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	mfa.POST("/recovery-codes", h.regenerateRecoveryCodes)
+
+	// swagger:operation DELETE /v1/users/me/mfa auth authDisableMFA
+	// ---
+	// summary: Disables the TOTP of the authenticated user, unless it is required for the user role
+	// parameters:
+	// - name: request
+	//   in: body
+	//   description: Request body
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/MFACodeData"
+	// responses:
+	//   "200":
+	//     "$ref": "#/responses/ok"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "403":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	mfa.DELETE("", h.disableMFA)
 }
 
 // Credentials represents login request data
@@ -81,6 +439,96 @@ type RefreshTokenData struct {
 	RefreshToken string `json:"refresh_token" validate:"required"`
 }
 
+// ForgotPasswordData represents forgot password request data
+// swagger:model
+type ForgotPasswordData struct {
+	// example: superadmin@ghoul.com
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ResetPasswordData represents reset password request data
+// swagger:model
+type ResetPasswordData struct {
+	// The token given in the password reset link
+	Token              string `json:"token" validate:"required"`
+	NewPassword        string `json:"new_password" validate:"required,min=8"`
+	NewPasswordConfirm string `json:"new_password_confirm" validate:"required,eqfield=NewPassword"`
+}
+
+// RegisterData represents signup request data
+// swagger:model
+type RegisterData struct {
+	Username  string `json:"username" validate:"required,min=3"`
+	Password  string `json:"password" validate:"required,min=8"`
+	FirstName string `json:"first_name" validate:"required"`
+	LastName  string `json:"last_name" validate:"required"`
+	Email     string `json:"email" validate:"required,email"`
+	Mobile    string `json:"mobile" validate:"omitempty,mobile"`
+}
+
+// VerifyEmailData represents email verification request data
+// swagger:model
+type VerifyEmailData struct {
+	// The token given in the verification link
+	Token string `json:"token" validate:"required"`
+}
+
+// ResendVerificationData represents verification email resending request data
+// swagger:model
+type ResendVerificationData struct {
+	// example: superadmin@ghoul.com
+	Email string `json:"email" validate:"required,email"`
+}
+
+// MFALoginData represents the second step login request data
+// swagger:model
+type MFALoginData struct {
+	// The `mfa_token` given by `/login`
+	MFAToken string `json:"mfa_token" validate:"required"`
+	// TOTP code or recovery code
+	// example: 123456
+	Code string `json:"code" validate:"required"`
+}
+
+// MFAEnrollData represents the enrollment on login request data
+// swagger:model
+type MFAEnrollData struct {
+	// The `mfa_token` given by `/login`
+	MFAToken string `json:"mfa_token" validate:"required"`
+}
+
+// MFACodeData represents the request data verified by the second factor
+// swagger:model
+type MFACodeData struct {
+	// TOTP code, or recovery code if the TOTP is enabled
+	// example: 123456
+	Code string `json:"code" validate:"required"`
+}
+
+// MFAEnrollment contains the TOTP secret to add into authenticator apps
+// swagger:model
+type MFAEnrollment struct {
+	// Base32 encoded secret, for manual entry
+	Secret string `json:"secret"`
+	// otpauth:// URI, to be rendered as QR code
+	URI string `json:"uri"`
+}
+
+// RecoveryCodesResp contains the MFA recovery codes
+// swagger:model
+type RecoveryCodesResp struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// OAuthCallbackData represents the OpenID Connect login callback request data
+// swagger:model
+type OAuthCallbackData struct {
+	// The authorization code given back by the provider
+	Code string `json:"code" validate:"required"`
+	// The state given back by the provider
+	State string `json:"state" validate:"required"`
+}
+
 func (h *HTTP) login(c echo.Context) error {
 	r := Credentials{}
 	if err := c.Bind(&r); err != nil {
@@ -106,3 +554,186 @@ func (h *HTTP) refreshToken(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, resp)
 }
+
+func (h *HTTP) logout(c echo.Context) error {
+	if err := h.svc.Logout(c); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *HTTP) logoutAll(c echo.Context) error {
+	if err := h.svc.LogoutAll(c); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *HTTP) jwks(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, h.svc.JWKS())
+}
+
+func (h *HTTP) forgotPassword(c echo.Context) error {
+	r := ForgotPasswordData{}
+	if err := c.Bind(&r); err != nil {
+		return err
+	}
+	if err := h.svc.ForgotPassword(c, r); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *HTTP) resetPassword(c echo.Context) error {
+	r := ResetPasswordData{}
+	if err := c.Bind(&r); err != nil {
+		return err
+	}
+	if err := h.svc.ResetPassword(c, r); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *HTTP) register(c echo.Context) error {
+	r := RegisterData{}
+	if err := c.Bind(&r); err != nil {
+		return err
+	}
+	r.Username = strings.TrimSpace(r.Username)
+	r.Email = strings.TrimSpace(r.Email)
+	r.FirstName = strings.TrimSpace(r.FirstName)
+	r.LastName = strings.TrimSpace(r.LastName)
+	r.Mobile = strings.TrimSpace(strings.Replace(r.Mobile, " ", "", -1))
+
+	resp, err := h.svc.Register(c, r)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (h *HTTP) verifyEmail(c echo.Context) error {
+	r := VerifyEmailData{}
+	if err := c.Bind(&r); err != nil {
+		return err
+	}
+	if err := h.svc.VerifyEmail(c, r); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *HTTP) resendVerification(c echo.Context) error {
+	r := ResendVerificationData{}
+	if err := c.Bind(&r); err != nil {
+		return err
+	}
+	if err := h.svc.ResendVerification(c, r); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *HTTP) loginMFA(c echo.Context) error {
+	r := MFALoginData{}
+	if err := c.Bind(&r); err != nil {
+		return err
+	}
+	resp, err := h.svc.LoginMFA(c, r)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (h *HTTP) enrollMFAOnLogin(c echo.Context) error {
+	r := MFAEnrollData{}
+	if err := c.Bind(&r); err != nil {
+		return err
+	}
+	resp, err := h.svc.EnrollMFAOnLogin(c, r)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (h *HTTP) enrollMFA(c echo.Context) error {
+	resp, err := h.svc.EnrollMFA(c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (h *HTTP) confirmMFA(c echo.Context) error {
+	r := MFACodeData{}
+	if err := c.Bind(&r); err != nil {
+		return err
+	}
+	resp, err := h.svc.ConfirmMFA(c, r)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (h *HTTP) regenerateRecoveryCodes(c echo.Context) error {
+	r := MFACodeData{}
+	if err := c.Bind(&r); err != nil {
+		return err
+	}
+	resp, err := h.svc.RegenerateRecoveryCodes(c, r)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (h *HTTP) disableMFA(c echo.Context) error {
+	r := MFACodeData{}
+	if err := c.Bind(&r); err != nil {
+		return err
+	}
+	if err := h.svc.DisableMFA(c, r); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *HTTP) oauthAuthorize(c echo.Context) error {
+	authURL, err := h.svc.OAuthAuthorize(c, c.Param("provider"))
+	if err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusFound, authURL)
+}
+
+func (h *HTTP) oauthCallback(c echo.Context) error {
+	r := OAuthCallbackData{}
+	if err := c.Bind(&r); err != nil {
+		return err
+	}
+	resp, err := h.svc.OAuthLogin(c, c.Param("provider"), r)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
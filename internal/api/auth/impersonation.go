@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/M15t/ghoul/internal/model"
+	"github.com/M15t/ghoul/pkg/server"
+	"github.com/M15t/ghoul/pkg/server/middleware/jwt"
+
+	jwtgo "github.com/golang-jwt/jwt/v5"
+)
+
+// defaultImpersonationDuration is the lifetime of impersonation tokens if not configured
+const defaultImpersonationDuration = 15 * time.Minute
+
+// Impersonate issues a short-lived access token of the given user, acted by the actor.
+// There is no session nor refresh token, the actor has to impersonate again once the token expires.
+// Permission checks are up to the caller.
+func (s *Auth) Impersonate(actor *model.AuthUser, u *model.User) (*model.AuthToken, error) {
+	duration := s.cfg.ImpersonationDuration
+	if duration <= 0 {
+		duration = defaultImpersonationDuration
+	}
+	expiresAt := time.Now().Add(duration)
+
+	claims := &jwt.Claims{
+		RegisteredClaims: jwtgo.RegisteredClaims{Subject: strconv.Itoa(u.ID)},
+		Username:         u.Username,
+		Email:            u.Email,
+		Role:             u.Role,
+		Actor:            &jwt.Actor{Subject: strconv.Itoa(actor.ID), Username: actor.Username},
+	}
+	token, expiresin, err := s.jwt.GenerateToken(claims, &expiresAt)
+	if err != nil {
+		return nil, server.NewHTTPInternalError("Error generating token").SetInternal(err)
+	}
+
+	s.logger.LogAttrs(context.Background(), slog.LevelWarn, "user impersonated",
+		slog.String("event", "auth.impersonate"),
+		slog.Int("actor_id", actor.ID),
+		slog.String("actor_username", actor.Username),
+		slog.Int("user_id", u.ID),
+		slog.String("username", u.Username),
+		slog.Time("expires_at", expiresAt),
+	)
+
+	return &model.AuthToken{AccessToken: token, TokenType: "bearer", ExpiresIn: expiresin}, nil
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/M15t/ghoul/internal/model"
+	"github.com/M15t/ghoul/pkg/server"
+	dbutil "github.com/M15t/ghoul/pkg/util/db"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// maxLockoutDuration caps the exponential backoff of the account lockout & the IP throttling
+const maxLockoutDuration = 24 * time.Hour
+
+// checkIPThrottle rejects the login attempts from an IP address which has failed too many times recently.
+// Once throttled, the IP address is rejected for `LoginIPWindow` after its last failure, doubled on every further failure
+// within `maxLockoutDuration`, see lockoutDuration
+func (s *Auth) checkIPThrottle(c echo.Context) error {
+	if s.cfg.LoginIPMaxFailures <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	count, err := s.fdb.CountSince(s.db, c.RealIP(), now.Add(-s.cfg.LoginIPWindow))
+	if err != nil {
+		return server.NewHTTPInternalError("Error counting failed logins").SetInternal(err)
+	}
+	if count >= int64(s.cfg.LoginIPMaxFailures) {
+		return ErrTooManyRequests
+	}
+
+	// backoff of the failures after the first throttling
+	count, err = s.fdb.CountSince(s.db, c.RealIP(), now.Add(-maxLockoutDuration))
+	if err != nil {
+		return server.NewHTTPInternalError("Error counting failed logins").SetInternal(err)
+	}
+	if count <= int64(s.cfg.LoginIPMaxFailures) {
+		return nil
+	}
+	last, err := s.fdb.LastAt(s.db, c.RealIP())
+	if err != nil {
+		return server.NewHTTPInternalError("Error reading failed logins").SetInternal(err)
+	}
+	if now.Before(last.Add(lockoutDuration(int(count), s.cfg.LoginIPMaxFailures, s.cfg.LoginIPWindow))) {
+		return ErrTooManyRequests
+	}
+
+	return nil
+}
+
+// recordLoginFailure records the failed login attempt of the IP address, purging the expired ones.
+// The attempts are kept for `maxLockoutDuration`, the longest backoff of the IP throttling
+func (s *Auth) recordLoginFailure(c echo.Context, username string) error {
+	if s.cfg.LoginIPMaxFailures <= 0 {
+		return nil
+	}
+
+	if err := s.fdb.Create(s.db, &model.LoginFailure{IP: c.RealIP(), Username: truncate(username, 255)}); err != nil {
+		return server.NewHTTPInternalError("Error recording failed login").SetInternal(err)
+	}
+	if err := s.fdb.Purge(s.db, time.Now().Add(-maxLockoutDuration)); err != nil {
+		return server.NewHTTPInternalError("Error purging failed logins").SetInternal(err)
+	}
+
+	return nil
+}
+
+// loginFailed counts the failed login attempt of the user, locks the account once the limit is reached.
+// Returns the error to respond.
+func (s *Auth) loginFailed(c echo.Context, u *model.User) error {
+	if err := s.recordLoginFailure(c, u.Username); err != nil {
+		return err
+	}
+	if s.cfg.LoginMaxFailures <= 0 {
+		return ErrInvalidCredentials
+	}
+
+	var lockout time.Duration
+	if err := dbutil.Transaction(s.db, func(tx *gorm.DB) error {
+		if err := s.udb.Update(tx, map[string]interface{}{"failed_login_count": gorm.Expr("failed_login_count + 1")}, u.ID); err != nil {
+			return err
+		}
+		// re-read the counter, the row is locked by the update until the commit, so the concurrent failures are counted in turn
+		stored := new(model.User)
+		if err := s.udb.View(tx.Select("id", "failed_login_count", "locked_until"), stored, u.ID); err != nil {
+			return err
+		}
+		u.FailedLoginCount = stored.FailedLoginCount
+		u.LockedUntil = stored.LockedUntil
+
+		lockout = lockoutDuration(u.FailedLoginCount, s.cfg.LoginMaxFailures, s.cfg.LoginLockoutDuration)
+		if lockout == 0 {
+			return nil
+		}
+		lockedUntil := time.Now().Add(lockout)
+		u.LockedUntil = &lockedUntil
+		return s.udb.Update(tx, map[string]interface{}{"locked_until": lockedUntil}, u.ID)
+	}); err != nil {
+		return server.NewHTTPInternalError("Error updating failed logins").SetInternal(err)
+	}
+
+	if lockout == 0 {
+		return ErrInvalidCredentials
+	}
+
+	s.logger.LogAttrs(c.Request().Context(), slog.LevelWarn, "account locked out",
+		slog.String("event", "auth.lockout"),
+		slog.Int("user_id", u.ID),
+		slog.String("username", u.Username),
+		slog.String("ip", c.RealIP()),
+		slog.Int("failed_login_count", u.FailedLoginCount),
+		slog.Time("locked_until", *u.LockedUntil),
+	)
+
+	return ErrAccountLocked
+}
+
+// resetLoginFailures resets the failed login counter of the user on successful password check
+func (s *Auth) resetLoginFailures(u *model.User) error {
+	if u.FailedLoginCount == 0 && u.LockedUntil == nil {
+		return nil
+	}
+
+	if err := s.udb.Update(s.db, map[string]interface{}{"failed_login_count": 0, "locked_until": nil}, u.ID); err != nil {
+		return server.NewHTTPInternalError("Error resetting failed logins").SetInternal(err)
+	}
+	u.FailedLoginCount = 0
+	u.LockedUntil = nil
+
+	return nil
+}
+
+// lockoutDuration returns the lockout duration after the given consecutive failures:
+// zero below the limit, then `base` doubled on every further failure, capped at `maxLockoutDuration`
+func lockoutDuration(failures, limit int, base time.Duration) time.Duration {
+	if failures < limit {
+		return 0
+	}
+
+	d := base
+	for i := limit; i < failures && d < maxLockoutDuration; i++ {
+		d *= 2
+	}
+	if d > maxLockoutDuration {
+		d = maxLockoutDuration
+	}
+	return d
+}
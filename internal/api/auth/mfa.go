@@ -0,0 +1,325 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"github.com/M15t/ghoul/internal/model"
+	"github.com/M15t/ghoul/pkg/server"
+	dbutil "github.com/M15t/ghoul/pkg/util/db"
+	"github.com/M15t/ghoul/pkg/util/totp"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// MFA settings
+const (
+	mfaChallengeDuration    = 5 * time.Minute
+	mfaChallengeMaxAttempts = 5
+	recoveryCodesCount      = 10
+)
+
+// LoginMFA exchanges the MFA token given by `Authenticate` and the TOTP (or recovery) code for the access token.
+// If the user has not enrolled yet, the code confirms the enrollment started by `EnrollMFAOnLogin`,
+// the recovery codes are then returned along with the access token.
+func (s *Auth) LoginMFA(c echo.Context, data MFALoginData) (*model.AuthToken, error) {
+	tok, usr, err := s.findMFAChallenge(data.MFAToken)
+	if err != nil {
+		return nil, err
+	}
+	if usr.MFASecret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+
+	var ok bool
+	if usr.MFAEnabled {
+		ok, err = s.verifySecondFactor(usr, data.Code)
+	} else {
+		ok, err = s.verifyTOTP(usr, data.Code)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if err := s.tdb.IncrAttempts(s.db, tok); err != nil {
+			return nil, server.NewHTTPInternalError("Error updating MFA token").SetInternal(err)
+		}
+		return nil, ErrInvalidMFACode
+	}
+
+	if consumed, err := s.tdb.Consume(s.db, tok); err != nil || !consumed {
+		return nil, ErrInvalidMFAToken.SetInternal(err)
+	}
+
+	var codes []string
+	if !usr.MFAEnabled {
+		if codes, err = s.enableMFA(usr); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := s.LoginUser(c, usr)
+	if err != nil {
+		return nil, err
+	}
+	resp.RecoveryCodes = codes
+
+	return resp, nil
+}
+
+// EnrollMFAOnLogin starts the TOTP enrollment of the user who is required to use MFA but has not enrolled yet.
+// Confirm it by `LoginMFA` with the same MFA token.
+func (s *Auth) EnrollMFAOnLogin(c echo.Context, data MFAEnrollData) (*MFAEnrollment, error) {
+	_, usr, err := s.findMFAChallenge(data.MFAToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.startEnrollment(usr)
+}
+
+// EnrollMFA starts the TOTP enrollment of the authenticated user, confirm it by `ConfirmMFA`
+func (s *Auth) EnrollMFA(c echo.Context) (*MFAEnrollment, error) {
+	usr, err := s.authUser(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.startEnrollment(usr)
+}
+
+// ConfirmMFA enables the TOTP of the authenticated user once the code generated by the enrolled secret is verified.
+// Returns the recovery codes, they are shown only once.
+func (s *Auth) ConfirmMFA(c echo.Context, data MFACodeData) (*RecoveryCodesResp, error) {
+	usr, err := s.authUser(c)
+	if err != nil {
+		return nil, err
+	}
+	if usr.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if usr.MFASecret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+
+	ok, err := s.verifyTOTP(usr, data.Code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, err := s.enableMFA(usr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RecoveryCodesResp{RecoveryCodes: codes}, nil
+}
+
+// DisableMFA disables the TOTP of the authenticated user, unless it is required for the user role
+func (s *Auth) DisableMFA(c echo.Context, data MFACodeData) error {
+	usr, err := s.authUser(c)
+	if err != nil {
+		return err
+	}
+	if s.mfaRequired(usr.Role) {
+		return ErrMFARequired
+	}
+	if !usr.MFAEnabled {
+		return ErrMFANotEnrolled
+	}
+
+	ok, err := s.verifySecondFactor(usr, data.Code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidMFACode
+	}
+
+	if err := dbutil.Transaction(s.db, func(tx *gorm.DB) error {
+		if err := s.udb.Update(tx, map[string]interface{}{"mfa_enabled": false, "mfa_secret": "", "mfa_last_counter": 0}, usr.ID); err != nil {
+			return err
+		}
+		return s.rdb.Replace(tx, usr.ID, nil)
+	}); err != nil {
+		return server.NewHTTPInternalError("Error disabling MFA").SetInternal(err)
+	}
+
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the authenticated user
+func (s *Auth) RegenerateRecoveryCodes(c echo.Context, data MFACodeData) (*RecoveryCodesResp, error) {
+	usr, err := s.authUser(c)
+	if err != nil {
+		return nil, err
+	}
+	if !usr.MFAEnabled {
+		return nil, ErrMFANotEnrolled
+	}
+
+	ok, err := s.verifySecondFactor(usr, data.Code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := s.newRecoveryCodes()
+	if err != nil {
+		return nil, server.NewHTTPInternalError("Error generating recovery codes").SetInternal(err)
+	}
+	if err := s.rdb.Replace(s.db, usr.ID, hashes); err != nil {
+		return nil, server.NewHTTPInternalError("Error saving recovery codes").SetInternal(err)
+	}
+
+	return &RecoveryCodesResp{RecoveryCodes: codes}, nil
+}
+
+// mfaRequired checks whether the role must login with the second factor
+func (s *Auth) mfaRequired(role string) bool {
+	for _, r := range s.cfg.MFARequiredRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// mfaChallenge issues the short-lived MFA token to be exchanged at `LoginMFA`
+func (s *Auth) mfaChallenge(u *model.User) (*model.AuthToken, error) {
+	token, err := s.issueUserToken(u.ID, model.TokenPurposeMFAChallenge, mfaChallengeDuration)
+	if err != nil {
+		return nil, server.NewHTTPInternalError("Error creating MFA token").SetInternal(err)
+	}
+
+	return &model.AuthToken{MFAToken: token, MFAEnrollRequired: !u.MFAEnabled}, nil
+}
+
+// findMFAChallenge returns the valid MFA challenge and its user
+func (s *Auth) findMFAChallenge(token string) (*model.UserToken, *model.User, error) {
+	tok, err := s.tdb.FindValid(s.db, model.TokenPurposeMFAChallenge, s.cr.HashToken(token))
+	if err != nil {
+		return nil, nil, ErrInvalidMFAToken.SetInternal(err)
+	}
+	if tok.Attempts >= mfaChallengeMaxAttempts {
+		return nil, nil, ErrInvalidMFAToken
+	}
+
+	usr := new(model.User)
+	if err := s.udb.View(s.db, usr, tok.UserID); err != nil {
+		return nil, nil, ErrInvalidMFAToken.SetInternal(err)
+	}
+	if usr.Blocked {
+		return nil, nil, ErrUserBlocked
+	}
+
+	return tok, usr, nil
+}
+
+// authUser returns the record of the authenticated user.
+// The second factor may not be managed by an impersonator.
+func (s *Auth) authUser(c echo.Context) (*model.User, error) {
+	authUsr := s.User(c)
+	if authUsr.Actor != nil {
+		return nil, ErrImpersonating
+	}
+	usr := new(model.User)
+	if err := s.udb.View(s.db, usr, authUsr.ID); err != nil {
+		return nil, ErrUserNotFound.SetInternal(err)
+	}
+	return usr, nil
+}
+
+// startEnrollment generates and stores a new TOTP secret for the user, pending confirmation
+func (s *Auth) startEnrollment(u *model.User) (*MFAEnrollment, error) {
+	if u.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, server.NewHTTPInternalError("Error generating MFA secret").SetInternal(err)
+	}
+	if err := s.udb.Update(s.db, map[string]interface{}{"mfa_secret": secret, "mfa_last_counter": 0}, u.ID); err != nil {
+		return nil, server.NewHTTPInternalError("Error saving MFA secret").SetInternal(err)
+	}
+
+	return &MFAEnrollment{Secret: secret, URI: totp.URI(s.cfg.MFAIssuer, u.Username, secret)}, nil
+}
+
+// enableMFA enables the TOTP of the user and generates its recovery codes
+func (s *Auth) enableMFA(u *model.User) ([]string, error) {
+	codes, hashes, err := s.newRecoveryCodes()
+	if err != nil {
+		return nil, server.NewHTTPInternalError("Error generating recovery codes").SetInternal(err)
+	}
+
+	if err := dbutil.Transaction(s.db, func(tx *gorm.DB) error {
+		if err := s.udb.Update(tx, map[string]interface{}{"mfa_enabled": true}, u.ID); err != nil {
+			return err
+		}
+		return s.rdb.Replace(tx, u.ID, hashes)
+	}); err != nil {
+		return nil, server.NewHTTPInternalError("Error enabling MFA").SetInternal(err)
+	}
+	u.MFAEnabled = true
+
+	return codes, nil
+}
+
+// verifyTOTP validates the TOTP code of the user, a code can only be used once
+func (s *Auth) verifyTOTP(u *model.User, code string) (bool, error) {
+	counter, ok := totp.Validate(code, u.MFASecret, time.Now())
+	if !ok || counter <= u.MFALastCounter {
+		return false, nil
+	}
+
+	if err := s.udb.Update(s.db, map[string]interface{}{"mfa_last_counter": counter}, u.ID); err != nil {
+		return false, server.NewHTTPInternalError("Error updating MFA counter").SetInternal(err)
+	}
+	u.MFALastCounter = counter
+
+	return true, nil
+}
+
+// verifySecondFactor validates either the TOTP code or an unused recovery code of the user
+func (s *Auth) verifySecondFactor(u *model.User, code string) (bool, error) {
+	if ok, err := s.verifyTOTP(u, code); err != nil || ok {
+		return ok, err
+	}
+
+	consumed, err := s.rdb.Consume(s.db, u.ID, s.cr.HashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, server.NewHTTPInternalError("Error consuming recovery code").SetInternal(err)
+	}
+	return consumed, nil
+}
+
+// newRecoveryCodes generates the recovery codes in `xxxxx-xxxxx` format, returns them and their hashes
+func (s *Auth) newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodesCount)
+	hashes := make([]string, 0, recoveryCodesCount)
+	b := make([]byte, 10)
+	for i := 0; i < recoveryCodesCount; i++ {
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:10]
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, s.cr.HashToken(raw))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode removes the separators & spaces from the recovery code given by user
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/M15t/ghoul/internal/model"
+	"github.com/M15t/ghoul/pkg/server"
+	dbutil "github.com/M15t/ghoul/pkg/util/db"
+	"github.com/M15t/ghoul/pkg/util/oidc"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// oauthStateDuration is the time given to the user to login at the provider
+const oauthStateDuration = 10 * time.Minute
+
+// usernameInvalidChars are removed from the usernames derived from email addresses
+var usernameInvalidChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// OAuthAuthorize starts the OpenID Connect login with the given provider, returns the URL of the provider consent page.
+// The state, nonce & PKCE code verifier are kept until the provider redirects back.
+func (s *Auth) OAuthAuthorize(c echo.Context, provider string) (string, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return "", ErrOAuthProviderNotFound
+	}
+
+	state, nonce, verifier := oidc.RandomString(), oidc.RandomString(), oidc.RandomString()
+	authURL, err := p.AuthCodeURL(c.Request().Context(), state, nonce, verifier)
+	if err != nil {
+		return "", server.NewHTTPInternalError("Error discovering login provider").SetInternal(err)
+	}
+
+	if err := s.odb.Purge(s.db, time.Now()); err != nil {
+		return "", server.NewHTTPInternalError("Error purging login states").SetInternal(err)
+	}
+	if err := s.odb.Create(s.db, &model.OAuthState{
+		Provider:     provider,
+		StateHash:    s.cr.HashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oauthStateDuration),
+	}); err != nil {
+		return "", server.NewHTTPInternalError("Error creating login state").SetInternal(err)
+	}
+
+	return authURL, nil
+}
+
+// OAuthLogin completes the OpenID Connect login by the authorization code given back by the provider.
+// The external identity is linked to the user of the same email address if the provider has verified it,
+// or to a new user if the registration is enabled.
+func (s *Auth) OAuthLogin(c echo.Context, provider string, data OAuthCallbackData) (*model.AuthToken, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return nil, ErrOAuthProviderNotFound
+	}
+
+	state, err := s.odb.Consume(s.db, s.cr.HashToken(data.State))
+	if err != nil || state.Provider != provider {
+		return nil, ErrInvalidOAuthState.SetInternal(err)
+	}
+
+	ctx := c.Request().Context()
+	tok, err := p.Exchange(ctx, data.Code, state.CodeVerifier)
+	if err != nil {
+		return nil, ErrOAuthFailed.SetInternal(err)
+	}
+	idt, err := p.VerifyIDToken(ctx, tok.IDToken, state.Nonce)
+	if err != nil {
+		return nil, ErrOAuthFailed.SetInternal(err)
+	}
+
+	usr, err := s.oauthUser(provider, idt)
+	if err != nil {
+		return nil, err
+	}
+	if usr.Blocked {
+		return nil, ErrUserBlocked
+	}
+	if usr.MFAEnabled || s.mfaRequired(usr.Role) {
+		return s.mfaChallenge(usr)
+	}
+
+	return s.LoginUser(c, usr)
+}
+
+// oauthUser returns the user linked to the external identity, linking or creating one if needed
+func (s *Auth) oauthUser(provider string, idt *oidc.IDToken) (*model.User, error) {
+	now := time.Now()
+	identity, err := s.idb.FindBySubject(s.db, provider, idt.Subject)
+	if err == nil {
+		usr := new(model.User)
+		if err := s.udb.View(s.db, usr, identity.UserID); err != nil {
+			return nil, ErrOAuthAccountNotFound.SetInternal(err)
+		}
+		if err := s.idb.Update(s.db, map[string]interface{}{"email": idt.Email, "last_login_at": now}, identity.ID); err != nil {
+			return nil, server.NewHTTPInternalError("Error updating identity").SetInternal(err)
+		}
+		return usr, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, server.NewHTTPInternalError("Error finding identity").SetInternal(err)
+	}
+
+	// linking by email address is only safe if the provider has verified it
+	if idt.Email == "" || !idt.EmailVerified {
+		return nil, ErrOAuthEmailNotVerified
+	}
+
+	// including the deleted users, whose email address may not be registered again until they are purged
+	usr := new(model.User)
+	if err := s.udb.View(dbutil.WithDeleted(s.db), usr, map[string]interface{}{"email": idt.Email}); err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, server.NewHTTPInternalError("Error finding user").SetInternal(err)
+		}
+		usr = nil
+	}
+	if usr != nil && usr.DeletedAt.Valid {
+		return nil, ErrAccountDeleted
+	}
+	// an unverified local account may have been registered by someone else, who knows its password
+	if usr != nil && usr.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+	if usr != nil && usr.ServiceAccount {
+		return nil, ErrServiceAccount
+	}
+	if usr == nil && !s.cfg.RegistrationEnabled {
+		return nil, ErrOAuthAccountNotFound
+	}
+
+	if err := dbutil.Transaction(s.db, func(tx *gorm.DB) error {
+		if usr == nil {
+			var err error
+			if usr, err = s.newOAuthUser(tx, idt); err != nil {
+				return err
+			}
+		}
+		return s.idb.Create(tx, &model.UserIdentity{
+			UserID:      usr.ID,
+			Provider:    provider,
+			Subject:     idt.Subject,
+			Email:       idt.Email,
+			LastLoginAt: &now,
+		})
+	}); err != nil {
+		return nil, server.NewHTTPInternalError("Error linking identity").SetInternal(err)
+	}
+
+	return usr, nil
+}
+
+// newOAuthUser creates a verified user with the user role from the ID token claims.
+// The password is random, the user may set one by the password reset.
+func (s *Auth) newOAuthUser(tx *gorm.DB, idt *oidc.IDToken) (*model.User, error) {
+	username, err := s.availableUsername(tx, idt.Email)
+	if err != nil {
+		return nil, err
+	}
+	hashedPwd, err := s.cr.HashPassword(s.cr.UID())
+	if err != nil {
+		return nil, err
+	}
+
+	firstName, lastName := idt.GivenName, idt.FamilyName
+	if firstName == "" && lastName == "" {
+		firstName, lastName, _ = strings.Cut(idt.Name, " ")
+	}
+	now := time.Now()
+	rec := &model.User{
+		FirstName:       firstName,
+		LastName:        lastName,
+		Email:           idt.Email,
+		Username:        username,
+		Password:        hashedPwd,
+		EmailVerifiedAt: &now,
+		Role:            model.RoleUser,
+	}
+	if err := s.udb.Create(tx, rec); err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+// availableUsername derives an unused username from the email address, adding a random suffix if taken
+func (s *Auth) availableUsername(tx *gorm.DB, email string) (string, error) {
+	local, _, _ := strings.Cut(strings.ToLower(email), "@")
+	base := truncate(usernameInvalidChars.ReplaceAllString(local, ""), 50)
+	if len(base) < 3 {
+		base = "user"
+	}
+
+	username := base
+	for i := 0; i < 5; i++ {
+		existed, err := s.udb.Exist(dbutil.WithDeleted(tx), map[string]interface{}{"username": username})
+		if err != nil {
+			return "", err
+		}
+		if !existed {
+			return username, nil
+		}
+		username = base + "-" + strings.ToLower(s.cr.UID()[:6])
+	}
+
+	return "", errors.New("no available username")
+}
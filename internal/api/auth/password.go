@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"errors"
+	"log/slog"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/M15t/ghoul/internal/model"
+	"github.com/M15t/ghoul/pkg/server"
+	"github.com/M15t/ghoul/pkg/server/middleware/slogger"
+	dbutil "github.com/M15t/ghoul/pkg/util/db"
+	"github.com/M15t/ghoul/pkg/util/email"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// ForgotPassword emails a password reset link to the user of the given email address.
+// No error is returned if there is no such user, so the response does not leak whether an account exists.
+func (s *Auth) ForgotPassword(c echo.Context, data ForgotPasswordData) error {
+	usr := new(model.User)
+	if err := s.udb.View(s.db, usr, map[string]interface{}{"email": data.Email}); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return server.NewHTTPInternalError("Error finding user").SetInternal(err)
+	}
+	if usr.Blocked || usr.ServiceAccount {
+		return nil
+	}
+
+	token, err := s.issueUserToken(usr.ID, model.TokenPurposeResetPassword, s.cfg.ResetPasswordDuration)
+	if err != nil {
+		return server.NewHTTPInternalError("Error creating reset token").SetInternal(err)
+	}
+
+	if err := s.sendEmail(usr.Email, "Reset your password", "reset_password", map[string]interface{}{
+		"Name":      usr.FirstName,
+		"Username":  usr.Username,
+		"Link":      s.webLink("/reset-password", token),
+		"ExpiresIn": s.cfg.ResetPasswordDuration.String(),
+	}); err != nil {
+		// do not fail the request, it would leak that the account exists
+		slogger.AddCustomAttributes(c, slog.String("email_error", err.Error()))
+	}
+
+	return nil
+}
+
+// ResetPassword sets the new password of the user owning the given reset token.
+// The token can only be used once, all sessions of the user are revoked afterwards.
+func (s *Auth) ResetPassword(c echo.Context, data ResetPasswordData) error {
+	tok, err := s.tdb.FindValid(s.db, model.TokenPurposeResetPassword, s.cr.HashToken(data.Token))
+	if err != nil {
+		return ErrInvalidResetToken.SetInternal(err)
+	}
+
+	usr := new(model.User)
+	if err := s.udb.View(s.db, usr, tok.UserID); err != nil {
+		return ErrInvalidResetToken.SetInternal(err)
+	}
+	if err := s.ValidatePassword(usr, data.NewPassword); err != nil {
+		return err
+	}
+	hashedPwd, err := s.cr.HashPassword(data.NewPassword)
+	if err != nil {
+		return server.NewHTTPInternalError("Error hashing password").SetInternal(err)
+	}
+
+	if err := dbutil.Transaction(s.db, func(tx *gorm.DB) error {
+		consumed, err := s.tdb.Consume(tx, tok)
+		if err != nil {
+			return server.NewHTTPInternalError("Error consuming reset token").SetInternal(err)
+		}
+		if !consumed {
+			return ErrInvalidResetToken
+		}
+		// the owner of the email address can unlock the account
+		if err := s.udb.Update(tx, map[string]interface{}{
+			"password":           hashedPwd,
+			"failed_login_count": 0,
+			"locked_until":       nil,
+		}, tok.UserID); err != nil {
+			return server.NewHTTPInternalError("Error updating password").SetInternal(err)
+		}
+		return s.RecordPassword(tx, tok.UserID, hashedPwd)
+	}); err != nil {
+		return err
+	}
+
+	return s.RevokeUserSessions(tok.UserID)
+}
+
+// ValidatePassword checks the password against the policy, and against the recent passwords if the user exists
+func (s *Auth) ValidatePassword(u *model.User, password string) error {
+	if err := s.cfg.PasswordPolicy.Validate(password, u.Username, u.Email, u.FirstName, u.LastName); err != nil {
+		return server.NewHTTPValidationError(err.Error())
+	}
+	if u.ID == 0 || s.cfg.PasswordPolicy.HistorySize <= 0 {
+		return nil
+	}
+
+	hashes, err := s.hdb.Recent(s.db, u.ID, s.cfg.PasswordPolicy.HistorySize)
+	if err != nil {
+		return server.NewHTTPInternalError("Error checking password history").SetInternal(err)
+	}
+	// the current password may predate the history
+	if u.Password != "" {
+		hashes = append(hashes, u.Password)
+	}
+	for _, h := range hashes {
+		if s.cr.CompareHashAndPassword(h, password) {
+			return ErrPasswordReused
+		}
+	}
+
+	return nil
+}
+
+// RecordPassword adds the password hash just set for the user into the history, keeping only the recent ones
+func (s *Auth) RecordPassword(db *gorm.DB, uid int, hash string) error {
+	if s.cfg.PasswordPolicy.HistorySize <= 0 {
+		return nil
+	}
+
+	if err := s.hdb.Create(db, &model.PasswordHistory{UserID: uid, Hash: hash}); err != nil {
+		return server.NewHTTPInternalError("Error recording password history").SetInternal(err)
+	}
+	if err := s.hdb.Prune(db, uid, s.cfg.PasswordPolicy.HistorySize); err != nil {
+		return server.NewHTTPInternalError("Error pruning password history").SetInternal(err)
+	}
+
+	return nil
+}
+
+// rehashPassword replaces the password hash of the user if it was created by an outdated algorithm or cost.
+// Failures are only logged, they must not prevent the login.
+func (s *Auth) rehashPassword(c echo.Context, u *model.User, password string) {
+	if !s.cr.NeedsRehash(u.Password) {
+		return
+	}
+
+	hashedPwd, err := s.cr.HashPassword(password)
+	if err == nil {
+		err = s.udb.Update(s.db, map[string]interface{}{"password": hashedPwd}, u.ID)
+	}
+	if err != nil {
+		slogger.AddCustomAttributes(c, slog.String("rehash_error", err.Error()))
+		return
+	}
+	u.Password = hashedPwd
+}
+
+// issueUserToken creates a new single-use token for the user, invalidating the previous ones of the same purpose.
+// Returns the plain token, only its hash is stored.
+func (s *Auth) issueUserToken(uid int, purpose string, duration time.Duration) (string, error) {
+	token := s.cr.UID()
+	err := dbutil.Transaction(s.db, func(tx *gorm.DB) error {
+		if err := s.tdb.Invalidate(tx, uid, purpose); err != nil {
+			return err
+		}
+		return s.tdb.Create(tx, &model.UserToken{
+			UserID:    uid,
+			Purpose:   purpose,
+			TokenHash: s.cr.HashToken(token),
+			ExpiresAt: time.Now().Add(duration),
+		})
+	})
+	return token, err
+}
+
+// webLink returns the link to the given path of the web app, carrying the token
+func (s *Auth) webLink(path, token string) string {
+	return strings.TrimRight(s.cfg.WebURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+// sendEmail renders the html & text versions of the template then sends the email
+func (s *Auth) sendEmail(to, subject, tpl string, data interface{}) error {
+	htmlBody, err := email.ParseFromPathTemplate(filepath.Join(s.cfg.TemplateDir, tpl+".html"), data)
+	if err != nil {
+		return err
+	}
+	textBody, err := email.ParseFromPathTemplate(filepath.Join(s.cfg.TemplateDir, tpl+".txt"), data)
+	if err != nil {
+		return err
+	}
+
+	return s.mail.SendEmail(email.Input{
+		To:       []string{to},
+		Subject:  subject,
+		HTMLBody: htmlBody,
+		TextBody: textBody,
+	})
+}
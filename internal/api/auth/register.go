@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/M15t/ghoul/internal/model"
+	"github.com/M15t/ghoul/pkg/server"
+	"github.com/M15t/ghoul/pkg/server/middleware/slogger"
+	dbutil "github.com/M15t/ghoul/pkg/util/db"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// Limits of verification email resending per user
+const (
+	verifyEmailResendLimit  = 3
+	verifyEmailResendWindow = time.Hour
+)
+
+// Register creates a new unverified user account with the user role, then emails the verification link.
+// The user may not login until the email address is verified.
+func (s *Auth) Register(c echo.Context, data RegisterData) (*model.User, error) {
+	if !s.cfg.RegistrationEnabled {
+		return nil, ErrRegistrationClosed
+	}
+
+	// including the deleted users, which may be restored
+	if existed, err := s.udb.Exist(dbutil.WithDeleted(s.db), map[string]interface{}{"username": data.Username}); err != nil || existed {
+		return nil, ErrUsernameExisted.SetInternal(err)
+	}
+	if existed, err := s.udb.Exist(dbutil.WithDeleted(s.db), map[string]interface{}{"email": data.Email}); err != nil || existed {
+		return nil, ErrEmailExisted.SetInternal(err)
+	}
+
+	rec := &model.User{
+		FirstName: data.FirstName,
+		LastName:  data.LastName,
+		Email:     data.Email,
+		Mobile:    data.Mobile,
+		Username:  data.Username,
+		Role:      model.RoleUser,
+	}
+	if err := s.ValidatePassword(rec, data.Password); err != nil {
+		return nil, err
+	}
+	hashedPwd, err := s.cr.HashPassword(data.Password)
+	if err != nil {
+		return nil, server.NewHTTPInternalError("Error hashing password").SetInternal(err)
+	}
+	rec.Password = hashedPwd
+
+	if err := dbutil.Transaction(s.db, func(tx *gorm.DB) error {
+		if err := s.udb.Create(tx, rec); err != nil {
+			return err
+		}
+		return s.RecordPassword(tx, rec.ID, hashedPwd)
+	}); err != nil {
+		return nil, server.NewHTTPInternalError("Error creating user").SetInternal(err)
+	}
+
+	if err := s.sendVerificationEmail(rec); err != nil {
+		// the account is created anyway, the user can request to resend the email
+		slogger.AddCustomAttributes(c, slog.String("email_error", err.Error()))
+	}
+
+	return rec, nil
+}
+
+// VerifyEmail marks the email address of the user owning the given verification token as verified
+func (s *Auth) VerifyEmail(c echo.Context, data VerifyEmailData) error {
+	tok, err := s.tdb.FindValid(s.db, model.TokenPurposeVerifyEmail, s.cr.HashToken(data.Token))
+	if err != nil {
+		return ErrInvalidVerifyToken.SetInternal(err)
+	}
+
+	return dbutil.Transaction(s.db, func(tx *gorm.DB) error {
+		consumed, err := s.tdb.Consume(tx, tok)
+		if err != nil {
+			return server.NewHTTPInternalError("Error consuming verification token").SetInternal(err)
+		}
+		if !consumed {
+			return ErrInvalidVerifyToken
+		}
+		if err := s.udb.Update(tx, map[string]interface{}{"email_verified_at": time.Now()}, tok.UserID); err != nil {
+			return server.NewHTTPInternalError("Error verifying email").SetInternal(err)
+		}
+		return nil
+	})
+}
+
+// ResendVerification emails a new verification link to the unverified user of the given email address.
+// No error is returned if there is no such user, or if too many links have been sent recently,
+// so the response does not leak whether an account exists.
+func (s *Auth) ResendVerification(c echo.Context, data ResendVerificationData) error {
+	usr := new(model.User)
+	if err := s.udb.View(s.db, usr, map[string]interface{}{"email": data.Email}); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return server.NewHTTPInternalError("Error finding user").SetInternal(err)
+	}
+	if usr.Blocked || usr.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	sent, err := s.tdb.CountSince(s.db, usr.ID, model.TokenPurposeVerifyEmail, time.Now().Add(-verifyEmailResendWindow))
+	if err != nil {
+		return server.NewHTTPInternalError("Error counting verification emails").SetInternal(err)
+	}
+	if sent >= verifyEmailResendLimit {
+		// throttled silently, only the unverified accounts are counted
+		return nil
+	}
+
+	if err := s.sendVerificationEmail(usr); err != nil {
+		return server.NewHTTPInternalError("Error sending verification email").SetInternal(err)
+	}
+
+	return nil
+}
+
+// sendVerificationEmail issues a new verification token for the user and emails its link
+func (s *Auth) sendVerificationEmail(u *model.User) error {
+	token, err := s.issueUserToken(u.ID, model.TokenPurposeVerifyEmail, s.cfg.VerifyEmailDuration)
+	if err != nil {
+		return err
+	}
+
+	return s.sendEmail(u.Email, "Verify your email address", "verify_email", map[string]interface{}{
+		"Name":      u.FirstName,
+		"Username":  u.Username,
+		"Link":      s.webLink("/verify-email", token),
+		"ExpiresIn": s.cfg.VerifyEmailDuration.String(),
+	})
+}
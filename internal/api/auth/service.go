@@ -1,46 +1,190 @@
 package auth
 
 import (
+	"context"
+	"log/slog"
 	"time"
 
 	"github.com/M15t/ghoul/internal/model"
+	"github.com/M15t/ghoul/pkg/server/middleware/jwt"
 	dbutil "github.com/M15t/ghoul/pkg/util/db"
+	"github.com/M15t/ghoul/pkg/util/email"
+	"github.com/M15t/ghoul/pkg/util/oidc"
+	"github.com/M15t/ghoul/pkg/util/pwdpolicy"
 
 	"gorm.io/gorm"
 )
 
 // New creates new auth service
-func New(db *gorm.DB, udb UserDB, jwt JWT, cr Crypter) *Auth {
+func New(db *gorm.DB, udb UserDB, sdb SessionRepository, tdb UserTokenRepository, rdb RecoveryCodeRepository, fdb LoginFailureRepository, hdb PasswordHistoryRepository, odb OAuthStateRepository, idb UserIdentityRepository, jwt JWT, cr Crypter, mail Mailer, logger *slog.Logger, cfg Config) *Auth {
+	if cfg.PasswordPolicy == nil {
+		cfg.PasswordPolicy = pwdpolicy.New(pwdpolicy.DefaultPolicy)
+	}
+	providers := make(map[string]OAuthProvider, len(cfg.OAuthProviders))
+	for _, p := range cfg.OAuthProviders {
+		providers[p.Name()] = p
+	}
 	return &Auth{
-		db:  db,
-		udb: udb,
-		jwt: jwt,
-		cr:  cr,
+		db:        db,
+		udb:       udb,
+		sdb:       sdb,
+		tdb:       tdb,
+		rdb:       rdb,
+		fdb:       fdb,
+		hdb:       hdb,
+		odb:       odb,
+		idb:       idb,
+		jwt:       jwt,
+		cr:        cr,
+		mail:      mail,
+		logger:    logger,
+		cfg:       cfg,
+		providers: providers,
 	}
 }
 
 // Auth represents auth application service
 type Auth struct {
-	db  *gorm.DB
-	udb UserDB
-	jwt JWT
-	cr  Crypter
+	db     *gorm.DB
+	udb    UserDB
+	sdb    SessionRepository
+	tdb    UserTokenRepository
+	rdb    RecoveryCodeRepository
+	fdb    LoginFailureRepository
+	hdb    PasswordHistoryRepository
+	odb    OAuthStateRepository
+	idb    UserIdentityRepository
+	jwt    JWT
+	cr     Crypter
+	mail   Mailer
+	logger *slog.Logger
+	cfg    Config
+
+	providers map[string]OAuthProvider
+}
+
+// Config represents the auth service configuration
+type Config struct {
+	// SessionDuration is the lifetime of a login session (refresh token). Zero means no expiration
+	SessionDuration time.Duration
+	// ResetPasswordDuration is the lifetime of a password reset token
+	ResetPasswordDuration time.Duration
+	// RegistrationEnabled allows the public self-service signup
+	RegistrationEnabled bool
+	// VerifyEmailDuration is the lifetime of an email verification token
+	VerifyEmailDuration time.Duration
+	// PasswordPolicy is applied whenever a password is set. Defaults to pwdpolicy.DefaultPolicy
+	PasswordPolicy *pwdpolicy.Policy
+	// LoginMaxFailures is the number of consecutive failed logins of an user before the account is locked.
+	// Each further failure doubles the lockout duration. Zero disables the lockout
+	LoginMaxFailures int
+	// LoginLockoutDuration is the first lockout duration
+	LoginLockoutDuration time.Duration
+	// LoginIPMaxFailures is the number of failed logins from an IP address within `LoginIPWindow` before
+	// further attempts from that address are rejected. Zero disables the throttling
+	LoginIPMaxFailures int
+	// LoginIPWindow is the sliding window of the failed logins per IP address, also the first throttling duration.
+	// Each further failure doubles the throttling duration
+	LoginIPWindow time.Duration
+	// MFAIssuer is the issuer name shown in authenticator apps
+	MFAIssuer string
+	// MFARequiredRoles are the roles which must login with the second factor
+	MFARequiredRoles []string
+	// WebURL is the base URL of the web app, used to build the links sent by email
+	WebURL string
+	// TemplateDir is the directory of the email templates
+	TemplateDir string
+	// ImpersonationDuration is the lifetime of impersonation tokens, defaults to 15 minutes
+	ImpersonationDuration time.Duration
+	// OAuthProviders are the OpenID providers available to login
+	OAuthProviders []OAuthProvider
 }
 
 // UserDB represents user repository interface
 type UserDB interface {
 	dbutil.Intf
 	FindByUsername(*gorm.DB, string) (*model.User, error)
-	FindByRefreshToken(*gorm.DB, string) (*model.User, error)
+}
+
+// SessionRepository represents session repository interface
+type SessionRepository interface {
+	dbutil.Intf
+	FindByFamily(*gorm.DB, string) (*model.Session, error)
+	Rotate(db *gorm.DB, rec *model.Session, oldHash, newHash string, updates map[string]interface{}) (bool, error)
+	Revoke(*gorm.DB, map[string]interface{}) error
+}
+
+// UserTokenRepository represents user token repository interface
+type UserTokenRepository interface {
+	dbutil.Intf
+	FindValid(db *gorm.DB, purpose, hash string) (*model.UserToken, error)
+	Consume(*gorm.DB, *model.UserToken) (bool, error)
+	Invalidate(db *gorm.DB, uid int, purpose string) error
+	CountSince(db *gorm.DB, uid int, purpose string, since time.Time) (int64, error)
+	IncrAttempts(*gorm.DB, *model.UserToken) error
+}
+
+// RecoveryCodeRepository represents MFA recovery code repository interface
+type RecoveryCodeRepository interface {
+	dbutil.Intf
+	Replace(db *gorm.DB, uid int, hashes []string) error
+	Consume(db *gorm.DB, uid int, hash string) (bool, error)
+}
+
+// LoginFailureRepository represents failed login repository interface
+type LoginFailureRepository interface {
+	dbutil.Intf
+	CountSince(db *gorm.DB, ip string, since time.Time) (int64, error)
+	LastAt(db *gorm.DB, ip string) (time.Time, error)
+	Purge(db *gorm.DB, before time.Time) error
+}
+
+// PasswordHistoryRepository represents password history repository interface
+type PasswordHistoryRepository interface {
+	dbutil.Intf
+	Recent(db *gorm.DB, uid int, limit int) ([]string, error)
+	Prune(db *gorm.DB, uid int, keep int) error
+}
+
+// OAuthStateRepository represents OpenID Connect login state repository interface
+type OAuthStateRepository interface {
+	dbutil.Intf
+	Consume(db *gorm.DB, hash string) (*model.OAuthState, error)
+	Purge(db *gorm.DB, before time.Time) error
+}
+
+// UserIdentityRepository represents external identity repository interface
+type UserIdentityRepository interface {
+	dbutil.Intf
+	FindBySubject(db *gorm.DB, provider, subject string) (*model.UserIdentity, error)
+}
+
+// OAuthProvider represents an OpenID provider client
+type OAuthProvider interface {
+	Name() string
+	AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error)
+	Exchange(ctx context.Context, code, verifier string) (*oidc.Token, error)
+	VerifyIDToken(ctx context.Context, raw, nonce string) (*oidc.IDToken, error)
 }
 
 // JWT represents token generator (jwt) interface
 type JWT interface {
-	GenerateToken(map[string]interface{}, *time.Time) (string, int, error)
+	GenerateToken(*jwt.Claims, *time.Time) (string, int, error)
+	RevokeToken(string, time.Time) error
+	RevokeSubject(string) error
+	JWKS() *jwt.JWKS
 }
 
 // Crypter represents security interface
 type Crypter interface {
+	HashPassword(string) (string, error)
 	CompareHashAndPassword(string, string) bool
+	NeedsRehash(string) bool
 	UID() string
+	HashToken(string) string
+}
+
+// Mailer represents email sender interface
+type Mailer interface {
+	SendEmail(email.Input) error
 }
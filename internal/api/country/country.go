@@ -1,6 +1,7 @@
 package country
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/M15t/ghoul/internal/model"
@@ -14,15 +15,13 @@ import (
 var (
 	ErrCountryNotFound    = server.NewHTTPError(http.StatusBadRequest, "COUNTRY_NOTFOUND", "Country not found")
 	ErrCountryNameExisted = server.NewHTTPValidationError("Country name already exists")
+	ErrCountryModified    = server.NewHTTPConflictError("Country has been modified, please reload and try again")
 )
 
 // Create creates a new country
 func (s *Country) Create(authUsr *model.AuthUser, data CreationData) (*model.Country, error) {
-	if err := s.enforce(authUsr, model.ActionCreateAll); err != nil {
-		return nil, err
-	}
-
-	if existed, err := s.cdb.Exist(s.db, map[string]interface{}{"name": data.Name}); err != nil || existed {
+	// the names of the deleted countries are kept until they are purged, so they may be restored
+	if existed, err := s.repo.Exists(dbutil.WithDeleted(s.db), map[string]interface{}{"name": data.Name}); err != nil || existed {
 		return nil, ErrCountryNameExisted.SetInternal(err)
 	}
 
@@ -31,7 +30,7 @@ func (s *Country) Create(authUsr *model.AuthUser, data CreationData) (*model.Cou
 		Code:      data.Code,
 		PhoneCode: data.PhoneCode,
 	}
-	if err := s.cdb.Create(s.db, rec); err != nil {
+	if err := s.repo.Create(s.db, rec); err != nil {
 		return nil, server.NewHTTPInternalError("Error creating country").SetInternal(err)
 	}
 
@@ -40,12 +39,8 @@ func (s *Country) Create(authUsr *model.AuthUser, data CreationData) (*model.Cou
 
 // View returns single country
 func (s *Country) View(authUsr *model.AuthUser, id int) (*model.Country, error) {
-	if err := s.enforce(authUsr, model.ActionViewAll); err != nil {
-		return nil, err
-	}
-
-	rec := new(model.Country)
-	if err := s.cdb.View(s.db, rec, id); err != nil {
+	rec, err := s.repo.Get(s.db, id)
+	if err != nil {
 		return nil, ErrCountryNotFound.SetInternal(err)
 	}
 
@@ -54,12 +49,15 @@ func (s *Country) View(authUsr *model.AuthUser, id int) (*model.Country, error)
 
 // List returns list of countrys
 func (s *Country) List(authUsr *model.AuthUser, lq *dbutil.ListQueryCondition, count *int64) ([]*model.Country, error) {
-	if err := s.enforce(authUsr, model.ActionViewAll); err != nil {
-		return nil, err
+	if lq != nil && lq.IncludeDeleted && !s.rbac.Enforce(authUsr.Role, model.ObjectCountry, model.ActionRestore) {
+		return nil, rbac.ErrForbiddenAction
 	}
 
-	var data []*model.Country
-	if err := s.cdb.List(s.db, &data, lq, count); err != nil {
+	data, err := s.repo.List(s.db, lq, count)
+	if err != nil {
+		if errors.Is(err, dbutil.ErrInvalidCursor) {
+			return nil, server.NewHTTPValidationError("Invalid cursor").SetInternal(err)
+		}
 		return nil, server.NewHTTPInternalError("Error listing country").SetInternal(err)
 	}
 
@@ -68,22 +66,24 @@ func (s *Country) List(authUsr *model.AuthUser, lq *dbutil.ListQueryCondition, c
 
 // Update updates country information
 func (s *Country) Update(authUsr *model.AuthUser, id int, data UpdateData) (*model.Country, error) {
-	if err := s.enforce(authUsr, model.ActionUpdateAll); err != nil {
-		return nil, err
-	}
-
-	if existed, err := s.cdb.Exist(s.db, map[string]interface{}{"name": data.Name, "id__notexact": id}); err != nil || existed {
+	if existed, err := s.repo.Exists(dbutil.WithDeleted(s.db), map[string]interface{}{"name": data.Name, "id__notexact": id}); err != nil || existed {
 		return nil, ErrCountryNameExisted.SetInternal(err)
 	}
 
-	// optimistic update
+	// optimistic update, rejected if the country has been modified since the given version
 	updates := structutil.ToMap(data)
-	if err := s.cdb.Update(s.db, updates, id); err != nil {
+	if data.Version != nil {
+		updates[dbutil.VersionColumn] = *data.Version
+	}
+	if err := s.repo.Update(s.db, updates, id); err != nil {
+		if errors.Is(err, dbutil.ErrVersionConflict) {
+			return nil, ErrCountryModified.SetInternal(err)
+		}
 		return nil, server.NewHTTPInternalError("Error updating country").SetInternal(err)
 	}
 
-	rec := new(model.Country)
-	if err := s.cdb.View(s.db, rec, id); err != nil {
+	rec, err := s.repo.Get(s.db, id)
+	if err != nil {
 		return nil, ErrCountryNotFound.SetInternal(err)
 	}
 
@@ -92,25 +92,31 @@ func (s *Country) Update(authUsr *model.AuthUser, id int, data UpdateData) (*mod
 
 // Delete deletes a country
 func (s *Country) Delete(authUsr *model.AuthUser, id int) error {
-	if err := s.enforce(authUsr, model.ActionDeleteAll); err != nil {
-		return err
-	}
-
-	if existed, err := s.cdb.Exist(s.db, id); err != nil || !existed {
+	if existed, err := s.repo.Exists(s.db, id); err != nil || !existed {
 		return ErrCountryNotFound.SetInternal(err)
 	}
 
-	if err := s.cdb.Delete(s.db, id); err != nil {
+	if err := s.repo.Delete(s.db, id); err != nil {
 		return server.NewHTTPInternalError("Error deleting country").SetInternal(err)
 	}
 
 	return nil
 }
 
-// enforce checks user permission to perform the action
-func (s *Country) enforce(authUsr *model.AuthUser, action string) error {
-	if !s.rbac.Enforce(authUsr.Role, model.ObjectCountry, action) {
-		return rbac.ErrForbiddenAction
+// Restore restores a deleted country
+func (s *Country) Restore(authUsr *model.AuthUser, id int) (*model.Country, error) {
+	if existed, err := s.repo.Exists(dbutil.WithDeleted(s.db), id); err != nil || !existed {
+		return nil, ErrCountryNotFound.SetInternal(err)
 	}
-	return nil
+
+	if err := s.repo.Restore(s.db, id); err != nil {
+		return nil, server.NewHTTPInternalError("Error restoring country").SetInternal(err)
+	}
+
+	rec, err := s.repo.Get(s.db, id)
+	if err != nil {
+		return nil, ErrCountryNotFound.SetInternal(err)
+	}
+
+	return rec, nil
 }
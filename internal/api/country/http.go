@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/M15t/ghoul/internal/model"
+	"github.com/M15t/ghoul/pkg/rbac"
 	"github.com/M15t/ghoul/pkg/server"
 	dbutil "github.com/M15t/ghoul/pkg/util/db"
 	httputil "github.com/M15t/ghoul/pkg/util/http"
@@ -26,6 +27,20 @@ type Service interface {
 	List(*model.AuthUser, *dbutil.ListQueryCondition, *int64) ([]*model.Country, error)
 	Update(*model.AuthUser, int, UpdateData) (*model.Country, error)
 	Delete(*model.AuthUser, int) error
+	Restore(*model.AuthUser, int) (*model.Country, error)
+}
+
+// ListFields are the fields the countries may be sorted and filtered by, see the list tags of model.Country
+var ListFields = dbutil.NewListFields(model.Country{})
+
+// Permissions of the country routes, enforced by the rbac.Middleware
+var Permissions = []rbac.Permission{
+	{Method: http.MethodPost, Path: "", Object: model.ObjectCountry, Action: model.ActionCreateAll},
+	{Method: http.MethodGet, Path: "/:id", Object: model.ObjectCountry, Action: model.ActionViewAll},
+	{Method: http.MethodGet, Path: "", Object: model.ObjectCountry, Action: model.ActionViewAll},
+	{Method: http.MethodPatch, Path: "/:id", Object: model.ObjectCountry, Action: model.ActionUpdateAll},
+	{Method: http.MethodDelete, Path: "/:id", Object: model.ObjectCountry, Action: model.ActionDeleteAll},
+	{Method: http.MethodPost, Path: "/:id/restore", Object: model.ObjectCountry, Action: model.ActionRestore},
 }
 
 // NewHTTP creates new country http service
@@ -71,6 +86,10 @@ func NewHTTP(svc Service, auth model.Auth, eg *echo.Group) {
 	//     description: The country
 	//     schema:
 	//       "$ref": "#/definitions/Country"
+	//     headers:
+	//       ETag:
+	//         description: Version of the country, to send in the If-Match header of the update
+	//         type: string
 	//   "400":
 	//     "$ref": "#/responses/errDetails"
 	//   "401":
@@ -116,6 +135,10 @@ func NewHTTP(svc Service, auth model.Auth, eg *echo.Group) {
 	//   required: true
 	//   schema:
 	//     "$ref": "#/definitions/CountryUpdateData"
+	// - name: If-Match
+	//   in: header
+	//   description: ETag of the country, the update is rejected if it has been modified since
+	//   type: string
 	// responses:
 	//   "200":
 	//     description: The updated country
@@ -129,6 +152,8 @@ func NewHTTP(svc Service, auth model.Auth, eg *echo.Group) {
 	//     "$ref": "#/responses/errDetails"
 	//   "404":
 	//     "$ref": "#/responses/errDetails"
+	//   "412":
+	//     "$ref": "#/responses/errDetails"
 	//   "500":
 	//     "$ref": "#/responses/errDetails"
 	eg.PATCH("/:id", h.update)
@@ -154,6 +179,30 @@ func NewHTTP(svc Service, auth model.Auth, eg *echo.Group) {
 	//   "500":
 	//     "$ref": "#/responses/errDetails"
 	eg.DELETE("/:id", h.delete)
+
+	// swagger:operation POST /v1/countries/{id}/restore countries countriesRestore
+	// ---
+	// summary: Restores a deleted country
+	// parameters:
+	// - name: id
+	//   in: path
+	//   description: id of country
+	//   type: integer
+	//   required: true
+	// responses:
+	//   "200":
+	//     description: The restored country
+	//     schema:
+	//       "$ref": "#/definitions/Country"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "403":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	eg.POST("/:id/restore", h.restore)
 }
 
 // CreationData contains country data from json request
@@ -176,6 +225,8 @@ type UpdateData struct {
 	Code *string `json:"code,omitempty" validate:"omitempty,min=2,max=10"`
 	// example: +84
 	PhoneCode *string `json:"phone_code,omitempty" validate:"omitempty,min=2,max=10"`
+	// Version is the expected version of the country, from the If-Match header
+	Version *int `json:"-"`
 }
 
 // ListResp contains list of paginated countries and total numbers of countries
@@ -185,6 +236,10 @@ type ListResp struct {
 	Data []*model.Country `json:"data"`
 	// example: 1
 	TotalCount int64 `json:"total_count"`
+	// Cursor of the next page in the keyset pagination, empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+	// Cursor of the previous page in the keyset pagination, empty on the first page
+	PrevCursor string `json:"prev_cursor,omitempty"`
 }
 
 func (h *HTTP) create(c echo.Context) error {
@@ -218,11 +273,12 @@ func (h *HTTP) view(c echo.Context) error {
 		return err
 	}
 
+	httputil.SetETag(c, resp.Version)
 	return c.JSON(http.StatusOK, resp)
 }
 
 func (h *HTTP) list(c echo.Context) error {
-	lq, err := httputil.ReqListQuery(c)
+	lq, err := httputil.ReqListQuery(c, ListFields)
 	if err != nil {
 		return err
 	}
@@ -232,7 +288,7 @@ func (h *HTTP) list(c echo.Context) error {
 		return err
 	}
 
-	return c.JSON(http.StatusOK, ListResp{resp, count})
+	return c.JSON(http.StatusOK, ListResp{resp, count, lq.NextCursor, lq.PrevCursor})
 }
 
 func (h *HTTP) update(c echo.Context) error {
@@ -247,12 +303,16 @@ func (h *HTTP) update(c echo.Context) error {
 	r.Name = httputil.TrimSpacePointer(r.Name)
 	r.Code = httputil.TrimSpacePointer(r.Code)
 	r.PhoneCode = httputil.RemoveSpacePointer(r.PhoneCode)
+	if r.Version, err = httputil.ReqIfMatch(c); err != nil {
+		return err
+	}
 
 	usr, err := h.svc.Update(h.auth.User(c), id, r)
 	if err != nil {
 		return err
 	}
 
+	httputil.SetETag(c, usr.Version)
 	return c.JSON(http.StatusOK, usr)
 }
 
@@ -267,3 +327,16 @@ func (h *HTTP) delete(c echo.Context) error {
 
 	return c.NoContent(http.StatusOK)
 }
+
+func (h *HTTP) restore(c echo.Context) error {
+	id, err := httputil.ReqID(c)
+	if err != nil {
+		return err
+	}
+	resp, err := h.svc.Restore(h.auth.User(c), id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
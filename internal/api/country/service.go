@@ -8,11 +8,12 @@ import (
 	"gorm.io/gorm"
 )
 
-// New creates new country application service
-func New(db *gorm.DB, cdb dbutil.Intf, rbacSvc rbac.Intf) *Country {
+// New creates new country application service.
+// The permissions are enforced by the routes, see Permissions, `rbacSvc` checks the listing of the deleted countries.
+func New(db *gorm.DB, repo MyRepo, rbacSvc rbac.Intf) *Country {
 	return &Country{
 		db:   db,
-		cdb:  cdb,
+		repo: repo,
 		rbac: rbacSvc,
 	}
 }
@@ -20,11 +21,16 @@ func New(db *gorm.DB, cdb dbutil.Intf, rbacSvc rbac.Intf) *Country {
 // Country represents country application service
 type Country struct {
 	db   *gorm.DB
-	cdb  dbutil.Intf
+	repo MyRepo
 	rbac rbac.Intf
 }
 
-// NewDB returns a new country database instance
-func NewDB() *dbutil.DB {
-	return dbutil.NewDB(model.Country{})
+// MyRepo represents country repository interface
+type MyRepo interface {
+	dbutil.RepoIntf[model.Country]
+}
+
+// NewRepo returns a new country repository
+func NewRepo() *dbutil.Repo[model.Country] {
+	return dbutil.NewRepo[model.Country]()
 }
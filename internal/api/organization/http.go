@@ -0,0 +1,335 @@
+package organization
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/M15t/ghoul/internal/model"
+	"github.com/M15t/ghoul/pkg/server/middleware/tenant"
+	dbutil "github.com/M15t/ghoul/pkg/util/db"
+	httputil "github.com/M15t/ghoul/pkg/util/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HTTP represents organization http service
+type HTTP struct {
+	svc  Service
+	auth model.Auth
+}
+
+// Service represents organization application interface
+type Service interface {
+	Resolve(*model.AuthUser, string) (string, error)
+	Create(*model.AuthUser, CreationData) (*model.Organization, error)
+	List(*model.AuthUser) ([]*model.Membership, error)
+	View(*model.AuthUser) (*model.Organization, error)
+	ListMembers(*model.AuthUser, *dbutil.ListQueryCondition, *int64) ([]*model.Membership, error)
+	AddMember(*model.AuthUser, MemberData) (*model.Membership, error)
+	UpdateMember(*model.AuthUser, int, MemberUpdateData) (*model.Membership, error)
+	RemoveMember(*model.AuthUser, int) error
+}
+
+// MemberListFields are the fields the members may be sorted and filtered by, see the list tags of model.Membership
+var MemberListFields = dbutil.NewListFields(model.Membership{})
+
+// NewResolver returns the tenant resolver which looks up the role of the authenticated user in the organization
+func NewResolver(svc Service, auth model.Auth) tenant.Resolver {
+	return func(c echo.Context, id string) (string, error) {
+		return svc.Resolve(auth.User(c), id)
+	}
+}
+
+// NewHTTP creates new organization http service
+func NewHTTP(svc Service, auth model.Auth, eg *echo.Group) {
+	h := HTTP{svc, auth}
+
+	// swagger:operation POST /v1/organizations organizations organizationsCreate
+	// ---
+	// summary: Creates new organization, owned by the current user
+	// parameters:
+	// - name: request
+	//   in: body
+	//   description: Request body
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/OrganizationCreationData"
+	// responses:
+	//   "200":
+	//     description: The new organization
+	//     schema:
+	//       "$ref": "#/definitions/Organization"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "403":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	eg.POST("", h.create)
+
+	// swagger:operation GET /v1/organizations organizations organizationsList
+	// ---
+	// summary: Returns the memberships of the current user with their organizations
+	// responses:
+	//   "200":
+	//     description: List of memberships
+	//     schema:
+	//       "$ref": "#/definitions/OrganizationListResp"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	eg.GET("", h.list)
+
+	// swagger:operation GET /v1/organizations/current organizations organizationsView
+	// ---
+	// summary: Returns the organization given by the X-Organization-ID header
+	// responses:
+	//   "200":
+	//     description: The organization
+	//     schema:
+	//       "$ref": "#/definitions/Organization"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "403":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	eg.GET("/current", h.view)
+
+	// swagger:operation GET /v1/organizations/current/members organizations organizationsListMembers
+	// ---
+	// summary: Returns list of members of the current organization
+	// responses:
+	//   "200":
+	//     description: List of members
+	//     schema:
+	//       "$ref": "#/definitions/MemberListResp"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "403":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	eg.GET("/current/members", h.listMembers)
+
+	// swagger:operation POST /v1/organizations/current/members organizations organizationsAddMember
+	// ---
+	// summary: Adds an user to the current organization
+	// parameters:
+	// - name: request
+	//   in: body
+	//   description: Request body
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/MemberData"
+	// responses:
+	//   "200":
+	//     description: The new membership
+	//     schema:
+	//       "$ref": "#/definitions/Membership"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "403":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	eg.POST("/current/members", h.addMember)
+
+	// swagger:operation PATCH /v1/organizations/current/members/{id} organizations organizationsUpdateMember
+	// ---
+	// summary: Changes the role of a member of the current organization
+	// parameters:
+	// - name: id
+	//   in: path
+	//   description: id of the member user
+	//   type: integer
+	//   required: true
+	// - name: request
+	//   in: body
+	//   description: Request body
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/MemberUpdateData"
+	// responses:
+	//   "200":
+	//     description: The updated membership
+	//     schema:
+	//       "$ref": "#/definitions/Membership"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "403":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	eg.PATCH("/current/members/:id", h.updateMember)
+
+	// swagger:operation DELETE /v1/organizations/current/members/{id} organizations organizationsRemoveMember
+	// ---
+	// summary: Removes a member from the current organization
+	// parameters:
+	// - name: id
+	//   in: path
+	//   description: id of the member user
+	//   type: integer
+	//   required: true
+	// responses:
+	//   "200":
+	//     "$ref": "#/responses/ok"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "403":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	eg.DELETE("/current/members/:id", h.removeMember)
+}
+
+// CreationData contains organization data from json request
+// swagger:model OrganizationCreationData
+type CreationData struct {
+	// example: Acme
+	Name string `json:"name" validate:"required,min=2,max=255"`
+	// example: acme
+	Slug string `json:"slug" validate:"required,min=2,max=100,alphanum"`
+}
+
+// MemberData contains membership data from json request
+// swagger:model MemberData
+type MemberData struct {
+	// example: 2
+	UserID int `json:"user_id" validate:"required"`
+	// example: org_member
+	Role string `json:"role" validate:"required,oneof=org_owner org_admin org_member"`
+}
+
+// MemberUpdateData contains membership data from json request
+// swagger:model MemberUpdateData
+type MemberUpdateData struct {
+	// example: org_admin
+	Role string `json:"role" validate:"required,oneof=org_owner org_admin org_member"`
+}
+
+// ListResp contains list of memberships of the current user
+// swagger:model OrganizationListResp
+type ListResp struct {
+	// example: [{"id": 1, "created_at": "2020-01-14T10:03:41Z", "updated_at": "2020-01-14T10:03:41Z", "organization_id": 1, "user_id": 1, "role": "org_owner", "organization": {"id": 1, "name": "Acme", "slug": "acme"}}]
+	Data []*model.Membership `json:"data"`
+}
+
+// MemberListResp contains list of paginated members and total numbers of members
+// swagger:model MemberListResp
+type MemberListResp struct {
+	// example: [{"id": 1, "created_at": "2020-01-14T10:03:41Z", "updated_at": "2020-01-14T10:03:41Z", "organization_id": 1, "user_id": 1, "role": "org_owner"}]
+	Data []*model.Membership `json:"data"`
+	// example: 1
+	TotalCount int64 `json:"total_count"`
+	// Cursor of the next page in the keyset pagination, empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+	// Cursor of the previous page in the keyset pagination, empty on the first page
+	PrevCursor string `json:"prev_cursor,omitempty"`
+}
+
+func (h *HTTP) create(c echo.Context) error {
+	r := CreationData{}
+	if err := c.Bind(&r); err != nil {
+		return err
+	}
+	r.Name = strings.TrimSpace(r.Name)
+	r.Slug = strings.ToLower(r.Slug)
+
+	resp, err := h.svc.Create(h.auth.User(c), r)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (h *HTTP) list(c echo.Context) error {
+	resp, err := h.svc.List(h.auth.User(c))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, ListResp{resp})
+}
+
+func (h *HTTP) view(c echo.Context) error {
+	resp, err := h.svc.View(h.auth.User(c))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (h *HTTP) listMembers(c echo.Context) error {
+	lq, err := httputil.ReqListQuery(c, MemberListFields)
+	if err != nil {
+		return err
+	}
+	var count int64 = 0
+	resp, err := h.svc.ListMembers(h.auth.User(c), lq, &count)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, MemberListResp{resp, count, lq.NextCursor, lq.PrevCursor})
+}
+
+func (h *HTTP) addMember(c echo.Context) error {
+	r := MemberData{}
+	if err := c.Bind(&r); err != nil {
+		return err
+	}
+
+	resp, err := h.svc.AddMember(h.auth.User(c), r)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (h *HTTP) updateMember(c echo.Context) error {
+	id, err := httputil.ReqID(c)
+	if err != nil {
+		return err
+	}
+	r := MemberUpdateData{}
+	if err := c.Bind(&r); err != nil {
+		return err
+	}
+
+	resp, err := h.svc.UpdateMember(h.auth.User(c), id, r)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (h *HTTP) removeMember(c echo.Context) error {
+	id, err := httputil.ReqID(c)
+	if err != nil {
+		return err
+	}
+	if err := h.svc.RemoveMember(h.auth.User(c), id); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
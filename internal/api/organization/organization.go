@@ -0,0 +1,243 @@
+package organization
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/M15t/ghoul/internal/model"
+	"github.com/M15t/ghoul/pkg/rbac"
+	"github.com/M15t/ghoul/pkg/server"
+	dbutil "github.com/M15t/ghoul/pkg/util/db"
+
+	"gorm.io/gorm"
+)
+
+// Custom errors
+var (
+	ErrOrganizationNotFound = server.NewHTTPError(http.StatusBadRequest, "ORGANIZATION_NOTFOUND", "Organization not found")
+	ErrOrganizationRequired = server.NewHTTPError(http.StatusBadRequest, "ORGANIZATION_REQUIRED", "The organization is required, send its ID in the X-Organization-ID header")
+	ErrNotMember            = server.NewHTTPError(http.StatusForbidden, "NOT_MEMBER", "You are not a member of the organization")
+	ErrSlugExisted          = server.NewHTTPValidationError("Slug already existed")
+	ErrUserNotFound         = server.NewHTTPError(http.StatusBadRequest, "USER_NOTFOUND", "User not found")
+	ErrMemberNotFound       = server.NewHTTPError(http.StatusBadRequest, "MEMBER_NOTFOUND", "Member not found")
+	ErrMemberExisted        = server.NewHTTPValidationError("User is already a member")
+	ErrLastOwner            = server.NewHTTPError(http.StatusBadRequest, "LAST_OWNER", "The last owner of the organization may not be removed or demoted")
+)
+
+// Resolve returns the role of the user in the organization, it is the resolver of the tenant middleware
+func (s *Organization) Resolve(authUsr *model.AuthUser, id string) (string, error) {
+	orgID, err := strconv.Atoi(id)
+	if err != nil || orgID <= 0 {
+		return "", ErrOrganizationNotFound
+	}
+
+	m := new(model.Membership)
+	if err := s.mdb.View(dbutil.WithTenant(s.db, orgID), m, map[string]interface{}{"user_id": authUsr.ID}); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrNotMember
+		}
+		return "", server.NewHTTPInternalError("Error finding membership").SetInternal(err)
+	}
+
+	return m.Role, nil
+}
+
+// Create creates a new organization, owned by the user
+func (s *Organization) Create(authUsr *model.AuthUser, data CreationData) (*model.Organization, error) {
+	if !s.rbac.Enforce(authUsr.Role, model.ObjectOrganization, model.ActionCreate) {
+		return nil, rbac.ErrForbiddenAction
+	}
+
+	if existed, err := s.odb.Exist(s.db, map[string]interface{}{"slug": data.Slug}); err != nil || existed {
+		return nil, ErrSlugExisted.SetInternal(err)
+	}
+
+	rec := &model.Organization{Name: data.Name, Slug: data.Slug}
+	if err := dbutil.Transaction(s.db, func(tx *gorm.DB) error {
+		if err := s.odb.Create(tx, rec); err != nil {
+			return err
+		}
+		return s.mdb.Create(dbutil.WithTenant(tx, rec.ID), &model.Membership{UserID: authUsr.ID, Role: model.OrgRoleOwner})
+	}); err != nil {
+		return nil, server.NewHTTPInternalError("Error creating organization").SetInternal(err)
+	}
+
+	return rec, nil
+}
+
+// List returns the memberships of the user with their organizations
+func (s *Organization) List(authUsr *model.AuthUser) ([]*model.Membership, error) {
+	var data []*model.Membership
+	// the memberships of the user across the organizations
+	db := dbutil.WithoutTenant(s.db).Where("user_id = ?", authUsr.ID).Preload("Organization").Order("id")
+	if err := s.mdb.List(db, &data, nil, nil); err != nil {
+		return nil, server.NewHTTPInternalError("Error listing organizations").SetInternal(err)
+	}
+
+	return data, nil
+}
+
+// View returns the organization of the request
+func (s *Organization) View(authUsr *model.AuthUser) (*model.Organization, error) {
+	if err := s.enforce(authUsr, model.ObjectOrganization, model.ActionView); err != nil {
+		return nil, err
+	}
+
+	rec := new(model.Organization)
+	if err := s.odb.View(s.db, rec, authUsr.OrgID); err != nil {
+		return nil, ErrOrganizationNotFound.SetInternal(err)
+	}
+
+	return rec, nil
+}
+
+// ListMembers returns the members of the organization of the request
+func (s *Organization) ListMembers(authUsr *model.AuthUser, lq *dbutil.ListQueryCondition, count *int64) ([]*model.Membership, error) {
+	if err := s.enforce(authUsr, model.ObjectMembership, model.ActionViewAll); err != nil {
+		return nil, err
+	}
+
+	var data []*model.Membership
+	if err := s.mdb.List(s.tenantDB(authUsr).Preload("User"), &data, lq, count); err != nil {
+		if errors.Is(err, dbutil.ErrInvalidCursor) {
+			return nil, server.NewHTTPValidationError("Invalid cursor").SetInternal(err)
+		}
+		return nil, server.NewHTTPInternalError("Error listing members").SetInternal(err)
+	}
+
+	return data, nil
+}
+
+// AddMember adds an user to the organization of the request
+func (s *Organization) AddMember(authUsr *model.AuthUser, data MemberData) (*model.Membership, error) {
+	if err := s.enforce(authUsr, model.ObjectMembership, model.ActionCreateAll); err != nil {
+		return nil, err
+	}
+	if err := s.enforceGrant(authUsr, data.Role); err != nil {
+		return nil, err
+	}
+
+	if existed, err := s.udb.Exist(s.db, data.UserID); err != nil || !existed {
+		return nil, ErrUserNotFound.SetInternal(err)
+	}
+	tdb := s.tenantDB(authUsr)
+	if existed, err := s.mdb.Exist(tdb, map[string]interface{}{"user_id": data.UserID}); err != nil || existed {
+		return nil, ErrMemberExisted.SetInternal(err)
+	}
+
+	rec := &model.Membership{UserID: data.UserID, Role: data.Role}
+	if err := s.mdb.Create(tdb, rec); err != nil {
+		return nil, server.NewHTTPInternalError("Error adding member").SetInternal(err)
+	}
+
+	return rec, nil
+}
+
+// UpdateMember changes the role of a member of the organization of the request
+func (s *Organization) UpdateMember(authUsr *model.AuthUser, uid int, data MemberUpdateData) (*model.Membership, error) {
+	if err := s.enforce(authUsr, model.ObjectMembership, model.ActionUpdateAll); err != nil {
+		return nil, err
+	}
+
+	rec, err := s.member(authUsr, uid)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.enforceGrant(authUsr, rec.Role); err != nil {
+		return nil, err
+	}
+	if err := s.enforceGrant(authUsr, data.Role); err != nil {
+		return nil, err
+	}
+	if data.Role != model.OrgRoleOwner {
+		if err := s.checkLastOwner(authUsr, rec); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.mdb.Update(s.tenantDB(authUsr), map[string]interface{}{"role": data.Role}, rec.ID); err != nil {
+		return nil, server.NewHTTPInternalError("Error updating member").SetInternal(err)
+	}
+	rec.Role = data.Role
+
+	return rec, nil
+}
+
+// RemoveMember removes a member from the organization of the request. Members may always leave by themselves.
+func (s *Organization) RemoveMember(authUsr *model.AuthUser, uid int) error {
+	if uid != authUsr.ID {
+		if err := s.enforce(authUsr, model.ObjectMembership, model.ActionDeleteAll); err != nil {
+			return err
+		}
+	}
+
+	rec, err := s.member(authUsr, uid)
+	if err != nil {
+		return err
+	}
+	if uid != authUsr.ID {
+		if err := s.enforceGrant(authUsr, rec.Role); err != nil {
+			return err
+		}
+	}
+	if err := s.checkLastOwner(authUsr, rec); err != nil {
+		return err
+	}
+
+	if err := s.mdb.Delete(s.tenantDB(authUsr), rec.ID); err != nil {
+		return server.NewHTTPInternalError("Error removing member").SetInternal(err)
+	}
+
+	return nil
+}
+
+// member returns the membership of the user in the organization of the request
+func (s *Organization) member(authUsr *model.AuthUser, uid int) (*model.Membership, error) {
+	rec := new(model.Membership)
+	if err := s.mdb.View(s.tenantDB(authUsr), rec, map[string]interface{}{"user_id": uid}); err != nil {
+		return nil, ErrMemberNotFound.SetInternal(err)
+	}
+	return rec, nil
+}
+
+// checkLastOwner prevents the organization from losing its last owner
+func (s *Organization) checkLastOwner(authUsr *model.AuthUser, rec *model.Membership) error {
+	if rec.Role != model.OrgRoleOwner {
+		return nil
+	}
+
+	var owners []*model.Membership
+	if err := s.mdb.List(s.tenantDB(authUsr).Where("role = ?", model.OrgRoleOwner), &owners, nil, nil); err != nil {
+		return server.NewHTTPInternalError("Error counting owners").SetInternal(err)
+	}
+	if len(owners) <= 1 {
+		return ErrLastOwner
+	}
+
+	return nil
+}
+
+// tenantDB returns the database scoped to the organization of the request
+func (s *Organization) tenantDB(authUsr *model.AuthUser) *gorm.DB {
+	return dbutil.WithTenant(s.db, authUsr.OrgID)
+}
+
+// enforce checks the member permission to perform the action in the organization of the request
+func (s *Organization) enforce(authUsr *model.AuthUser, obj, action string) error {
+	if authUsr.OrgID == 0 {
+		return ErrOrganizationRequired
+	}
+	if !s.drbac.Enforce(authUsr.OrgRole, strconv.Itoa(authUsr.OrgID), obj, action) {
+		return rbac.ErrForbiddenAction
+	}
+	return nil
+}
+
+// enforceGrant allows only the owners to grant or revoke the owner role
+func (s *Organization) enforceGrant(authUsr *model.AuthUser, role string) error {
+	if role == model.OrgRoleOwner && authUsr.OrgRole != model.OrgRoleOwner {
+		return rbac.ErrForbiddenAction
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package organization
+
+import (
+	"github.com/M15t/ghoul/internal/model"
+	"github.com/M15t/ghoul/pkg/rbac"
+	dbutil "github.com/M15t/ghoul/pkg/util/db"
+
+	"gorm.io/gorm"
+)
+
+// New creates new organization application service.
+// `rbacSvc` enforces the platform roles, `drbac` enforces the roles of the members in their organization domain.
+func New(db *gorm.DB, odb dbutil.Intf, mdb dbutil.Intf, udb dbutil.Intf, rbacSvc rbac.Intf, drbac rbac.Intf) *Organization {
+	return &Organization{
+		db:    db,
+		odb:   odb,
+		mdb:   mdb,
+		udb:   udb,
+		rbac:  rbacSvc,
+		drbac: drbac,
+	}
+}
+
+// Organization represents organization application service
+type Organization struct {
+	db    *gorm.DB
+	odb   dbutil.Intf
+	mdb   dbutil.Intf
+	udb   dbutil.Intf
+	rbac  rbac.Intf
+	drbac rbac.Intf
+}
+
+// NewDB returns a new organization database instance
+func NewDB() *dbutil.DB {
+	return dbutil.NewDB(model.Organization{})
+}
+
+// NewMembershipDB returns a new membership database instance
+func NewMembershipDB() *dbutil.DB {
+	return dbutil.NewDB(model.Membership{})
+}
@@ -0,0 +1,395 @@
+package policy
+
+import (
+	"net/http"
+
+	"github.com/M15t/ghoul/internal/model"
+	"github.com/M15t/ghoul/pkg/rbac"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HTTP represents RBAC policy http service
+type HTTP struct {
+	svc  Service
+	auth model.Auth
+}
+
+// Service represents RBAC policy application interface
+type Service interface {
+	ListPolicies(*model.AuthUser, string) ([]*Rule, error)
+	AddPolicy(*model.AuthUser, Rule) error
+	RemovePolicy(*model.AuthUser, Rule) error
+	ListRoles(*model.AuthUser) ([]*Role, error)
+	AddInheritance(*model.AuthUser, Inheritance) error
+	RemoveInheritance(*model.AuthUser, Inheritance) error
+	MyPermissions(*model.AuthUser) ([]*Permission, error)
+	Check(*model.AuthUser, CheckData) ([]*CheckResult, error)
+}
+
+// Permissions of the RBAC policy routes, enforced by the rbac.Middleware
+var Permissions = []rbac.Permission{
+	{Method: http.MethodGet, Path: "/policies", Object: model.ObjectRBAC, Action: model.ActionViewAll},
+	{Method: http.MethodPost, Path: "/policies", Object: model.ObjectRBAC, Action: model.ActionCreateAll},
+	{Method: http.MethodDelete, Path: "/policies", Object: model.ObjectRBAC, Action: model.ActionDeleteAll},
+	{Method: http.MethodGet, Path: "/roles", Object: model.ObjectRBAC, Action: model.ActionViewAll},
+	{Method: http.MethodPost, Path: "/roles", Object: model.ObjectRBAC, Action: model.ActionCreateAll},
+	{Method: http.MethodDelete, Path: "/roles", Object: model.ObjectRBAC, Action: model.ActionDeleteAll},
+}
+
+// NewHTTP creates new RBAC policy http service
+func NewHTTP(svc Service, auth model.Auth, eg *echo.Group) {
+	h := HTTP{svc, auth}
+
+	// swagger:operation GET /v1/rbac/policies rbac rbacListPolicies
+	// ---
+	// summary: Returns the RBAC policies
+	// parameters:
+	// - name: role
+	//   in: query
+	//   description: Returns the policies of this role only
+	//   type: string
+	// responses:
+	//   "200":
+	//     description: List of policies
+	//     schema:
+	//       "$ref": "#/definitions/RBACPolicyListResp"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "403":
+	//     "$ref": "#/responses/errDetails"
+	eg.GET("/policies", h.listPolicies)
+
+	// swagger:operation POST /v1/rbac/policies rbac rbacAddPolicy
+	// ---
+	// summary: Grants a permission to a role
+	// description: The change takes effect immediately. The superadmin role may not be modified.
+	// parameters:
+	// - name: request
+	//   in: body
+	//   description: Request body
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/RBACRule"
+	// responses:
+	//   "200":
+	//     "$ref": "#/responses/ok"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "403":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	eg.POST("/policies", h.addPolicy)
+
+	// swagger:operation DELETE /v1/rbac/policies rbac rbacRemovePolicy
+	// ---
+	// summary: Revokes a permission from a role
+	// description: The change takes effect immediately. The superadmin role may not be modified.
+	// parameters:
+	// - name: role
+	//   in: query
+	//   type: string
+	//   required: true
+	// - name: object
+	//   in: query
+	//   type: string
+	//   required: true
+	// - name: action
+	//   in: query
+	//   type: string
+	//   required: true
+	// responses:
+	//   "200":
+	//     "$ref": "#/responses/ok"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "403":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	eg.DELETE("/policies", h.removePolicy)
+
+	// swagger:operation GET /v1/rbac/roles rbac rbacListRoles
+	// ---
+	// summary: Returns the RBAC roles with the roles they inherit
+	// responses:
+	//   "200":
+	//     description: List of roles
+	//     schema:
+	//       "$ref": "#/definitions/RBACRoleListResp"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "403":
+	//     "$ref": "#/responses/errDetails"
+	eg.GET("/roles", h.listRoles)
+
+	// swagger:operation POST /v1/rbac/roles rbac rbacAddInheritance
+	// ---
+	// summary: Makes a role inherit all permissions of another role
+	// description: The role is created if it does not exist yet. The superadmin role may not be modified.
+	// parameters:
+	// - name: request
+	//   in: body
+	//   description: Request body
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/RBACInheritance"
+	// responses:
+	//   "200":
+	//     "$ref": "#/responses/ok"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "403":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	eg.POST("/roles", h.addInheritance)
+
+	// swagger:operation DELETE /v1/rbac/roles rbac rbacRemoveInheritance
+	// ---
+	// summary: Stops a role inheriting the permissions of another role
+	// description: The superadmin role may not be modified.
+	// parameters:
+	// - name: role
+	//   in: query
+	//   type: string
+	//   required: true
+	// - name: inherits
+	//   in: query
+	//   type: string
+	//   required: true
+	// responses:
+	//   "200":
+	//     "$ref": "#/responses/ok"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "403":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	eg.DELETE("/roles", h.removeInheritance)
+
+	// swagger:operation POST /v1/rbac/check rbac rbacCheck
+	// ---
+	// summary: Checks whether the current user role, or the given role, may perform each of the actions
+	// parameters:
+	// - name: request
+	//   in: body
+	//   description: Request body
+	//   required: true
+	//   schema:
+	//     "$ref": "#/definitions/RBACCheckData"
+	// responses:
+	//   "200":
+	//     description: The results, in the order of the checks
+	//     schema:
+	//       "$ref": "#/definitions/RBACCheckResp"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "403":
+	//     "$ref": "#/responses/errDetails"
+	eg.POST("/check", h.check)
+}
+
+// NewUserHTTP creates the RBAC http service of the current user, mounted under the users group
+func NewUserHTTP(svc Service, auth model.Auth, eg *echo.Group) {
+	h := HTTP{svc, auth}
+
+	// swagger:operation GET /v1/users/me/permissions rbac rbacMyPermissions
+	// ---
+	// summary: Returns the effective permissions of the current user, including the ones of the inherited roles
+	// responses:
+	//   "200":
+	//     description: List of permissions
+	//     schema:
+	//       "$ref": "#/definitions/RBACPermissionListResp"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	eg.GET("/me/permissions", h.myPermissions)
+}
+
+// Rule contains a permission of a role
+// swagger:model RBACRule
+type Rule struct {
+	// example: admin
+	Role string `json:"role" query:"role" validate:"required,max=100,excludesall=0x2C"`
+	// The object or * for any object
+	// example: country
+	Object string `json:"object" query:"object" validate:"required,max=100,excludesall=0x2C"`
+	// The action or * for any action
+	// example: view_all
+	Action string `json:"action" query:"action" validate:"required,max=100,excludesall=0x2C"`
+}
+
+// Role contains a role with the roles it directly inherits
+// swagger:model RBACRole
+type Role struct {
+	// example: admin
+	Name string `json:"name"`
+	// example: ["user"]
+	Inherits []string `json:"inherits"`
+}
+
+// Inheritance contains a role inheriting another role
+// swagger:model RBACInheritance
+type Inheritance struct {
+	// example: admin
+	Role string `json:"role" query:"role" validate:"required,max=100,excludesall=0x2C"`
+	// example: user
+	Inherits string `json:"inherits" query:"inherits" validate:"required,max=100,excludesall=0x2C"`
+}
+
+// Permission contains an action on an object
+// swagger:model RBACPermission
+type Permission struct {
+	// The object or * for any object
+	// example: country
+	Object string `json:"object" validate:"required,max=100"`
+	// The action or * for any action
+	// example: view_all
+	Action string `json:"action" validate:"required,max=100"`
+}
+
+// CheckData contains the permissions to check
+// swagger:model RBACCheckData
+type CheckData struct {
+	// Checks this role instead of the current user one, requires the permission to view the policies
+	// example: user
+	Role string `json:"role,omitempty" validate:"omitempty,max=100"`
+	// example: [{"object": "country", "action": "create_all"}, {"object": "user", "action": "view_all"}]
+	Checks []Permission `json:"checks" validate:"required,min=1,max=100,dive"`
+}
+
+// CheckResult contains the result of a permission check
+// swagger:model RBACCheckResult
+type CheckResult struct {
+	// example: country
+	Object string `json:"object"`
+	// example: create_all
+	Action string `json:"action"`
+	// example: true
+	Allowed bool `json:"allowed"`
+}
+
+// PermissionListResp contains list of permissions
+// swagger:model RBACPermissionListResp
+type PermissionListResp struct {
+	Data []*Permission `json:"data"`
+}
+
+// CheckResp contains the results of the permission checks
+// swagger:model RBACCheckResp
+type CheckResp struct {
+	Data []*CheckResult `json:"data"`
+}
+
+// PolicyListResp contains list of policies
+// swagger:model RBACPolicyListResp
+type PolicyListResp struct {
+	Data []*Rule `json:"data"`
+}
+
+// RoleListResp contains list of roles
+// swagger:model RBACRoleListResp
+type RoleListResp struct {
+	Data []*Role `json:"data"`
+}
+
+func (h *HTTP) listPolicies(c echo.Context) error {
+	resp, err := h.svc.ListPolicies(h.auth.User(c), c.QueryParam("role"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, PolicyListResp{resp})
+}
+
+func (h *HTTP) addPolicy(c echo.Context) error {
+	r := Rule{}
+	if err := c.Bind(&r); err != nil {
+		return err
+	}
+	if err := h.svc.AddPolicy(h.auth.User(c), r); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *HTTP) removePolicy(c echo.Context) error {
+	r := Rule{}
+	if err := c.Bind(&r); err != nil {
+		return err
+	}
+	if err := h.svc.RemovePolicy(h.auth.User(c), r); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *HTTP) listRoles(c echo.Context) error {
+	resp, err := h.svc.ListRoles(h.auth.User(c))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, RoleListResp{resp})
+}
+
+func (h *HTTP) addInheritance(c echo.Context) error {
+	r := Inheritance{}
+	if err := c.Bind(&r); err != nil {
+		return err
+	}
+	if err := h.svc.AddInheritance(h.auth.User(c), r); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *HTTP) removeInheritance(c echo.Context) error {
+	r := Inheritance{}
+	if err := c.Bind(&r); err != nil {
+		return err
+	}
+	if err := h.svc.RemoveInheritance(h.auth.User(c), r); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *HTTP) myPermissions(c echo.Context) error {
+	resp, err := h.svc.MyPermissions(h.auth.User(c))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, PermissionListResp{resp})
+}
+
+func (h *HTTP) check(c echo.Context) error {
+	r := CheckData{}
+	if err := c.Bind(&r); err != nil {
+		return err
+	}
+	resp, err := h.svc.Check(h.auth.User(c), r)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, CheckResp{resp})
+}
@@ -0,0 +1,246 @@
+package policy
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/M15t/ghoul/internal/model"
+	"github.com/M15t/ghoul/pkg/rbac"
+	"github.com/M15t/ghoul/pkg/server"
+)
+
+// Custom errors
+var (
+	ErrPolicyExisted          = server.NewHTTPError(http.StatusBadRequest, "POLICY_EXISTED", "Policy already exists")
+	ErrPolicyNotFound         = server.NewHTTPError(http.StatusBadRequest, "POLICY_NOTFOUND", "Policy not found")
+	ErrInheritanceExisted     = server.NewHTTPError(http.StatusBadRequest, "ROLE_INHERITANCE_EXISTED", "Role already inherits the given role")
+	ErrInheritanceNotFound    = server.NewHTTPError(http.StatusBadRequest, "ROLE_INHERITANCE_NOTFOUND", "Role does not inherit the given role")
+	ErrInheritanceCycle       = server.NewHTTPValidationError("Role may not inherit itself or the roles inheriting it")
+	ErrProtectedRole          = server.NewHTTPError(http.StatusBadRequest, "PROTECTED_ROLE", "The superadmin role may not be modified")
+	ErrPolicyChangeNotAllowed = server.NewHTTPError(http.StatusForbidden, "POLICY_CHANGE_NOT_ALLOWED", "Policies may not be changed when authenticated by an API key or impersonating")
+)
+
+// ListPolicies returns the policies, of the given role only if not empty
+func (s *Policy) ListPolicies(authUsr *model.AuthUser, role string) ([]*Rule, error) {
+	if err := s.enforce(authUsr, model.ActionViewAll); err != nil {
+		return nil, err
+	}
+
+	rules := s.rbac.GetPolicy()
+	if role != "" {
+		rules = s.rbac.GetFilteredPolicy(0, role)
+	}
+
+	data := make([]*Rule, 0, len(rules))
+	for _, r := range rules {
+		if len(r) < 3 {
+			continue
+		}
+		data = append(data, &Rule{Role: r[0], Object: r[1], Action: r[2]})
+	}
+
+	return data, nil
+}
+
+// AddPolicy grants the permission to the role
+func (s *Policy) AddPolicy(authUsr *model.AuthUser, data Rule) error {
+	if err := s.enforceChange(authUsr, data.Role, model.ActionCreateAll); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	added, err := s.rbac.AddPolicySafe(data.Role, data.Object, data.Action)
+	if err != nil {
+		return s.reload("Error adding policy", err)
+	}
+	if !added {
+		return ErrPolicyExisted
+	}
+
+	return nil
+}
+
+// RemovePolicy revokes the permission from the role
+func (s *Policy) RemovePolicy(authUsr *model.AuthUser, data Rule) error {
+	if err := s.enforceChange(authUsr, data.Role, model.ActionDeleteAll); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed, err := s.rbac.RemovePolicySafe(data.Role, data.Object, data.Action)
+	if err != nil {
+		return s.reload("Error removing policy", err)
+	}
+	if !removed {
+		return ErrPolicyNotFound
+	}
+
+	return nil
+}
+
+// ListRoles returns the roles having policies or being inherited, with the roles they directly inherit
+func (s *Policy) ListRoles(authUsr *model.AuthUser) ([]*Role, error) {
+	if err := s.enforce(authUsr, model.ActionViewAll); err != nil {
+		return nil, err
+	}
+
+	roles := map[string]*Role{}
+	role := func(name string) *Role {
+		if roles[name] == nil {
+			roles[name] = &Role{Name: name, Inherits: []string{}}
+		}
+		return roles[name]
+	}
+	for _, r := range s.rbac.GetPolicy() {
+		role(r[0])
+	}
+	for _, r := range s.rbac.GetGroupingPolicy() {
+		if len(r) < 2 {
+			continue
+		}
+		role(r[1])
+		role(r[0]).Inherits = append(role(r[0]).Inherits, r[1])
+	}
+
+	data := make([]*Role, 0, len(roles))
+	for _, r := range roles {
+		sort.Strings(r.Inherits)
+		data = append(data, r)
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].Name < data[j].Name })
+
+	return data, nil
+}
+
+// AddInheritance makes the role inherit all permissions of the other role
+func (s *Policy) AddInheritance(authUsr *model.AuthUser, data Inheritance) error {
+	if err := s.enforceChange(authUsr, data.Role, model.ActionCreateAll); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if data.Role == data.Inherits {
+		return ErrInheritanceCycle
+	}
+	for _, r := range s.rbac.GetImplicitRolesForUser(data.Inherits) {
+		if r == data.Role {
+			return ErrInheritanceCycle
+		}
+	}
+
+	added, err := s.rbac.AddGroupingPolicySafe(data.Role, data.Inherits)
+	if err != nil {
+		return s.reload("Error adding role inheritance", err)
+	}
+	if !added {
+		return ErrInheritanceExisted
+	}
+
+	return nil
+}
+
+// RemoveInheritance stops the role inheriting the permissions of the other role
+func (s *Policy) RemoveInheritance(authUsr *model.AuthUser, data Inheritance) error {
+	if err := s.enforceChange(authUsr, data.Role, model.ActionDeleteAll); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed, err := s.rbac.RemoveGroupingPolicySafe(data.Role, data.Inherits)
+	if err != nil {
+		return s.reload("Error removing role inheritance", err)
+	}
+	if !removed {
+		return ErrInheritanceNotFound
+	}
+
+	return nil
+}
+
+// MyPermissions returns the effective permissions of the user role, including the ones of the inherited roles
+func (s *Policy) MyPermissions(authUsr *model.AuthUser) ([]*Permission, error) {
+	seen := map[Permission]bool{}
+	data := []*Permission{}
+	for _, r := range s.rbac.GetImplicitPermissionsForUser(authUsr.Role) {
+		if len(r) < 3 {
+			continue
+		}
+		p := Permission{Object: r[1], Action: r[2]}
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		data = append(data, &p)
+	}
+	sort.Slice(data, func(i, j int) bool {
+		if data[i].Object != data[j].Object {
+			return data[i].Object < data[j].Object
+		}
+		return data[i].Action < data[j].Action
+	})
+
+	return data, nil
+}
+
+// Check answers whether the user role, or the given role, may perform each of the actions.
+// Checking another role requires the permission to view the policies.
+func (s *Policy) Check(authUsr *model.AuthUser, data CheckData) ([]*CheckResult, error) {
+	role := authUsr.Role
+	if data.Role != "" && data.Role != role {
+		if err := s.enforce(authUsr, model.ActionViewAll); err != nil {
+			return nil, err
+		}
+		role = data.Role
+	}
+
+	results := make([]*CheckResult, len(data.Checks))
+	for i, p := range data.Checks {
+		results[i] = &CheckResult{
+			Object:  p.Object,
+			Action:  p.Action,
+			Allowed: s.rbac.Enforce(role, p.Object, p.Action),
+		}
+	}
+
+	return results, nil
+}
+
+// reload restores the enforcer from the database after a failed change, which may have been applied in memory only
+func (s *Policy) reload(msg string, err error) error {
+	if lerr := s.rbac.LoadPolicy(); lerr != nil {
+		err = lerr
+	}
+	return server.NewHTTPInternalError(msg).SetInternal(err)
+}
+
+// enforce checks user permission to perform the action on the policies
+func (s *Policy) enforce(authUsr *model.AuthUser, action string) error {
+	if !s.rbac.Enforce(authUsr.Role, model.ObjectRBAC, action) {
+		return rbac.ErrForbiddenAction
+	}
+	return nil
+}
+
+// enforceChange checks user permission to change the policies of the role.
+// The policies may only be changed by the interactive logins, neither by API keys nor by impersonators.
+// The superadmin role is protected so it may not lock itself out.
+func (s *Policy) enforceChange(authUsr *model.AuthUser, role string, action string) error {
+	if len(authUsr.Scopes) > 0 || authUsr.Actor != nil {
+		return ErrPolicyChangeNotAllowed
+	}
+	if err := s.enforce(authUsr, action); err != nil {
+		return err
+	}
+	if role == model.RoleSuperAdmin {
+		return ErrProtectedRole
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package policy
+
+import (
+	"sync"
+)
+
+// New creates new RBAC policy application service
+func New(rbacSvc RBAC) *Policy {
+	return &Policy{rbac: rbacSvc}
+}
+
+// Policy represents RBAC policy application service
+type Policy struct {
+	rbac RBAC
+	// mu serializes the policy changes, which update both the enforcer & the database
+	mu sync.Mutex
+}
+
+// RBAC represents the RBAC enforcer persisting its policies
+type RBAC interface {
+	Enforce(rvals ...interface{}) bool
+	GetPolicy() [][]string
+	GetFilteredPolicy(fieldIndex int, fieldValues ...string) [][]string
+	GetGroupingPolicy() [][]string
+	GetImplicitRolesForUser(name string, domain ...string) []string
+	GetImplicitPermissionsForUser(user string, domain ...string) [][]string
+	AddPolicySafe(params ...interface{}) (bool, error)
+	RemovePolicySafe(params ...interface{}) (bool, error)
+	AddGroupingPolicySafe(params ...interface{}) (bool, error)
+	RemoveGroupingPolicySafe(params ...interface{}) (bool, error)
+	LoadPolicy() error
+}
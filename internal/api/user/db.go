@@ -25,12 +25,3 @@ func (d *DB) FindByUsername(db *gorm.DB, uname string) (*model.User, error) {
 	}
 	return rec, nil
 }
-
-// FindByRefreshToken queries for single user by refresh token
-func (d *DB) FindByRefreshToken(db *gorm.DB, token string) (*model.User, error) {
-	rec := new(model.User)
-	if err := d.View(db, rec, "refresh_token = ?", token); err != nil {
-		return nil, err
-	}
-	return rec, nil
-}
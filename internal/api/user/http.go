@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/M15t/ghoul/internal/model"
+	"github.com/M15t/ghoul/pkg/rbac"
 	"github.com/M15t/ghoul/pkg/server"
 	dbutil "github.com/M15t/ghoul/pkg/util/db"
 	httputil "github.com/M15t/ghoul/pkg/util/http"
@@ -25,10 +26,29 @@ type Service interface {
 	List(*model.AuthUser, *dbutil.ListQueryCondition, *int64) ([]*model.User, error)
 	Update(*model.AuthUser, int, UpdateData) (*model.User, error)
 	Delete(*model.AuthUser, int) error
+	Restore(*model.AuthUser, int) (*model.User, error)
+	Unlock(*model.AuthUser, int) (*model.User, error)
+	Impersonate(*model.AuthUser, int) (*model.AuthToken, error)
 	Me(*model.AuthUser) (*model.User, error)
 	ChangePassword(*model.AuthUser, PasswordChangeData) error
 }
 
+// ListFields are the fields the users may be sorted and filtered by, see the list tags of model.User
+var ListFields = dbutil.NewListFields(model.User{})
+
+// Permissions of the user routes, enforced by the rbac.Middleware.
+// The owner-scoped actions are allowed through the owned routes, the service checks the ownership.
+var Permissions = []rbac.Permission{
+	{Method: http.MethodPost, Path: "", Object: model.ObjectUser, Action: model.ActionCreateAll},
+	{Method: http.MethodGet, Path: "/:id", Object: model.ObjectUser, Action: model.ActionViewAll, Owned: true},
+	{Method: http.MethodGet, Path: "", Object: model.ObjectUser, Action: model.ActionViewAll, Owned: true},
+	{Method: http.MethodPatch, Path: "/:id", Object: model.ObjectUser, Action: model.ActionUpdateAll, Owned: true},
+	{Method: http.MethodDelete, Path: "/:id", Object: model.ObjectUser, Action: model.ActionDeleteAll, Owned: true},
+	{Method: http.MethodPost, Path: "/:id/restore", Object: model.ObjectUser, Action: model.ActionRestore},
+	{Method: http.MethodPost, Path: "/:id/unlock", Object: model.ObjectUser, Action: model.ActionUpdateAll},
+	{Method: http.MethodPost, Path: "/:id/impersonate", Object: model.ObjectImpersonation, Action: model.ActionCreate},
+}
+
 // NewHTTP creates new user http service
 func NewHTTP(svc Service, auth model.Auth, eg *echo.Group) {
 	h := HTTP{svc, auth}
@@ -72,6 +92,10 @@ func NewHTTP(svc Service, auth model.Auth, eg *echo.Group) {
 	//     description: The user
 	//     schema:
 	//       "$ref": "#/definitions/User"
+	//     headers:
+	//       ETag:
+	//         description: Version of the user, to send in the If-Match header of the update
+	//         type: string
 	//   "400":
 	//     "$ref": "#/responses/errDetails"
 	//   "401":
@@ -117,6 +141,10 @@ func NewHTTP(svc Service, auth model.Auth, eg *echo.Group) {
 	//   required: true
 	//   schema:
 	//     "$ref": "#/definitions/UserUpdateData"
+	// - name: If-Match
+	//   in: header
+	//   description: ETag of the user, the update is rejected if it has been modified since
+	//   type: string
 	// responses:
 	//   "200":
 	//     description: The updated user
@@ -130,6 +158,8 @@ func NewHTTP(svc Service, auth model.Auth, eg *echo.Group) {
 	//     "$ref": "#/responses/errDetails"
 	//   "404":
 	//     "$ref": "#/responses/errDetails"
+	//   "412":
+	//     "$ref": "#/responses/errDetails"
 	//   "500":
 	//     "$ref": "#/responses/errDetails"
 	eg.PATCH("/:id", h.update)
@@ -158,6 +188,81 @@ func NewHTTP(svc Service, auth model.Auth, eg *echo.Group) {
 	//     "$ref": "#/responses/errDetails"
 	eg.DELETE("/:id", h.delete)
 
+	// swagger:operation POST /v1/users/{id}/restore users usersRestore
+	// ---
+	// summary: Restores a deleted user
+	// parameters:
+	// - name: id
+	//   in: path
+	//   description: id of user
+	//   type: integer
+	//   required: true
+	// responses:
+	//   "200":
+	//     description: The restored user
+	//     schema:
+	//       "$ref": "#/definitions/User"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "403":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	eg.POST("/:id/restore", h.restore)
+
+	// swagger:operation POST /v1/users/{id}/unlock users usersUnlock
+	// ---
+	// summary: Unlocks an user account locked out by too many failed login attempts
+	// parameters:
+	// - name: id
+	//   in: path
+	//   description: id of user
+	//   type: integer
+	//   required: true
+	// responses:
+	//   "200":
+	//     description: The unlocked user
+	//     schema:
+	//       "$ref": "#/definitions/User"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "403":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	eg.POST("/:id/unlock", h.unlock)
+
+	// swagger:operation POST /v1/users/{id}/impersonate users usersImpersonate
+	// ---
+	// summary: Issues a short-lived access token acting as the user
+	// description: The token carries the `act` claim identifying the impersonator, it has no refresh token.
+	//   Users allowed to impersonate others may not be impersonated.
+	//   Passwords, two-factor authentication & API keys may not be managed while impersonating.
+	// parameters:
+	// - name: id
+	//   in: path
+	//   description: id of user
+	//   type: integer
+	//   required: true
+	// responses:
+	//   "200":
+	//     description: Access token of the user
+	//     schema:
+	//       "$ref": "#/definitions/AuthToken"
+	//   "400":
+	//     "$ref": "#/responses/errDetails"
+	//   "401":
+	//     "$ref": "#/responses/errDetails"
+	//   "403":
+	//     "$ref": "#/responses/errDetails"
+	//   "500":
+	//     "$ref": "#/responses/errDetails"
+	eg.POST("/:id/impersonate", h.impersonate)
+
 	// swagger:operation GET /v1/users/me users usersMe
 	// ---
 	// summary: Returns authenticated user
@@ -199,14 +304,17 @@ func NewHTTP(svc Service, auth model.Auth, eg *echo.Group) {
 // CreationData contains user data from json request
 // swagger:model UserCreationData
 type CreationData struct {
-	Username  string `json:"username" validate:"required,min=3"`
-	Password  string `json:"password" validate:"required,min=8"`
+	Username string `json:"username" validate:"required,min=3"`
+	// Not required for service accounts
+	Password  string `json:"password" validate:"required_without=ServiceAccount,omitempty,min=8"`
 	FirstName string `json:"first_name" validate:"required"`
 	LastName  string `json:"last_name" validate:"required"`
 	Email     string `json:"email" validate:"required,email"`
 	Mobile    string `json:"mobile" validate:"required,mobile"`
 	Role      string `json:"role" validate:"required"`
 	Blocked   bool   `json:"blocked"`
+	// Service accounts may only authenticate by API keys
+	ServiceAccount bool `json:"service_account"`
 }
 
 // UpdateData contains user data from json request
@@ -218,6 +326,8 @@ type UpdateData struct {
 	Mobile    *string `json:"mobile,omitempty" validate:"omitempty,mobile"`
 	Role      *string `json:"role,omitempty"`
 	Blocked   *bool   `json:"blocked,omitempty"`
+	// Version is the expected version of the user, from the If-Match header
+	Version *int `json:"-"`
 }
 
 // PasswordChangeData contains password change request
@@ -233,6 +343,8 @@ type PasswordChangeData struct {
 type ListResp struct {
 	Data       []*model.User `json:"data"`
 	TotalCount int64         `json:"total_count"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+	PrevCursor string        `json:"prev_cursor,omitempty"`
 }
 
 func (h *HTTP) create(c echo.Context) error {
@@ -268,11 +380,12 @@ func (h *HTTP) view(c echo.Context) error {
 		return err
 	}
 
+	httputil.SetETag(c, resp.Version)
 	return c.JSON(http.StatusOK, resp)
 }
 
 func (h *HTTP) list(c echo.Context) error {
-	lq, err := httputil.ReqListQuery(c)
+	lq, err := httputil.ReqListQuery(c, ListFields)
 	if err != nil {
 		return err
 	}
@@ -282,7 +395,7 @@ func (h *HTTP) list(c echo.Context) error {
 		return err
 	}
 
-	return c.JSON(http.StatusOK, ListResp{resp, count})
+	return c.JSON(http.StatusOK, ListResp{resp, count, lq.NextCursor, lq.PrevCursor})
 }
 
 func (h *HTTP) update(c echo.Context) error {
@@ -303,12 +416,16 @@ func (h *HTTP) update(c echo.Context) error {
 	if err := validateRole(r.Role); err != nil {
 		return err
 	}
+	if r.Version, err = httputil.ReqIfMatch(c); err != nil {
+		return err
+	}
 
 	resp, err := h.svc.Update(h.auth.User(c), id, r)
 	if err != nil {
 		return err
 	}
 
+	httputil.SetETag(c, resp.Version)
 	return c.JSON(http.StatusOK, resp)
 }
 
@@ -324,6 +441,45 @@ func (h *HTTP) delete(c echo.Context) error {
 	return c.NoContent(http.StatusOK)
 }
 
+func (h *HTTP) restore(c echo.Context) error {
+	id, err := httputil.ReqID(c)
+	if err != nil {
+		return err
+	}
+	resp, err := h.svc.Restore(h.auth.User(c), id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (h *HTTP) unlock(c echo.Context) error {
+	id, err := httputil.ReqID(c)
+	if err != nil {
+		return err
+	}
+	resp, err := h.svc.Unlock(h.auth.User(c), id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (h *HTTP) impersonate(c echo.Context) error {
+	id, err := httputil.ReqID(c)
+	if err != nil {
+		return err
+	}
+	resp, err := h.svc.Impersonate(h.auth.User(c), id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
 func (h *HTTP) me(c echo.Context) error {
 	resp, err := h.svc.Me(h.auth.User(c))
 	if err != nil {
@@ -9,8 +9,8 @@ import (
 )
 
 // New creates new user application service
-func New(db *gorm.DB, udb MyDB, rbacSvc rbac.Intf, cr Crypter) *User {
-	return &User{db: db, udb: udb, rbac: rbacSvc, cr: cr}
+func New(db *gorm.DB, udb MyDB, rbacSvc rbac.Intf, cr Crypter, sess SessionRevoker, pwd PasswordPolicy, imp Impersonator) *User {
+	return &User{db: db, udb: udb, rbac: rbacSvc, cr: cr, sess: sess, pwd: pwd, imp: imp}
 }
 
 // User represents user application service
@@ -19,6 +19,9 @@ type User struct {
 	udb  MyDB
 	rbac rbac.Intf
 	cr   Crypter
+	sess SessionRevoker
+	pwd  PasswordPolicy
+	imp  Impersonator
 }
 
 // MyDB represents user repository interface
@@ -30,5 +33,22 @@ type MyDB interface {
 // Crypter represents security interface
 type Crypter interface {
 	CompareHashAndPassword(hasedPwd string, rawPwd string) bool
-	HashPassword(string) string
+	HashPassword(string) (string, error)
+	UID() string
+}
+
+// SessionRevoker represents the service revoking all sessions & access tokens of an user
+type SessionRevoker interface {
+	RevokeUserSessions(int) error
+}
+
+// PasswordPolicy represents the service validating passwords and keeping their history
+type PasswordPolicy interface {
+	ValidatePassword(*model.User, string) error
+	RecordPassword(db *gorm.DB, uid int, hash string) error
+}
+
+// Impersonator represents the service issuing impersonation tokens
+type Impersonator interface {
+	Impersonate(actor *model.AuthUser, u *model.User) (*model.AuthToken, error)
 }
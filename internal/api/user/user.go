@@ -1,13 +1,17 @@
 package user
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/M15t/ghoul/internal/model"
 	"github.com/M15t/ghoul/pkg/rbac"
 	"github.com/M15t/ghoul/pkg/server"
 	dbutil "github.com/M15t/ghoul/pkg/util/db"
 	structutil "github.com/M15t/ghoul/pkg/util/struct"
+
+	"gorm.io/gorm"
 )
 
 // Custom errors
@@ -15,30 +19,58 @@ var (
 	ErrIncorrectPassword = server.NewHTTPError(http.StatusBadRequest, "INCORRECT_PASSWORD", "Incorrect old password")
 	ErrUserNotFound      = server.NewHTTPError(http.StatusBadRequest, "USER_NOTFOUND", "User not found")
 	ErrUsernameExisted   = server.NewHTTPValidationError("Username already existed")
+	ErrServiceAccount    = server.NewHTTPError(http.StatusBadRequest, "SERVICE_ACCOUNT", "Service accounts have no password")
+	ErrImpersonating     = server.NewHTTPError(http.StatusForbidden, "IMPERSONATING", "This action is not allowed while impersonating")
+	ErrNotImpersonatable = server.NewHTTPError(http.StatusForbidden, "NOT_IMPERSONATABLE", "This user may not be impersonated")
+	ErrUserModified      = server.NewHTTPConflictError("User has been modified, please reload and try again")
 )
 
 // Create creates a new user account
 func (s *User) Create(authUsr *model.AuthUser, data CreationData) (*model.User, error) {
-	if err := s.enforce(authUsr, model.ActionCreateAll); err != nil {
+	if err := s.enforce(authUsr, model.ActionCreateAll, 0); err != nil {
 		return nil, err
 	}
 
-	if existed, err := s.udb.Exist(s.db, map[string]interface{}{"username": data.Username}); err != nil || existed {
+	// the usernames of the deleted users are kept until they are purged, so they may be restored
+	if existed, err := s.udb.Exist(dbutil.WithDeleted(s.db), map[string]interface{}{"username": data.Username}); err != nil || existed {
 		return nil, ErrUsernameExisted.SetInternal(err)
 	}
 
+	// accounts created by admins do not need the email verification
+	now := time.Now()
 	rec := &model.User{
-		FirstName: data.FirstName,
-		LastName:  data.LastName,
-		Email:     data.Email,
-		Mobile:    data.Mobile,
-		Username:  data.Username,
-		Password:  s.cr.HashPassword(data.Password),
-		Blocked:   data.Blocked,
-		Role:      data.Role,
+		FirstName:       data.FirstName,
+		LastName:        data.LastName,
+		Email:           data.Email,
+		Mobile:          data.Mobile,
+		Username:        data.Username,
+		EmailVerifiedAt: &now,
+		Blocked:         data.Blocked,
+		ServiceAccount:  data.ServiceAccount,
+		Role:            data.Role,
+	}
+	// service accounts never login by password, theirs is random
+	password := data.Password
+	if rec.ServiceAccount {
+		password = s.cr.UID()
+	} else if err := s.pwd.ValidatePassword(rec, password); err != nil {
+		return nil, err
+	}
+	hashedPwd, err := s.cr.HashPassword(password)
+	if err != nil {
+		return nil, server.NewHTTPInternalError("Error hashing password").SetInternal(err)
 	}
+	rec.Password = hashedPwd
 
-	if err := s.udb.Create(s.db, rec); err != nil {
+	if err := dbutil.Transaction(s.db, func(tx *gorm.DB) error {
+		if err := s.udb.Create(tx, rec); err != nil {
+			return err
+		}
+		if rec.ServiceAccount {
+			return nil
+		}
+		return s.pwd.RecordPassword(tx, rec.ID, hashedPwd)
+	}); err != nil {
 		return nil, server.NewHTTPInternalError("Error creating user").SetInternal(err)
 	}
 
@@ -47,7 +79,7 @@ func (s *User) Create(authUsr *model.AuthUser, data CreationData) (*model.User,
 
 // View returns single user
 func (s *User) View(authUsr *model.AuthUser, id int) (*model.User, error) {
-	if err := s.enforce(authUsr, model.ActionViewAll); err != nil {
+	if err := s.enforce(authUsr, model.ActionViewAll, id); err != nil {
 		return nil, err
 	}
 
@@ -61,12 +93,20 @@ func (s *User) View(authUsr *model.AuthUser, id int) (*model.User, error) {
 
 // List returns list of users
 func (s *User) List(authUsr *model.AuthUser, lq *dbutil.ListQueryCondition, count *int64) ([]*model.User, error) {
-	if err := s.enforce(authUsr, model.ActionViewAll); err != nil {
+	// users allowed to view themselves only list themselves
+	lq, err := rbac.EnforceList(s.rbac, authUsr.Role, model.ObjectUser, model.ActionViewAll, authUsr.ID, "id", lq)
+	if err != nil {
 		return nil, err
 	}
+	if lq != nil && lq.IncludeDeleted && !s.rbac.Enforce(authUsr.Role, model.ObjectUser, model.ActionRestore) {
+		return nil, rbac.ErrForbiddenAction
+	}
 
 	var data []*model.User
 	if err := s.udb.List(s.db, &data, lq, count); err != nil {
+		if errors.Is(err, dbutil.ErrInvalidCursor) {
+			return nil, server.NewHTTPValidationError("Invalid cursor").SetInternal(err)
+		}
 		return nil, server.NewHTTPInternalError("Error listing user").SetInternal(err)
 	}
 
@@ -75,16 +115,33 @@ func (s *User) List(authUsr *model.AuthUser, lq *dbutil.ListQueryCondition, coun
 
 // Update updates user information
 func (s *User) Update(authUsr *model.AuthUser, id int, data UpdateData) (*model.User, error) {
-	if err := s.enforce(authUsr, model.ActionUpdateAll); err != nil {
+	if err := s.enforce(authUsr, model.ActionUpdateAll, id); err != nil {
 		return nil, err
 	}
+	// the owners may not change their own role or blocked status, to prevent the privilege escalation
+	if (data.Role != nil || data.Blocked != nil) && !s.rbac.Enforce(authUsr.Role, model.ObjectUser, model.ActionUpdateAll) {
+		return nil, rbac.ErrForbiddenAction
+	}
 
-	// optimistic update
+	// optimistic update, rejected if the user has been modified since the given version
 	updates := structutil.ToMap(data)
+	if data.Version != nil {
+		updates[dbutil.VersionColumn] = *data.Version
+	}
 	if err := s.udb.Update(s.db, updates, id); err != nil {
+		if errors.Is(err, dbutil.ErrVersionConflict) {
+			return nil, ErrUserModified.SetInternal(err)
+		}
 		return nil, server.NewHTTPInternalError("Error updating user").SetInternal(err)
 	}
 
+	// blocked user must not keep the access until the token expires
+	if data.Blocked != nil && *data.Blocked {
+		if err := s.sess.RevokeUserSessions(id); err != nil {
+			return nil, err
+		}
+	}
+
 	rec := new(model.User)
 	if err := s.udb.View(s.db, rec, id); err != nil {
 		return nil, ErrUserNotFound.SetInternal(err)
@@ -95,7 +152,7 @@ func (s *User) Update(authUsr *model.AuthUser, id int, data UpdateData) (*model.
 
 // Delete deletes a user
 func (s *User) Delete(authUsr *model.AuthUser, id int) error {
-	if err := s.enforce(authUsr, model.ActionDeleteAll); err != nil {
+	if err := s.enforce(authUsr, model.ActionDeleteAll, id); err != nil {
 		return err
 	}
 
@@ -107,9 +164,75 @@ func (s *User) Delete(authUsr *model.AuthUser, id int) error {
 		return server.NewHTTPInternalError("Error deleting user").SetInternal(err)
 	}
 
+	if err := s.sess.RevokeUserSessions(id); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// Restore restores a deleted user
+func (s *User) Restore(authUsr *model.AuthUser, id int) (*model.User, error) {
+	if err := s.enforce(authUsr, model.ActionRestore, 0); err != nil {
+		return nil, err
+	}
+
+	if existed, err := s.udb.Exist(dbutil.WithDeleted(s.db), id); err != nil || !existed {
+		return nil, ErrUserNotFound.SetInternal(err)
+	}
+
+	if err := s.udb.Restore(s.db, id); err != nil {
+		return nil, server.NewHTTPInternalError("Error restoring user").SetInternal(err)
+	}
+
+	rec := new(model.User)
+	if err := s.udb.View(s.db, rec, id); err != nil {
+		return nil, ErrUserNotFound.SetInternal(err)
+	}
+
+	return rec, nil
+}
+
+// Unlock resets the failed login attempts of a user, unlocking the account
+func (s *User) Unlock(authUsr *model.AuthUser, id int) (*model.User, error) {
+	// the locked users may not unlock themselves
+	if !s.rbac.Enforce(authUsr.Role, model.ObjectUser, model.ActionUpdateAll) {
+		return nil, rbac.ErrForbiddenAction
+	}
+
+	if err := s.udb.Update(s.db, map[string]interface{}{"failed_login_count": 0, "locked_until": nil}, id); err != nil {
+		return nil, server.NewHTTPInternalError("Error unlocking user").SetInternal(err)
+	}
+
+	rec := new(model.User)
+	if err := s.udb.View(s.db, rec, id); err != nil {
+		return nil, ErrUserNotFound.SetInternal(err)
+	}
+
+	return rec, nil
+}
+
+// Impersonate issues a short-lived access token acting as the given user.
+// Users who may impersonate others (e.g: admins) may not be impersonated, to prevent the privilege escalation.
+func (s *User) Impersonate(authUsr *model.AuthUser, id int) (*model.AuthToken, error) {
+	if authUsr.Actor != nil || len(authUsr.Scopes) > 0 {
+		return nil, ErrImpersonating
+	}
+	if !s.rbac.Enforce(authUsr.Role, model.ObjectImpersonation, model.ActionCreate) {
+		return nil, rbac.ErrForbiddenAction
+	}
+
+	rec := new(model.User)
+	if err := s.udb.View(s.db, rec, id); err != nil {
+		return nil, ErrUserNotFound.SetInternal(err)
+	}
+	if rec.ID == authUsr.ID || rec.Blocked || s.rbac.Enforce(rec.Role, model.ObjectImpersonation, model.ActionCreate) {
+		return nil, ErrNotImpersonatable
+	}
+
+	return s.imp.Impersonate(authUsr, rec)
+}
+
 // Me returns authenticated user
 func (s *User) Me(authUsr *model.AuthUser) (*model.User, error) {
 	rec := new(model.User)
@@ -121,27 +244,43 @@ func (s *User) Me(authUsr *model.AuthUser) (*model.User, error) {
 
 // ChangePassword changes authenticated user password
 func (s *User) ChangePassword(authUsr *model.AuthUser, data PasswordChangeData) error {
+	if authUsr.Actor != nil {
+		return ErrImpersonating
+	}
 	rec, err := s.Me(authUsr)
 	if err != nil {
 		return err
 	}
 
+	if rec.ServiceAccount {
+		return ErrServiceAccount
+	}
 	if !s.cr.CompareHashAndPassword(rec.Password, data.OldPassword) {
 		return ErrIncorrectPassword
 	}
 
-	hashedPwd := s.cr.HashPassword(data.NewPassword)
-	if err = s.udb.Update(s.db, map[string]interface{}{"password": hashedPwd}, rec.ID); err != nil {
+	if err := s.pwd.ValidatePassword(rec, data.NewPassword); err != nil {
+		return err
+	}
+	hashedPwd, err := s.cr.HashPassword(data.NewPassword)
+	if err != nil {
+		return server.NewHTTPInternalError("Error hashing password").SetInternal(err)
+	}
+
+	if err = dbutil.Transaction(s.db, func(tx *gorm.DB) error {
+		if err := s.udb.Update(tx, map[string]interface{}{"password": hashedPwd}, rec.ID); err != nil {
+			return err
+		}
+		return s.pwd.RecordPassword(tx, rec.ID, hashedPwd)
+	}); err != nil {
 		return server.NewHTTPInternalError("Error changing password").SetInternal(err)
 	}
 
 	return nil
 }
 
-// enforce checks user permission to perform the action
-func (s *User) enforce(authUsr *model.AuthUser, action string) error {
-	if !s.rbac.Enforce(authUsr.Role, model.ObjectUser, action) {
-		return rbac.ErrForbiddenAction
-	}
-	return nil
+// enforce checks user permission to perform the action on the given user, falling back to the owner-scoped action
+// if the user is the authenticated one
+func (s *User) enforce(authUsr *model.AuthUser, action string, id int) error {
+	return rbac.EnforceOwner(s.rbac, authUsr.Role, model.ObjectUser, action, authUsr.ID, id)
 }
@@ -19,6 +19,12 @@ import (
 // EnablePostgreSQL: remove this and all tx.Set() functions bellow
 var defaultTableOpts = "ENGINE=InnoDB ROW_FORMAT=DYNAMIC"
 
+// versionedTables are the tables of the models embedding model.Base
+var versionedTables = []string{
+	"users", "countries", "sessions", "api_keys", "user_tokens", "recovery_codes",
+	"oauth_states", "user_identities", "organizations", "memberships",
+}
+
 // Base represents base columns for all tables. Do not use gorm.Model because of uint ID
 type Base struct {
 	ID        int `gorm:"primary_key"`
@@ -125,7 +131,11 @@ func Run() (respErr error) {
 					if usr.Password == "" {
 						usr.Password = usr.Username + "123!@#"
 					}
-					usr.Password = crypter.HashPassword(usr.Password)
+					hashedPwd, err := crypter.HashPassword(usr.Password)
+					if err != nil {
+						return err
+					}
+					usr.Password = hashedPwd
 					if err := tx.Create(usr).Error; err != nil {
 						return err
 					}
@@ -151,6 +161,458 @@ func Run() (respErr error) {
 				return tx.Migrator().DropTable("users", "countries")
 			},
 		},
+		// replace users.refresh_token with per-device sessions
+		{
+			ID: "202610180900",
+			Migrate: func(tx *gorm.DB) error {
+				type Session struct {
+					Base
+					UserID     int    `gorm:"not null;index"`
+					FamilyID   string `gorm:"type:varchar(255);uniqueIndex;not null"`
+					TokenHash  string `gorm:"type:varchar(255);not null"`
+					UserAgent  string `gorm:"type:varchar(255)"`
+					IP         string `gorm:"type:varchar(45)"`
+					LastUsedAt *time.Time
+					ExpiresAt  *time.Time
+					RevokedAt  *time.Time
+				}
+
+				if err := tx.Set("gorm:table_options", defaultTableOpts).AutoMigrate(&Session{}); err != nil {
+					return err
+				}
+
+				return tx.Migrator().DropColumn("users", "refresh_token")
+			},
+			Rollback: func(tx *gorm.DB) error {
+				type User struct {
+					RefreshToken string `gorm:"type:varchar(255)"`
+				}
+
+				if err := tx.Migrator().AddColumn(&User{}, "RefreshToken"); err != nil {
+					return err
+				}
+
+				return tx.Migrator().DropTable("sessions")
+			},
+		},
+		// deny-list of revoked access tokens
+		{
+			ID: "202610180930",
+			Migrate: func(tx *gorm.DB) error {
+				type JwtRevocation struct {
+					ID            int        `gorm:"primary_key"`
+					JTI           string     `gorm:"type:varchar(255);index"`
+					Subject       string     `gorm:"type:varchar(255);index"`
+					RevokedBefore *time.Time `gorm:"index"`
+					ExpiresAt     time.Time  `gorm:"index"`
+					CreatedAt     time.Time
+				}
+
+				return tx.Set("gorm:table_options", defaultTableOpts).AutoMigrate(&JwtRevocation{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable("jwt_revocations")
+			},
+		},
+		// single-use tokens emailed to users, e.g: password reset
+		{
+			ID: "202610181000",
+			Migrate: func(tx *gorm.DB) error {
+				type UserToken struct {
+					Base
+					UserID    int    `gorm:"not null;index"`
+					Purpose   string `gorm:"type:varchar(50);not null"`
+					TokenHash string `gorm:"type:varchar(255);uniqueIndex;not null"`
+					ExpiresAt time.Time
+					UsedAt    *time.Time
+				}
+
+				return tx.Set("gorm:table_options", defaultTableOpts).AutoMigrate(&UserToken{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable("user_tokens")
+			},
+		},
+		// email verification, existing users are considered verified
+		{
+			ID: "202610181030",
+			Migrate: func(tx *gorm.DB) error {
+				type User struct {
+					EmailVerifiedAt *time.Time
+				}
+
+				if err := tx.Migrator().AddColumn(&User{}, "EmailVerifiedAt"); err != nil {
+					return err
+				}
+
+				return tx.Exec("UPDATE users SET email_verified_at = created_at").Error
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropColumn("users", "email_verified_at")
+			},
+		},
+		// TOTP two-factor authentication
+		{
+			ID: "202610181100",
+			Migrate: func(tx *gorm.DB) error {
+				type User struct {
+					MFAEnabled     bool   `gorm:"not null;default:false"`
+					MFASecret      string `gorm:"type:varchar(255)"`
+					MFALastCounter int64  `gorm:"not null;default:0"`
+				}
+				type UserToken struct {
+					Attempts int `gorm:"not null;default:0"`
+				}
+				type RecoveryCode struct {
+					Base
+					UserID   int    `gorm:"not null;index"`
+					CodeHash string `gorm:"type:varchar(255);not null"`
+					UsedAt   *time.Time
+				}
+
+				for _, field := range []string{"MFAEnabled", "MFASecret", "MFALastCounter"} {
+					if err := tx.Migrator().AddColumn(&User{}, field); err != nil {
+						return err
+					}
+				}
+				if err := tx.Migrator().AddColumn(&UserToken{}, "Attempts"); err != nil {
+					return err
+				}
+
+				return tx.Set("gorm:table_options", defaultTableOpts).AutoMigrate(&RecoveryCode{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				for _, column := range []string{"mfa_enabled", "mfa_secret", "mfa_last_counter"} {
+					if err := tx.Migrator().DropColumn("users", column); err != nil {
+						return err
+					}
+				}
+				if err := tx.Migrator().DropColumn("user_tokens", "attempts"); err != nil {
+					return err
+				}
+
+				return tx.Migrator().DropTable("recovery_codes")
+			},
+		},
+		// brute-force protection on login
+		{
+			ID: "202610181130",
+			Migrate: func(tx *gorm.DB) error {
+				type User struct {
+					FailedLoginCount int `gorm:"not null;default:0"`
+					LockedUntil      *time.Time
+				}
+				type LoginFailure struct {
+					ID        int       `gorm:"primary_key"`
+					IP        string    `gorm:"type:varchar(45);index;not null"`
+					Username  string    `gorm:"type:varchar(255)"`
+					CreatedAt time.Time `gorm:"index"`
+				}
+
+				for _, field := range []string{"FailedLoginCount", "LockedUntil"} {
+					if err := tx.Migrator().AddColumn(&User{}, field); err != nil {
+						return err
+					}
+				}
+
+				return tx.Set("gorm:table_options", defaultTableOpts).AutoMigrate(&LoginFailure{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				for _, column := range []string{"failed_login_count", "locked_until"} {
+					if err := tx.Migrator().DropColumn("users", column); err != nil {
+						return err
+					}
+				}
+
+				return tx.Migrator().DropTable("login_failures")
+			},
+		},
+		// password history, to prevent reuse
+		{
+			ID: "202610181200",
+			Migrate: func(tx *gorm.DB) error {
+				type PasswordHistory struct {
+					ID        int    `gorm:"primary_key"`
+					UserID    int    `gorm:"not null;index"`
+					Hash      string `gorm:"type:varchar(255);not null"`
+					CreatedAt time.Time
+				}
+
+				return tx.Set("gorm:table_options", defaultTableOpts).AutoMigrate(&PasswordHistory{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable("password_histories")
+			},
+		},
+		// OpenID Connect login
+		{
+			ID: "202610181230",
+			Migrate: func(tx *gorm.DB) error {
+				type OAuthState struct {
+					Base
+					Provider     string    `gorm:"type:varchar(50);not null"`
+					StateHash    string    `gorm:"type:varchar(255);uniqueIndex;not null"`
+					Nonce        string    `gorm:"type:varchar(255);not null"`
+					CodeVerifier string    `gorm:"type:varchar(255);not null"`
+					ExpiresAt    time.Time `gorm:"index"`
+				}
+				type UserIdentity struct {
+					Base
+					UserID      int    `gorm:"not null;index"`
+					Provider    string `gorm:"type:varchar(50);not null;uniqueIndex:idx_user_identities_subject"`
+					Subject     string `gorm:"type:varchar(255);not null;uniqueIndex:idx_user_identities_subject"`
+					Email       string `gorm:"type:varchar(255)"`
+					LastLoginAt *time.Time
+				}
+
+				if err := tx.Set("gorm:table_options", defaultTableOpts).Table("oauth_states").AutoMigrate(&OAuthState{}); err != nil {
+					return err
+				}
+
+				return tx.Set("gorm:table_options", defaultTableOpts).AutoMigrate(&UserIdentity{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable("oauth_states", "user_identities")
+			},
+		},
+		// API keys & service accounts
+		{
+			ID: "202610181300",
+			Migrate: func(tx *gorm.DB) error {
+				type User struct {
+					ServiceAccount bool `gorm:"not null;default:false"`
+				}
+				type APIKey struct {
+					Base
+					UserID     int    `gorm:"not null;index"`
+					Name       string `gorm:"type:varchar(100);not null"`
+					Prefix     string `gorm:"type:varchar(20);uniqueIndex;not null"`
+					SecretHash string `gorm:"type:varchar(255);not null"`
+					Scopes     string `gorm:"type:varchar(100);not null"`
+					ExpiresAt  *time.Time
+					LastUsedAt *time.Time
+					RevokedAt  *time.Time
+				}
+
+				if err := tx.Migrator().AddColumn(&User{}, "ServiceAccount"); err != nil {
+					return err
+				}
+
+				return tx.Set("gorm:table_options", defaultTableOpts).AutoMigrate(&APIKey{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				if err := tx.Migrator().DropColumn("users", "service_account"); err != nil {
+					return err
+				}
+
+				return tx.Migrator().DropTable("api_keys")
+			},
+		},
+		// RBAC policies, seeded with the defaults formerly hard-coded
+		{
+			ID: "202610181330",
+			Migrate: func(tx *gorm.DB) error {
+				type CasbinRule struct {
+					ID    int    `gorm:"primary_key"`
+					PType string `gorm:"size:100"`
+					V0    string `gorm:"size:100"`
+					V1    string `gorm:"size:100"`
+					V2    string `gorm:"size:100"`
+					V3    string `gorm:"size:100"`
+					V4    string `gorm:"size:100"`
+					V5    string `gorm:"size:100"`
+				}
+
+				if err := tx.Set("gorm:table_options", defaultTableOpts).AutoMigrate(&CasbinRule{}); err != nil {
+					return err
+				}
+
+				rules := []*CasbinRule{
+					// user role
+					{PType: "p", V0: model.RoleUser, V1: model.ObjectUser, V2: model.ActionViewAll},
+					{PType: "p", V0: model.RoleUser, V1: model.ObjectCountry, V2: model.ActionViewAll},
+					// admin role
+					{PType: "p", V0: model.RoleAdmin, V1: model.ObjectUser, V2: model.ActionAny},
+					{PType: "p", V0: model.RoleAdmin, V1: model.ObjectCountry, V2: model.ActionAny},
+					{PType: "p", V0: model.RoleAdmin, V1: model.ObjectAPIKey, V2: model.ActionAny},
+					{PType: "p", V0: model.RoleAdmin, V1: model.ObjectImpersonation, V2: model.ActionCreate},
+					// superadmin role
+					{PType: "p", V0: model.RoleSuperAdmin, V1: model.ObjectAny, V2: model.ActionAny},
+					// roles inheritance
+					{PType: "g", V0: model.RoleAdmin, V1: model.RoleUser},
+					{PType: "g", V0: model.RoleSuperAdmin, V1: model.RoleAdmin},
+				}
+
+				return tx.Create(&rules).Error
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable("casbin_rules")
+			},
+		},
+		// RBAC policy version, polled to reload the policies changed by the other instances
+		{
+			ID: "202610181400",
+			Migrate: func(tx *gorm.DB) error {
+				type CasbinVersion struct {
+					ID        int `gorm:"primary_key"`
+					Version   int64
+					UpdatedAt time.Time
+				}
+
+				if err := tx.Set("gorm:table_options", defaultTableOpts).AutoMigrate(&CasbinVersion{}); err != nil {
+					return err
+				}
+
+				return tx.Create(&CasbinVersion{ID: 1, Version: 1, UpdatedAt: time.Now()}).Error
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable("casbin_versions")
+			},
+		},
+		// users may view themselves only, instead of every user
+		{
+			ID: "202610181430",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.Exec("UPDATE casbin_rules SET v2 = ? WHERE p_type = 'p' AND v0 = ? AND v1 = ? AND v2 = ?",
+					model.ActionView, model.RoleUser, model.ObjectUser, model.ActionViewAll).Error
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec("UPDATE casbin_rules SET v2 = ? WHERE p_type = 'p' AND v0 = ? AND v1 = ? AND v2 = ?",
+					model.ActionViewAll, model.RoleUser, model.ObjectUser, model.ActionView).Error
+			},
+		},
+		// organizations & memberships, with the RBAC policies of the organization domains
+		{
+			ID: "202610181500",
+			Migrate: func(tx *gorm.DB) error {
+				type Organization struct {
+					Base
+					Name string `gorm:"type:varchar(255);not null"`
+					Slug string `gorm:"type:varchar(100);uniqueIndex;not null"`
+				}
+				type Membership struct {
+					Base
+					OrganizationID int    `gorm:"not null;uniqueIndex:idx_memberships_organization_user"`
+					UserID         int    `gorm:"not null;uniqueIndex:idx_memberships_organization_user;index"`
+					Role           string `gorm:"type:varchar(100);not null"`
+				}
+				type CasbinRule struct {
+					ID    int    `gorm:"primary_key"`
+					PType string `gorm:"size:100"`
+					V0    string `gorm:"size:100"`
+					V1    string `gorm:"size:100"`
+					V2    string `gorm:"size:100"`
+					V3    string `gorm:"size:100"`
+					V4    string `gorm:"size:100"`
+					V5    string `gorm:"size:100"`
+				}
+
+				if err := tx.Set("gorm:table_options", defaultTableOpts).AutoMigrate(&Organization{}, &Membership{}); err != nil {
+					return err
+				}
+				if err := tx.Set("gorm:table_options", defaultTableOpts).Table("casbin_domain_rules").AutoMigrate(&CasbinRule{}); err != nil {
+					return err
+				}
+
+				// the "*" domain applies to every organization
+				domainRules := []*CasbinRule{
+					{PType: "p", V0: model.OrgRoleMember, V1: "*", V2: model.ObjectOrganization, V3: model.ActionView},
+					{PType: "p", V0: model.OrgRoleMember, V1: "*", V2: model.ObjectMembership, V3: model.ActionViewAll},
+					{PType: "p", V0: model.OrgRoleAdmin, V1: "*", V2: model.ObjectMembership, V3: model.ActionAny},
+					{PType: "p", V0: model.OrgRoleOwner, V1: "*", V2: model.ObjectAny, V3: model.ActionAny},
+					{PType: "g", V0: model.OrgRoleAdmin, V1: model.OrgRoleMember, V2: "*"},
+					{PType: "g", V0: model.OrgRoleOwner, V1: model.OrgRoleAdmin, V2: "*"},
+				}
+				if err := tx.Table("casbin_domain_rules").Create(&domainRules).Error; err != nil {
+					return err
+				}
+
+				// any user may create organizations, becoming their owner
+				return tx.Create(&CasbinRule{PType: "p", V0: model.RoleUser, V1: model.ObjectOrganization, V2: model.ActionCreate}).Error
+			},
+			Rollback: func(tx *gorm.DB) error {
+				if err := tx.Exec("DELETE FROM casbin_rules WHERE p_type = 'p' AND v0 = ? AND v1 = ? AND v2 = ?",
+					model.RoleUser, model.ObjectOrganization, model.ActionCreate).Error; err != nil {
+					return err
+				}
+
+				return tx.Migrator().DropTable("casbin_domain_rules", "memberships", "organizations")
+			},
+		},
+		// the RBAC rules are unique, see casbinadapter.AutoMigrate
+		{
+			ID: "202610181530",
+			Migrate: func(tx *gorm.DB) error {
+				const cols = "p_type, v0, v1, v2, v3, v4, v5"
+				for _, table := range []string{"casbin_rules", "casbin_domain_rules"} {
+					// keep the first of the duplicated rules, the derived table lets MySQL select from the deleted table
+					if err := tx.Exec("DELETE FROM " + table + " WHERE id NOT IN (SELECT id FROM (SELECT MIN(id) AS id FROM " + table + " GROUP BY " + cols + ") AS kept)").Error; err != nil {
+						return err
+					}
+					if err := tx.Exec("CREATE UNIQUE INDEX idx_" + table + "_rule ON " + table + " (" + cols + ")").Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				for _, table := range []string{"casbin_rules", "casbin_domain_rules"} {
+					if err := tx.Migrator().DropIndex(table, "idx_"+table+"_rule"); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		// soft delete of users & countries
+		{
+			ID: "202610181600",
+			Migrate: func(tx *gorm.DB) error {
+				type User struct {
+					DeletedAt gorm.DeletedAt `gorm:"index"`
+				}
+				type Country struct {
+					DeletedAt gorm.DeletedAt `gorm:"index"`
+				}
+
+				return tx.Set("gorm:table_options", defaultTableOpts).AutoMigrate(&User{}, &Country{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				for _, table := range []string{"users", "countries"} {
+					if err := tx.Migrator().DropIndex(table, "idx_"+table+"_deleted_at"); err != nil {
+						return err
+					}
+					if err := tx.Migrator().DropColumn(table, "deleted_at"); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		// add version column for optimistic concurrency control
+		{
+			ID: "202610181630",
+			Migrate: func(tx *gorm.DB) error {
+				type Versioned struct {
+					Version int `gorm:"not null;default:1"`
+				}
+
+				for _, table := range versionedTables {
+					if err := tx.Table(table).Set("gorm:table_options", defaultTableOpts).AutoMigrate(&Versioned{}); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				for _, table := range versionedTables {
+					if err := tx.Migrator().DropColumn(table, "version"); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
 	})
 
 	return nil
@@ -0,0 +1,113 @@
+package purge
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/M15t/ghoul/config"
+	"github.com/M15t/ghoul/internal/model"
+	dbutil "github.com/M15t/ghoul/internal/util/db"
+	pkgdbutil "github.com/M15t/ghoul/pkg/util/db"
+
+	"gorm.io/gorm"
+)
+
+// defaultRetention is used when the retention is not configured
+const defaultRetention = 30
+
+// Run permanently deletes the users, with their records, & countries deleted longer than the retention window
+func Run() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	// Create a slog logger, which:
+	//   - Logs to stdout.
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	db, err := dbutil.New(cfg.DbDsn, logger)
+	if err != nil {
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	retention := cfg.PurgeRetention
+	if retention <= 0 {
+		retention = defaultRetention
+	}
+	before := time.Now().AddDate(0, 0, -retention)
+
+	purged, err := purgeUsers(db, before)
+	if err != nil {
+		return fmt.Errorf("purging users: %w", err)
+	}
+	logger.Info("purged deleted records", "table", "users", "count", purged, "before", before)
+
+	purged, err = dbutil.NewDB(model.Country{}).PurgeDeleted(db, before)
+	if err != nil {
+		return fmt.Errorf("purging countries: %w", err)
+	}
+	logger.Info("purged deleted records", "table", "countries", "count", purged, "before", before)
+
+	return nil
+}
+
+// purgeBatchSize is the number of users purged per transaction
+const purgeBatchSize = 500
+
+// userDependents are the records of the users, purged along with them
+var userDependents = []interface{}{
+	&model.Session{},
+	&model.APIKey{},
+	&model.UserIdentity{},
+	&model.Membership{},
+	&model.PasswordHistory{},
+	&model.RecoveryCode{},
+	&model.UserToken{},
+}
+
+// purgeUsers permanently deletes the users soft deleted before the given time with their records,
+// returns the number of deleted users
+func purgeUsers(db *gorm.DB, before time.Time) (int64, error) {
+	var purged int64
+	for {
+		var users []*model.User
+		if err := db.Unscoped().Select("id", "username").Where("deleted_at < ?", before).
+			Order("id").Limit(purgeBatchSize).Find(&users).Error; err != nil {
+			return purged, err
+		}
+		if len(users) == 0 {
+			return purged, nil
+		}
+
+		ids := make([]int, 0, len(users))
+		usernames := make([]string, 0, len(users))
+		for _, u := range users {
+			ids = append(ids, u.ID)
+			usernames = append(usernames, u.Username)
+		}
+
+		// the memberships of all organizations
+		if err := pkgdbutil.Transaction(pkgdbutil.WithoutTenant(db), func(tx *gorm.DB) error {
+			for _, dep := range userDependents {
+				if err := tx.Unscoped().Where("user_id IN ?", ids).Delete(dep).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Where("username IN ?", usernames).Delete(&model.LoginFailure{}).Error; err != nil {
+				return err
+			}
+			return tx.Unscoped().Where("id IN ?", ids).Delete(&model.User{}).Error
+		}); err != nil {
+			return purged, err
+		}
+		purged += int64(len(ids))
+	}
+}
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// APIKeyPrefix starts every API key, which is formatted as `ghl_<prefix>_<secret>`
+const APIKeyPrefix = "ghl"
+
+// APIKey represents a personal API key of an user, authenticating machine clients by the `X-API-Key` header.
+// Only the hash of the secret is stored.
+// swagger:model
+type APIKey struct {
+	Base
+	UserID int    `json:"user_id" gorm:"not null;index"`
+	Name   string `json:"name" gorm:"type:varchar(100);not null"`
+	// Prefix identifies the key, it is the public part of the key
+	Prefix     string `json:"prefix" gorm:"type:varchar(20);uniqueIndex;not null"`
+	SecretHash string `json:"-" gorm:"type:varchar(255);not null"`
+	// Scopes are space separated, e.g: "read write"
+	Scopes     string     `json:"scopes" gorm:"type:varchar(100);not null"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
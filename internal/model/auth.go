@@ -11,6 +11,13 @@ type AuthToken struct {
 	TokenType    string `json:"token_type,omitempty"`
 	ExpiresIn    int    `json:"expires_in,omitempty"`
 	RefreshToken string `json:"refresh_token,omitempty"`
+	// MFAToken is given instead of the access token when the second factor is required,
+	// exchange it together with the TOTP code at `/login/mfa`
+	MFAToken string `json:"mfa_token,omitempty"`
+	// MFAEnrollRequired is true if the user must enroll TOTP before login, see `/login/mfa/enroll`
+	MFAEnrollRequired bool `json:"mfa_enroll_required,omitempty"`
+	// RecoveryCodes are given once when the TOTP enrollment is confirmed on login
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
 }
 
 // AuthUser represents data stored in JWT token for user
@@ -19,6 +26,14 @@ type AuthUser struct {
 	Username string
 	Email    string
 	Role     string
+	// Scopes restrict the access when authenticated by an API key, empty means unrestricted
+	Scopes []string
+	// Actor is the original user when impersonating, nil otherwise
+	Actor *AuthUser
+	// OrgID is the organization of the request, given by the X-Organization-ID header or the token. Zero if none
+	OrgID int
+	// OrgRole is the role of the user in the organization
+	OrgRole string
 }
 
 // Auth represents auth interface
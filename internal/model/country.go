@@ -4,7 +4,8 @@ package model
 // swagger:model
 type Country struct {
 	Base
-	Name      string `json:"name" gorm:"type:varchar(255)"`
-	Code      string `json:"code" gorm:"type:varchar(10)"`
-	PhoneCode string `json:"phone_code" gorm:"type:varchar(10)"`
+	SoftDelete
+	Name      string `json:"name" gorm:"type:varchar(255)" list:"sort,filter"`
+	Code      string `json:"code" gorm:"type:varchar(10)" list:"sort,filter"`
+	PhoneCode string `json:"phone_code" gorm:"type:varchar(10)" list:"sort,filter"`
 }
@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// LoginFailure represents a failed login attempt, used to throttle the attempts per IP address
+type LoginFailure struct {
+	ID        int       `json:"id" gorm:"primary_key"`
+	IP        string    `json:"ip" gorm:"type:varchar(45);index;not null"`
+	Username  string    `json:"username" gorm:"type:varchar(255)"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
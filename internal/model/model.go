@@ -2,16 +2,28 @@ package model
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // Base contains common fields for all models
 // Do not use gorm.Model because of uint ID
+// The `list` tags declare the fields the lists may be sorted and filtered by, see dbutil.NewListFields.
+// The nullable fields are not sortable, as the cursor pagination skips the null values
 type Base struct {
 	// ID of the record
-	ID int `json:"id" gorm:"primary_key"`
+	ID int `json:"id" gorm:"primary_key" list:"sort,filter"`
 	// The time that record is created
-	CreatedAt time.Time `json:"created_at"`
+	CreatedAt time.Time `json:"created_at" list:"sort,filter"`
 	// The latest time that record is updated
-	UpdatedAt time.Time `json:"updated_at"`
-	// DeletedAt *time.Time `json:"deleted_at" sql:"index"`
+	UpdatedAt time.Time `json:"updated_at" list:"sort,filter"`
+	// Version of the record, incremented on every update. It is the ETag of the record responses
+	Version int `json:"version" gorm:"not null;default:1"`
+}
+
+// SoftDelete is embedded by the models which are soft deleted, their deleted records are excluded from the queries
+// until they are purged. See dbutil.WithDeleted to include them
+type SoftDelete struct {
+	// The time that record is deleted, null unless deleted
+	DeletedAt gorm.DeletedAt `json:"deleted_at" gorm:"index" list:"filter"`
 }
@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// OAuthState represents a pending OpenID Connect login, created when the user is redirected to the provider.
+// It is consumed once the provider redirects back with the authorization code.
+type OAuthState struct {
+	Base
+	Provider  string `json:"provider" gorm:"type:varchar(50);not null"`
+	StateHash string `json:"-" gorm:"type:varchar(255);uniqueIndex;not null"`
+	Nonce     string `json:"-" gorm:"type:varchar(255);not null"`
+	// CodeVerifier is the PKCE code verifier
+	CodeVerifier string    `json:"-" gorm:"type:varchar(255);not null"`
+	ExpiresAt    time.Time `json:"expires_at" gorm:"index"`
+}
+
+// TableName overrides the default "o_auth_states"
+func (OAuthState) TableName() string {
+	return "oauth_states"
+}
+
+// UserIdentity represents an external identity (OpenID Connect subject) linked to an user
+// swagger:model
+type UserIdentity struct {
+	Base
+	UserID   int    `json:"user_id" gorm:"not null;index"`
+	Provider string `json:"provider" gorm:"type:varchar(50);not null;uniqueIndex:idx_user_identities_subject"`
+	Subject  string `json:"subject" gorm:"type:varchar(255);not null;uniqueIndex:idx_user_identities_subject"`
+	// Email is the email address given by the provider on the last login
+	Email       string     `json:"email" gorm:"type:varchar(255)"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
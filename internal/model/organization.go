@@ -0,0 +1,25 @@
+package model
+
+// Organization represents a customer organization, the tenant of the tenanted models
+// swagger:model
+type Organization struct {
+	Base
+	// example: Ghoul Inc.
+	Name string `json:"name" gorm:"type:varchar(255);not null"`
+	// example: ghoul
+	Slug string `json:"slug" gorm:"type:varchar(100);uniqueIndex;not null"`
+}
+
+// Membership represents the role of an user in an organization
+// swagger:model
+type Membership struct {
+	Base
+	OrganizationID int `json:"organization_id" gorm:"not null;uniqueIndex:idx_memberships_organization_user"`
+	UserID         int `json:"user_id" gorm:"not null;uniqueIndex:idx_memberships_organization_user;index" list:"filter"`
+	// example: org_member
+	Role string `json:"role" gorm:"type:varchar(100);not null" list:"sort,filter"`
+
+	Organization *Organization `json:"organization,omitempty"`
+	User         *User         `json:"user,omitempty"`
+}
+
@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// PasswordHistory represents a password hash previously set by an user, to prevent reuse
+type PasswordHistory struct {
+	ID        int       `json:"id" gorm:"primary_key"`
+	UserID    int       `json:"user_id" gorm:"not null;index"`
+	Hash      string    `json:"-" gorm:"type:varchar(255);not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
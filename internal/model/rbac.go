@@ -10,11 +10,25 @@ const (
 // AvailableRoles for validation
 var AvailableRoles = []string{RoleAdmin, RoleUser}
 
+// RBAC roles of the organization members, enforced by the domain of the organization
+const (
+	OrgRoleOwner  = "org_owner"
+	OrgRoleAdmin  = "org_admin"
+	OrgRoleMember = "org_member"
+)
+
 // RBAC objects
 const (
 	ObjectAny     = "*"
 	ObjectUser    = "user"
 	ObjectCountry = "country"
+	ObjectAPIKey  = "api_key"
+	// ObjectImpersonation is the object of the permission to impersonate other users
+	ObjectImpersonation = "impersonation"
+	// ObjectRBAC is the object of the permissions to manage the RBAC policies & roles
+	ObjectRBAC         = "rbac"
+	ObjectOrganization = "organization"
+	ObjectMembership   = "membership"
 )
 
 // RBAC actions
@@ -28,4 +42,6 @@ const (
 	ActionUpdate    = "update"
 	ActionDeleteAll = "delete_all"
 	ActionDelete    = "delete"
+	// ActionRestore restores the soft deleted records, which are listed with the include_deleted parameter
+	ActionRestore = "restore"
 )
@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// RecoveryCode represents a single-use MFA recovery code of an user, only its hash is stored
+type RecoveryCode struct {
+	Base
+	UserID   int        `json:"user_id" gorm:"not null;index"`
+	CodeHash string     `json:"-" gorm:"type:varchar(255);not null"`
+	UsedAt   *time.Time `json:"used_at,omitempty"`
+}
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// Session represents a login session of an user on a single device/client.
+// The refresh token is rotated on every use, only its hash is stored.
+// swagger:model
+type Session struct {
+	Base
+	UserID int `json:"user_id" gorm:"not null;index"`
+	// FamilyID identifies the chain of refresh tokens issued for this session
+	FamilyID   string     `json:"-" gorm:"type:varchar(255);uniqueIndex;not null"`
+	TokenHash  string     `json:"-" gorm:"type:varchar(255);not null"`
+	UserAgent  string     `json:"user_agent" gorm:"type:varchar(255)"`
+	IP         string     `json:"ip" gorm:"type:varchar(45)"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
@@ -6,16 +6,32 @@ import "time"
 // swagger:model
 type User struct {
 	Base
-	FirstName string `json:"first_name" gorm:"type:varchar(255)"`
-	LastName  string `json:"last_name" gorm:"type:varchar(255)"`
-	Email     string `json:"email" gorm:"type:varchar(255)"`
-	Mobile    string `json:"mobile,omitempty" gorm:"type:varchar(255)"`
+	SoftDelete
+	FirstName string `json:"first_name" gorm:"type:varchar(255)" list:"sort,filter"`
+	LastName  string `json:"last_name" gorm:"type:varchar(255)" list:"sort,filter"`
+	Email     string `json:"email" gorm:"type:varchar(255)" list:"sort,filter"`
+	Mobile    string `json:"mobile,omitempty" gorm:"type:varchar(255)" list:"filter"`
+	// EmailVerifiedAt is nil until the user confirms the email address
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty" list:"filter"`
 
-	Username     string     `json:"username" gorm:"type:varchar(255);unique_index;not null"`
-	Password     string     `json:"-" gorm:"type:varchar(255);not null"`
-	LastLogin    *time.Time `json:"last_login,omitempty"`
-	Blocked      bool       `json:"blocked" gorm:"not null;default:false"`
-	RefreshToken string     `json:"-" gorm:"type:varchar(255);unique_index"`
+	Username  string     `json:"username" gorm:"type:varchar(255);unique_index;not null" list:"sort,filter"`
+	Password  string     `json:"-" gorm:"type:varchar(255);not null"`
+	LastLogin *time.Time `json:"last_login,omitempty" list:"filter"`
+	Blocked   bool       `json:"blocked" gorm:"not null;default:false" list:"filter"`
+	// ServiceAccount is a non-human user, which may only authenticate by API keys
+	ServiceAccount bool `json:"service_account" gorm:"not null;default:false" list:"filter"`
 
-	Role string `json:"role" gorm:"varchar(255)"`
+	// FailedLoginCount counts the consecutive failed login attempts, reset on successful login
+	FailedLoginCount int `json:"failed_login_count" gorm:"not null;default:0"`
+	// LockedUntil is set when the account is temporarily locked out by too many failed login attempts
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+
+	// MFAEnabled is true once the TOTP enrollment is confirmed
+	MFAEnabled bool `json:"mfa_enabled" gorm:"not null;default:false" list:"filter"`
+	// MFASecret is the TOTP secret, set on enrollment
+	MFASecret string `json:"-" gorm:"type:varchar(255)"`
+	// MFALastCounter is the time step of the last accepted TOTP code, to prevent replay
+	MFALastCounter int64 `json:"-" gorm:"not null;default:0"`
+
+	Role string `json:"role" gorm:"varchar(255)" list:"sort,filter"`
 }
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// Purposes of user tokens
+const (
+	TokenPurposeResetPassword = "reset_password"
+	TokenPurposeVerifyEmail   = "verify_email"
+	TokenPurposeMFAChallenge  = "mfa_challenge"
+)
+
+// UserToken represents a single-use, expiring token issued to an user for a given purpose (e.g: password reset).
+// Only the hash of the token is stored.
+type UserToken struct {
+	Base
+	UserID    int        `json:"user_id" gorm:"not null;index"`
+	Purpose   string     `json:"purpose" gorm:"type:varchar(50);not null"`
+	TokenHash string     `json:"-" gorm:"type:varchar(255);uniqueIndex;not null"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	// Attempts counts the failed attempts to use the token
+	Attempts int `json:"attempts" gorm:"not null;default:0"`
+}
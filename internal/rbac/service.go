@@ -1,30 +1,93 @@
 package rbac
 
 import (
-	"github.com/M15t/ghoul/internal/model"
+	"fmt"
+	"os"
+	"time"
+
 	"github.com/M15t/ghoul/pkg/rbac"
+	snsutil "github.com/M15t/ghoul/pkg/util/sns"
+	sqsutil "github.com/M15t/ghoul/pkg/util/sqs"
+
+	"github.com/casbin/casbin/persist"
+	"gorm.io/gorm"
+)
+
+// Policy change watchers
+const (
+	WatcherDB  = "db"
+	WatcherSNS = "sns"
 )
 
-// New returns new RBAC service
-func New(enableLog bool) *rbac.RBAC {
-	r := rbac.NewWithConfig(rbac.Config{EnableLog: enableLog})
+// DomainTable stores the policies of the organization domains
+const DomainTable = "casbin_domain_rules"
+
+// Config represents the config of the RBAC service
+type Config struct {
+	EnableLog bool
+	// Watcher propagates the policy changes to the other instances, either WatcherDB, WatcherSNS or empty to disable
+	Watcher      string
+	PollInterval time.Duration
+	// TopicARN & QueueURL are required by the SNS watcher
+	TopicARN string
+	QueueURL string
+}
+
+// New returns new RBAC service.
+// The policies & roles inheritance are persisted in the casbin_rules table, seeded by the migrations
+// and editable at runtime by the RBAC admin API.
+func New(db *gorm.DB, cfg Config) (*rbac.RBAC, error) {
+	w, err := newWatcher(db, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	r := rbac.NewWithConfig(rbac.Config{GormDB: db, EnableLog: cfg.EnableLog, Watcher: w})
+
+	r.PrintPolicy()
 
-	// Add permission for user role
-	r.AddPolicy(model.RoleUser, model.ObjectUser, model.ActionViewAll)
-	r.AddPolicy(model.RoleUser, model.ObjectCountry, model.ActionViewAll)
+	return r, nil
+}
+
+// NewDomain returns new RBAC service of the organization domains, enforcing the roles of the members.
+// The policies of the "*" domain apply to every organization.
+func NewDomain(db *gorm.DB, cfg Config) (*rbac.RBAC, error) {
+	w, err := newWatcher(db, cfg)
+	if err != nil {
+		return nil, err
+	}
 
-	// Add permission for admin role
-	r.AddPolicy(model.RoleAdmin, model.ObjectUser, model.ActionAny)
-	r.AddPolicy(model.RoleAdmin, model.ObjectCountry, model.ActionAny)
+	r := rbac.NewWithConfig(rbac.Config{
+		Model:     rbac.NewRBACWithWildcardDomainModel(),
+		GormDB:    db,
+		Table:     DomainTable,
+		EnableLog: cfg.EnableLog,
+		Watcher:   w,
+	})
 
-	// Add permission for superadmin role
-	r.AddPolicy(model.RoleSuperAdmin, model.ObjectAny, model.ActionAny)
+	r.PrintPolicy()
 
-	// Roles inheritance
-	r.AddGroupingPolicy(model.RoleAdmin, model.RoleUser)
-	r.AddGroupingPolicy(model.RoleSuperAdmin, model.RoleAdmin)
+	return r, nil
+}
 
-	r.GetModel().PrintPolicy()
+// newWatcher creates the configured policy change watcher, nil if disabled
+func newWatcher(db *gorm.DB, cfg Config) (persist.Watcher, error) {
+	switch cfg.Watcher {
+	case "":
+		return nil, nil
+	case WatcherDB:
+		return rbac.NewDBWatcher(db, cfg.PollInterval), nil
+	case WatcherSNS:
+		if cfg.TopicARN == "" || cfg.QueueURL == "" {
+			return nil, fmt.Errorf("rbac: the SNS watcher requires the topic ARN & queue URL")
+		}
+		sqsSvc := sqsutil.New(sqsutil.Config{Region: os.Getenv("AWS_REGION")})
+		return rbac.NewSNSWatcher(snsutil.New(), sqsSvc, rbac.SNSWatcherConfig{
+			TopicARN: cfg.TopicARN,
+			QueueURL: cfg.QueueURL,
+			Interval: cfg.PollInterval,
+		}), nil
+	}
 
-	return r
+	return nil, fmt.Errorf("rbac: unknown watcher %q", cfg.Watcher)
 }
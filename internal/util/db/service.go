@@ -26,10 +26,18 @@ func New(dbPsn string, slogger *slog.Logger) (*gorm.DB, error) {
 	gConfig := sloggorm.NewConfig(slogger.Handler()).WithTraceAll(true).WithContextKeys(map[string]string{"id": "X-Request-ID"})
 	config.Logger = sloggorm.NewWithConfig(gConfig)
 
-	return dbutil.New("mysql", dbPsn, config)
-
-	// EnablePostgreSQL: remove 2 lines above, uncomment the following
-	// return dbutil.New("postgres", dbPsn, enableLog)
+	db, err := dbutil.New("mysql", dbPsn, config)
+	if err != nil {
+		return nil, err
+	}
+	// scope the queries of the models owned by an organization to the organization of the request
+	if err := dbutil.RegisterTenantScope(db, "organization_id"); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+
+	// EnablePostgreSQL: replace "mysql" above with "postgres"
 }
 
 // NewDB creates new DB instance
@@ -6,7 +6,7 @@ import (
 )
 
 // ListRequest holds data of listing request from react-admin
-// swagger:parameters usersList countriesList
+// swagger:parameters usersList countriesList organizationsListMembers
 type ListRequest struct {
 	httputil.ListRequest
 }
@@ -0,0 +1,164 @@
+package rbac
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Knetic/govaluate"
+	"github.com/casbin/casbin"
+	"github.com/casbin/casbin/model"
+)
+
+// ConditionFunc is the matcher function evaluating the conditions of the ABAC policies
+const ConditionFunc = "abac"
+
+// attrsToken is the last request token of the ABAC model, padded when enforcing with sub, obj, act only
+const attrsToken = "r_attrs"
+
+// Attributes of the request & resource, the conditions refer to them by key, e.g:
+// Attributes{"sub.country_id": 1, "obj.country_id": 1, "obj.created_at": time.Now()}.
+// The time values are compared as unix seconds, like the "now" attribute which is always given.
+type Attributes map[string]interface{}
+
+// NewABACModel initializes the RBAC model whose policies carry a condition on the attributes, e.g:
+// p, admin, user, update_all, sub.country_id == obj.country_id
+// p, user, post, update, obj.created_by == sub.id && now - obj.created_at < 86400
+// The condition "true" grants the permission unconditionally.
+func NewABACModel() model.Model {
+	m := casbin.NewModel()
+	m.AddDef("r", "r", "sub, obj, act, attrs")
+	m.AddDef("p", "p", "sub, obj, act, cond")
+	m.AddDef("g", "g", "_, _")
+	m.AddDef("e", "e", "some(where (p.eft == allow))")
+	m.AddDef("m", "m", `g(r.sub, p.sub) && (r.obj == p.obj || p.obj == "*") && (r.act == p.act || p.act == "*") && `+ConditionFunc+`(p.cond, r.attrs)`)
+	return m
+}
+
+// MaxConditionLength is the maximum length of the conditions, the size of the policy columns storing them
+const MaxConditionLength = 100
+
+// ErrConditionTooLong is returned when adding a policy whose condition is longer than MaxConditionLength
+var ErrConditionTooLong = errors.New("rbac: the condition is too long")
+
+// ValidateCondition checks whether the condition may be stored
+func ValidateCondition(cond string) error {
+	if len(cond) > MaxConditionLength {
+		return ErrConditionTooLong
+	}
+	return nil
+}
+
+// validatePolicy validates the condition of the policy given as params of the ABAC model
+func (s *RBAC) validatePolicy(params []interface{}) error {
+	if !s.attrs {
+		return nil
+	}
+	if len(params) == 1 {
+		if rule, ok := params[0].([]string); ok {
+			params = make([]interface{}, len(rule))
+			for i, v := range rule {
+				params[i] = v
+			}
+		}
+	}
+	if len(params) < 4 {
+		return nil
+	}
+	cond, _ := params[3].(string)
+	return ValidateCondition(cond)
+}
+
+// conditions caches the compiled conditions
+var conditions sync.Map
+
+// EvalCondition reports whether the condition holds for the attributes.
+// Invalid conditions and the ones referring to missing attributes do not hold.
+func EvalCondition(cond string, attrs Attributes) bool {
+	var expr *govaluate.EvaluableExpression
+	if v, ok := conditions.Load(cond); ok {
+		expr = v.(*govaluate.EvaluableExpression)
+	} else {
+		var err error
+		if expr, err = govaluate.NewEvaluableExpression(escapeCondition(cond)); err != nil {
+			return false
+		}
+		conditions.Store(cond, expr)
+	}
+
+	params := govaluate.MapParameters{"now": time.Now().Unix()}
+	for k, v := range attrs {
+		if t, ok := v.(time.Time); ok {
+			v = t.Unix()
+		}
+		params[k] = v
+	}
+
+	result, err := expr.Eval(params)
+	if err != nil {
+		return false
+	}
+	ok, _ := result.(bool)
+	return ok
+}
+
+// evalCondition is the ConditionFunc, it never fails as the enforcer panics on errors
+func evalCondition(args ...interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return false, nil
+	}
+	cond, _ := args[0].(string)
+	switch attrs := args[1].(type) {
+	case Attributes:
+		return EvalCondition(cond, attrs), nil
+	case map[string]interface{}:
+		return EvalCondition(cond, attrs), nil
+	default:
+		return EvalCondition(cond, nil), nil
+	}
+}
+
+// escapeCondition brackets the attribute names having dots, e.g: sub.id => [sub.id],
+// as they would be evaluated as the struct accessors. The bracketed names are the attribute keys as is,
+// they never collide with the names without dot. The quoted strings & numbers are kept as is.
+func escapeCondition(cond string) string {
+	var b strings.Builder
+	for i := 0; i < len(cond); {
+		c := cond[i]
+		switch {
+		case c == '\'' || c == '"':
+			j := strings.IndexByte(cond[i+1:], c)
+			if j < 0 {
+				j = len(cond) - i - 2
+			}
+			b.WriteString(cond[i : i+j+2])
+			i += j + 2
+		case isWordChar(c):
+			j := i + 1
+			dotted := false
+			for j < len(cond) && (isWordChar(cond[j]) || (cond[j] == '.' && j+1 < len(cond) && isWordChar(cond[j+1]))) {
+				dotted = dotted || cond[j] == '.'
+				j++
+			}
+			if dotted && !isDigit(c) {
+				b.WriteString("[" + cond[i:j] + "]")
+			} else {
+				b.WriteString(cond[i:j])
+			}
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,78 @@
+package rbac_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/M15t/ghoul/pkg/rbac"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newABAC() *rbac.RBAC {
+	r := rbac.NewWithConfig(rbac.Config{Model: rbac.NewABACModel()})
+	r.AddPolicy("admin", "user", "update_all", "sub.country_id == obj.country_id")
+	r.AddPolicy("admin", "user", "view_all", "true")
+	r.AddPolicy("user", "post", "update", "obj.created_by == sub.id && now - obj.created_at < 86400")
+	r.AddPolicy("user", "post", "view", "obj.status in ('draft', 'published')")
+	return r
+}
+
+func TestABACModel(t *testing.T) {
+	r := newABAC()
+	now := time.Now()
+
+	assert.True(t, r.Enforce("admin", "user", "update_all", rbac.Attributes{"sub.country_id": 1, "obj.country_id": 1}))
+	assert.False(t, r.Enforce("admin", "user", "update_all", rbac.Attributes{"sub.country_id": 1, "obj.country_id": 2}))
+
+	assert.True(t, r.Enforce("user", "post", "update", rbac.Attributes{"sub.id": 1, "obj.created_by": 1, "obj.created_at": now.Add(-time.Hour)}))
+	assert.False(t, r.Enforce("user", "post", "update", rbac.Attributes{"sub.id": 1, "obj.created_by": 1, "obj.created_at": now.Add(-25 * time.Hour)}))
+	assert.False(t, r.Enforce("user", "post", "update", rbac.Attributes{"sub.id": 2, "obj.created_by": 1, "obj.created_at": now}))
+
+	// the conditions may contain commas
+	assert.True(t, r.Enforce("user", "post", "view", rbac.Attributes{"obj.status": "draft"}))
+	assert.False(t, r.Enforce("user", "post", "view", rbac.Attributes{"obj.status": "deleted"}))
+
+	// sub, obj, act only are enforced with empty attributes
+	assert.True(t, r.Enforce("admin", "user", "view_all"))
+	assert.False(t, r.Enforce("admin", "user", "update_all"))
+	assert.Nil(t, rbac.EnforceOwner(r, "admin", "user", "view_all", 1, 2))
+}
+
+func TestEvalCondition(t *testing.T) {
+	cases := []struct {
+		name  string
+		cond  string
+		attrs rbac.Attributes
+		want  bool
+	}{
+		{"true", "true", nil, true},
+		{"numbers of any type", "sub.id == obj.owner_id", rbac.Attributes{"sub.id": 1, "obj.owner_id": int64(1)}, true},
+		{"decimals are kept", "obj.score > 1.5", rbac.Attributes{"obj.score": 2}, true},
+		{"quoted strings are kept", "obj.email == 'a.b@x.y'", rbac.Attributes{"obj.email": "a.b@x.y"}, true},
+		{"missing attribute", "sub.id == obj.owner_id", rbac.Attributes{"sub.id": 1}, false},
+		{"invalid condition", "sub.id ==", rbac.Attributes{"sub.id": 1}, false},
+		{"non boolean result", "sub.id", rbac.Attributes{"sub.id": 1}, false},
+		{"dots are not underscores", "sub.id == 1", rbac.Attributes{"sub_id": 1}, false},
+		{"underscores are kept", "sub_id == 1 && sub.id == 2", rbac.Attributes{"sub_id": 1, "sub.id": 2}, true},
+		{"unterminated quote", "obj.name == 'a", rbac.Attributes{"obj.name": "a"}, false},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, rbac.EvalCondition(tt.cond, tt.attrs))
+		})
+	}
+}
+
+func TestConditionLength(t *testing.T) {
+	r := rbac.NewWithConfig(rbac.Config{Model: rbac.NewABACModel()})
+	long := "sub.id == obj.created_by && " + strings.Repeat("obj.status != 'x' && ", 5) + "true"
+	assert.Greater(t, len(long), rbac.MaxConditionLength)
+
+	assert.False(t, r.AddPolicy("user", "post", "update", long))
+	assert.False(t, r.AddPolicy([]string{"user", "post", "update", long}))
+	_, err := r.AddPolicySafe("user", "post", "update", long)
+	assert.ErrorIs(t, err, rbac.ErrConditionTooLong)
+	assert.True(t, r.AddPolicy("user", "post", "update", "true"))
+}
@@ -1,13 +1,16 @@
 package casbinadapter
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/casbin/casbin/model"
-	"github.com/casbin/casbin/persist"
 	"gorm.io/gorm"
 )
 
 // CasbinRule represents enforcer policies
 type CasbinRule struct {
+	ID    uint   `gorm:"primaryKey;autoIncrement"`
 	PType string `gorm:"size:100"`
 	V0    string `gorm:"size:100"`
 	V1    string `gorm:"size:100"`
@@ -17,20 +20,79 @@ type CasbinRule struct {
 	V5    string `gorm:"size:100"`
 }
 
+// DefaultTable is the table of the policies
+const DefaultTable = "casbin_rules"
+
+// batchSize is the number of rules inserted per statement
+const batchSize = 100
+
+// ErrInvalidFilter is returned when loading the policies with an unsupported filter
+var ErrInvalidFilter = errors.New("casbinadapter: invalid filter, must be Filter, *Filter or []Filter")
+
+// Filter selects the rules to load, each field matches any of its values and empty fields match everything.
+// E.g: the rules of the tenant "1" in the domain model are matched by
+// []Filter{{PType: []string{"p"}, V1: []string{"1", "*"}}, {PType: []string{"g"}, V2: []string{"1", "*"}}}
+type Filter struct {
+	PType []string
+	V0    []string
+	V1    []string
+	V2    []string
+	V3    []string
+	V4    []string
+	V5    []string
+}
+
+func (f Filter) empty() bool {
+	return len(f.PType)+len(f.V0)+len(f.V1)+len(f.V2)+len(f.V3)+len(f.V4)+len(f.V5) == 0
+}
+
 // Adapter represents the Gorm adapter for casbin policy storage.
 type Adapter struct {
-	db *gorm.DB
+	db       *gorm.DB
+	table    string
+	filtered bool
 }
 
 // NewAdapter is the constructor for Adapter.
 func NewAdapter(db *gorm.DB) *Adapter {
-	return &Adapter{db}
+	return NewAdapterWithTable(db, DefaultTable)
+}
+
+// NewAdapterWithTable is the constructor for Adapter storing the policies in the given table,
+// so the enforcers of different models may share the database.
+func NewAdapterWithTable(db *gorm.DB, table string) *Adapter {
+	if table == "" {
+		table = DefaultTable
+	}
+	return &Adapter{db: db, table: table}
+}
+
+// AutoMigrate creates or updates the policy table, with a unique index over the rules.
+// The index is named after the table as the index names may be unique per database.
+func AutoMigrate(db *gorm.DB, table string) error {
+	if table == "" {
+		table = DefaultTable
+	}
+	if err := db.Table(table).AutoMigrate(&CasbinRule{}); err != nil {
+		return err
+	}
+
+	index := "idx_" + table + "_rule"
+	if db.Migrator().HasIndex(table, index) {
+		return nil
+	}
+	return db.Exec(fmt.Sprintf("CREATE UNIQUE INDEX %s ON %s (p_type, v0, v1, v2, v3, v4, v5)", index, table)).Error
+}
+
+// tx returns the database scoped to the policy table
+func (a *Adapter) tx() *gorm.DB {
+	return a.db.Table(a.table)
 }
 
 // LoadPolicy loads policy from database.
 func (a *Adapter) LoadPolicy(cm model.Model) error {
 	var lines []CasbinRule
-	err := a.db.Find(&lines).Error
+	err := a.tx().Order("id").Find(&lines).Error
 	if err != nil {
 		return err
 	}
@@ -38,51 +100,121 @@ func (a *Adapter) LoadPolicy(cm model.Model) error {
 	for _, line := range lines {
 		loadPolicyLine(line, cm)
 	}
+	a.filtered = false
 
 	return nil
 }
 
-// SavePolicy saves policy to database.
-func (a *Adapter) SavePolicy(cm model.Model) error {
-	err := a.db.Exec("DELETE FROM casbin_rules;").Error
-	if err != nil {
-		return err
+// LoadFilteredPolicy loads only the policy rules matching the filter, which is Filter, *Filter or []Filter.
+// The rules matching any of the []Filter are loaded.
+func (a *Adapter) LoadFilteredPolicy(cm model.Model, filter interface{}) error {
+	var filters []Filter
+	switch f := filter.(type) {
+	case Filter:
+		filters = []Filter{f}
+	case *Filter:
+		if f == nil {
+			return ErrInvalidFilter
+		}
+		filters = []Filter{*f}
+	case []Filter:
+		filters = f
+	default:
+		return ErrInvalidFilter
 	}
 
-	for ptype, ast := range cm["p"] {
-		for _, rule := range ast.Policy {
-			line := savePolicyLine(ptype, rule)
-			err := a.db.Create(&line).Error
-			if err != nil {
-				return err
-			}
+	db := a.tx()
+	for i, f := range filters {
+		if f.empty() {
+			// matches everything, the other filters are irrelevant
+			db = a.tx()
+			break
+		}
+		if i == 0 {
+			db = db.Where(filterQuery(a.db, f))
+		} else {
+			db = db.Or(filterQuery(a.db, f))
 		}
 	}
 
-	for ptype, ast := range cm["g"] {
-		for _, rule := range ast.Policy {
-			line := savePolicyLine(ptype, rule)
-			err := a.db.Create(&line).Error
-			if err != nil {
-				return err
+	var lines []CasbinRule
+	if err := db.Order("id").Find(&lines).Error; err != nil {
+		return err
+	}
+
+	for _, line := range lines {
+		loadPolicyLine(line, cm)
+	}
+	a.filtered = true
+
+	return nil
+}
+
+// IsFiltered returns true if the loaded policy has been filtered.
+func (a *Adapter) IsFiltered() bool {
+	return a.filtered
+}
+
+// SavePolicy saves policy to database, replacing all the stored rules in a transaction.
+func (a *Adapter) SavePolicy(cm model.Model) error {
+	var lines []CasbinRule
+	for _, sec := range []string{"p", "g"} {
+		for ptype, ast := range cm[sec] {
+			for _, rule := range ast.Policy {
+				lines = append(lines, savePolicyLine(ptype, rule))
 			}
 		}
 	}
 
-	return nil
+	return a.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM " + a.table).Error; err != nil {
+			return err
+		}
+		if len(lines) == 0 {
+			return nil
+		}
+		return tx.Table(a.table).CreateInBatches(&lines, batchSize).Error
+	})
 }
 
 // AddPolicy adds a policy rule to the storage.
 func (a *Adapter) AddPolicy(sec string, ptype string, rule []string) error {
 	line := savePolicyLine(ptype, rule)
-	err := a.db.Create(&line).Error
+	err := a.tx().Create(&line).Error
 	return err
 }
 
+// AddPolicies adds the policy rules to the storage, all or none of them.
+func (a *Adapter) AddPolicies(sec string, ptype string, rules [][]string) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	lines := make([]CasbinRule, len(rules))
+	for i, rule := range rules {
+		lines[i] = savePolicyLine(ptype, rule)
+	}
+
+	return a.db.Transaction(func(tx *gorm.DB) error {
+		return tx.Table(a.table).CreateInBatches(&lines, batchSize).Error
+	})
+}
+
+// RemovePolicies removes the policy rules from the storage, all or none of them.
+func (a *Adapter) RemovePolicies(sec string, ptype string, rules [][]string) error {
+	return a.db.Transaction(func(tx *gorm.DB) error {
+		for _, rule := range rules {
+			if err := rawDelete(tx.Table(a.table), savePolicyLine(ptype, rule), true); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 // RemovePolicy removes a policy rule from the storage.
 func (a *Adapter) RemovePolicy(sec string, ptype string, rule []string) error {
 	line := savePolicyLine(ptype, rule)
-	err := rawDelete(a.db, line)
+	err := rawDelete(a.tx(), line, true)
 	return err
 }
 
@@ -109,32 +241,26 @@ func (a *Adapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int,
 	if fieldIndex <= 5 && 5 < fieldIndex+len(fieldValues) {
 		line.V5 = fieldValues[5-fieldIndex]
 	}
-	err := rawDelete(a.db, line)
+	err := rawDelete(a.tx(), line, false)
 	return err
 }
 
+// loadPolicyLine adds the rule to the model, without the trailing empty values.
+// Unlike persist.LoadPolicyLine, the values may contain commas, e.g: the conditions of the ABAC policies.
 func loadPolicyLine(line CasbinRule, cm model.Model) {
-	lineText := line.PType
-	if line.V0 != "" {
-		lineText += ", " + line.V0
-	}
-	if line.V1 != "" {
-		lineText += ", " + line.V1
-	}
-	if line.V2 != "" {
-		lineText += ", " + line.V2
+	values := []string{line.V0, line.V1, line.V2, line.V3, line.V4, line.V5}
+	for len(values) > 0 && values[len(values)-1] == "" {
+		values = values[:len(values)-1]
 	}
-	if line.V3 != "" {
-		lineText += ", " + line.V3
-	}
-	if line.V4 != "" {
-		lineText += ", " + line.V4
+
+	if line.PType == "" {
+		return
 	}
-	if line.V5 != "" {
-		lineText += ", " + line.V5
+	ast, ok := cm[line.PType[:1]][line.PType]
+	if !ok {
+		return
 	}
-
-	persist.LoadPolicyLine(lineText, cm)
+	ast.Policy = append(ast.Policy, values)
 }
 
 func savePolicyLine(ptype string, rule []string) CasbinRule {
@@ -163,31 +289,50 @@ func savePolicyLine(ptype string, rule []string) CasbinRule {
 	return line
 }
 
-func rawDelete(db *gorm.DB, line CasbinRule) error {
+// filterQuery returns the conditions of the filter, as a group to be combined with the others
+func filterQuery(db *gorm.DB, f Filter) *gorm.DB {
+	q := db.Session(&gorm.Session{NewDB: true})
+	fields := []struct {
+		column string
+		values []string
+	}{
+		{"p_type", f.PType}, {"v0", f.V0}, {"v1", f.V1}, {"v2", f.V2}, {"v3", f.V3}, {"v4", f.V4}, {"v5", f.V5},
+	}
+	for _, field := range fields {
+		if len(field.values) > 0 {
+			q = q.Where(field.column+" IN ?", field.values)
+		}
+	}
+	return q
+}
+
+// rawDelete deletes the rules matching the line. The empty values match only the empty ones if `exact`,
+// e.g: removing a rule keeps the longer rules having the same prefix, otherwise they match any value
+func rawDelete(db *gorm.DB, line CasbinRule, exact bool) error {
 	queryArgs := []interface{}{line.PType}
 
 	queryStr := "p_type = ?"
-	if line.V0 != "" {
+	if exact || line.V0 != "" {
 		queryStr += " and v0 = ?"
 		queryArgs = append(queryArgs, line.V0)
 	}
-	if line.V1 != "" {
+	if exact || line.V1 != "" {
 		queryStr += " and v1 = ?"
 		queryArgs = append(queryArgs, line.V1)
 	}
-	if line.V2 != "" {
+	if exact || line.V2 != "" {
 		queryStr += " and v2 = ?"
 		queryArgs = append(queryArgs, line.V2)
 	}
-	if line.V3 != "" {
+	if exact || line.V3 != "" {
 		queryStr += " and v3 = ?"
 		queryArgs = append(queryArgs, line.V3)
 	}
-	if line.V4 != "" {
+	if exact || line.V4 != "" {
 		queryStr += " and v4 = ?"
 		queryArgs = append(queryArgs, line.V4)
 	}
-	if line.V5 != "" {
+	if exact || line.V5 != "" {
 		queryStr += " and v5 = ?"
 		queryArgs = append(queryArgs, line.V5)
 	}
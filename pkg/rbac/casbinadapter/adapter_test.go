@@ -2,15 +2,15 @@ package casbinadapter_test
 
 import (
 	"log"
+	"path/filepath"
 	"testing"
 
 	"github.com/M15t/ghoul/pkg/rbac/casbinadapter"
 
 	"github.com/casbin/casbin"
 	"github.com/casbin/casbin/util"
-
+	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/sqlite"
-	_ "gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
@@ -110,15 +110,146 @@ func testAutoSave(t *testing.T, db *gorm.DB) {
 	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}})
 }
 
-func TestAdapters(t *testing.T) {
-	db, err := gorm.Open(sqlite.Open("testdata/gorm.db"), &gorm.Config{})
+func newDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "gorm.db")), &gorm.Config{})
 	if err != nil {
 		t.Fatalf("Error establishing connection %v", err)
 	}
-	// connection.Close() is not available for GORM 1.20.0
-	// db.Close()
-	db.AutoMigrate(&casbinadapter.CasbinRule{})
+	if err := casbinadapter.AutoMigrate(db, casbinadapter.DefaultTable); err != nil {
+		t.Fatalf("Error migrating %v", err)
+	}
+	return db
+}
+
+func TestAdapters(t *testing.T) {
+	db := newDB(t)
 
 	testSaveLoad(t, db)
 	testAutoSave(t, db)
 }
+
+func TestAutoMigrate(t *testing.T) {
+	db := newDB(t)
+
+	// migrating again is a no-op
+	assert.Nil(t, casbinadapter.AutoMigrate(db, casbinadapter.DefaultTable))
+	assert.True(t, db.Migrator().HasIndex(casbinadapter.DefaultTable, "idx_casbin_rules_rule"))
+
+	// the tables have their own index
+	assert.Nil(t, casbinadapter.AutoMigrate(db, "casbin_domain_rules"))
+	assert.True(t, db.Migrator().HasIndex("casbin_domain_rules", "idx_casbin_domain_rules_rule"))
+
+	// the rules are unique
+	a := casbinadapter.NewAdapter(db)
+	assert.Nil(t, a.AddPolicy("p", "p", []string{"alice", "data1", "read"}))
+	assert.NotNil(t, a.AddPolicy("p", "p", []string{"alice", "data1", "read"}))
+}
+
+func TestSavePolicy(t *testing.T) {
+	db := newDB(t)
+	initPolicy(t, db)
+
+	// the previous rules are replaced
+	e := casbin.NewEnforcer("testdata/rbac_model.conf", casbinadapter.NewAdapter(db))
+	e.ClearPolicy()
+	e.GetModel().AddPolicy("p", "p", []string{"carol", "data3", "read"})
+	assert.Nil(t, e.SavePolicy())
+	e.LoadPolicy()
+	testGetPolicy(t, e, [][]string{{"carol", "data3", "read"}})
+
+	// the rules are kept if the save fails, e.g: duplicated rules
+	e.GetModel().AddPolicy("p", "p", []string{"dave", "data3", "read"})
+	e.GetModel()["p"]["p"].Policy = append(e.GetModel()["p"]["p"].Policy, []string{"dave", "data3", "read"})
+	assert.NotNil(t, e.SavePolicy())
+	e.LoadPolicy()
+	testGetPolicy(t, e, [][]string{{"carol", "data3", "read"}})
+}
+
+func TestBatchPolicies(t *testing.T) {
+	db := newDB(t)
+	initPolicy(t, db)
+	a := casbinadapter.NewAdapter(db)
+	e := casbin.NewEnforcer("testdata/rbac_model.conf", a)
+
+	assert.Nil(t, a.AddPolicies("p", "p", [][]string{{"carol", "data3", "read"}, {"carol", "data3", "write"}}))
+	e.LoadPolicy()
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"carol", "data3", "read"}, {"carol", "data3", "write"}})
+
+	// none is added if any fails
+	assert.NotNil(t, a.AddPolicies("p", "p", [][]string{{"dave", "data3", "read"}, {"alice", "data1", "read"}}))
+	e.LoadPolicy()
+	assert.False(t, e.HasPolicy("dave", "data3", "read"))
+
+	assert.Nil(t, a.RemovePolicies("p", "p", [][]string{{"carol", "data3", "read"}, {"carol", "data3", "write"}, {"bob", "data2", "write"}}))
+	e.LoadPolicy()
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+
+	// empty batches are no-op
+	assert.Nil(t, a.AddPolicies("p", "p", nil))
+	assert.Nil(t, a.RemovePolicies("p", "p", nil))
+}
+
+func TestRemovePolicyExactly(t *testing.T) {
+	db := newDB(t)
+	a := casbinadapter.NewAdapter(db)
+	assert.Nil(t, a.AddPolicies("p", "p", [][]string{
+		{"alice", "data1", "read"},
+		{"alice", "data1", "read", "r.sub.Age > 18"},
+		{"bob", "data2", "write"},
+		{"bob", "data2", "write", "r.sub.Age > 18"},
+	}))
+	e := casbin.NewEnforcer("testdata/rbac_model.conf", a)
+
+	// the empty values are not wildcards, the longer rules are kept
+	assert.Nil(t, a.RemovePolicy("p", "p", []string{"alice", "data1", "read"}))
+	assert.Nil(t, a.RemovePolicies("p", "p", [][]string{{"bob", "data2", "write"}}))
+	e.LoadPolicy()
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read", "r.sub.Age > 18"}, {"bob", "data2", "write", "r.sub.Age > 18"}})
+
+	// unlike the filtered removal
+	assert.Nil(t, a.RemoveFilteredPolicy("p", "p", 0, "alice"))
+	e.LoadPolicy()
+	testGetPolicy(t, e, [][]string{{"bob", "data2", "write", "r.sub.Age > 18"}})
+}
+
+func TestLoadFilteredPolicy(t *testing.T) {
+	db := newDB(t)
+	initPolicy(t, db)
+	a := casbinadapter.NewAdapter(db)
+	e := casbin.NewEnforcer("testdata/rbac_model.conf", a)
+	assert.False(t, e.IsFiltered())
+
+	assert.Nil(t, e.LoadFilteredPolicy(casbinadapter.Filter{PType: []string{"p"}, V0: []string{"alice", "bob"}}))
+	assert.True(t, e.IsFiltered())
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}})
+	assert.Empty(t, e.GetGroupingPolicy())
+	// the filtered policies may not be saved, the others rules would be lost
+	assert.NotNil(t, e.SavePolicy())
+
+	// any of the filters
+	assert.Nil(t, e.LoadFilteredPolicy([]casbinadapter.Filter{
+		{PType: []string{"p"}, V1: []string{"data2"}, V2: []string{"read"}},
+		{PType: []string{"g"}},
+	}))
+	testGetPolicy(t, e, [][]string{{"data2_admin", "data2", "read"}})
+	assert.Equal(t, [][]string{{"alice", "data2_admin"}}, e.GetGroupingPolicy())
+
+	// the empty filter matches everything
+	assert.Nil(t, e.LoadFilteredPolicy(&casbinadapter.Filter{}))
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+
+	assert.Equal(t, casbinadapter.ErrInvalidFilter, e.LoadFilteredPolicy("v0 = 'alice'"))
+
+	// the full reload is not filtered anymore
+	assert.Nil(t, e.LoadPolicy())
+	assert.False(t, e.IsFiltered())
+}
+
+func TestLoadPolicyWithCommas(t *testing.T) {
+	db := newDB(t)
+	a := casbinadapter.NewAdapter(db)
+	assert.Nil(t, a.AddPolicy("p", "p", []string{"alice", "data1", "read, write"}))
+
+	e := casbin.NewEnforcer("testdata/rbac_model.conf", a)
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read, write"}})
+}
@@ -0,0 +1,103 @@
+package rbac
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CasbinVersion stores the version of the policies, which is increased on every change
+type CasbinVersion struct {
+	ID        int `gorm:"primary_key"`
+	Version   int64
+	UpdatedAt time.Time
+}
+
+// casbinVersionID is the ID of the single row of the versions table
+const casbinVersionID = 1
+
+// DBWatcher detects the policy changes by polling the version stored in the database
+type DBWatcher struct {
+	db       *gorm.DB
+	throttle throttle
+	version  atomic.Int64
+	closed   atomic.Bool
+
+	mu       sync.Mutex
+	callback func(string)
+}
+
+// NewDBWatcher creates new database polling watcher, checking at most once per interval
+func NewDBWatcher(db *gorm.DB, interval time.Duration) *DBWatcher {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	w := &DBWatcher{db: db}
+	w.throttle.interval = interval
+	return w
+}
+
+// SetUpdateCallback sets the callback reloading the policies, the current version is considered loaded
+func (w *DBWatcher) SetUpdateCallback(cb func(string)) error {
+	v, err := w.current()
+	if err != nil {
+		return err
+	}
+	w.version.Store(v)
+
+	w.mu.Lock()
+	w.callback = cb
+	w.mu.Unlock()
+	return nil
+}
+
+// Update increases the version after the policies are changed
+func (w *DBWatcher) Update() error {
+	now := time.Now()
+	res := w.db.Model(&CasbinVersion{}).Where("id = ?", casbinVersionID).
+		Updates(map[string]interface{}{"version": gorm.Expr("version + 1"), "updated_at": now})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return w.db.Create(&CasbinVersion{ID: casbinVersionID, Version: 1, UpdatedAt: now}).Error
+	}
+	return nil
+}
+
+// Close stops calling the callback
+func (w *DBWatcher) Close() {
+	w.closed.Store(true)
+}
+
+// Poll calls the callback if the version has changed since the last poll.
+// The database is queried at most once per interval, the errors are retried by the next poll.
+func (w *DBWatcher) Poll() {
+	if w.closed.Load() || !w.throttle.allow() {
+		return
+	}
+
+	v, err := w.current()
+	if err != nil || w.version.Swap(v) == v {
+		return
+	}
+
+	w.mu.Lock()
+	cb := w.callback
+	w.mu.Unlock()
+	if cb != nil {
+		cb(strconv.FormatInt(v, 10))
+	}
+}
+
+// current returns the stored version, zero if the policies have never been changed
+func (w *DBWatcher) current() (int64, error) {
+	var rec CasbinVersion
+	if err := w.db.Where("id = ?", casbinVersionID).Limit(1).Find(&rec).Error; err != nil {
+		return 0, err
+	}
+	return rec.Version, nil
+}
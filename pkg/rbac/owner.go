@@ -0,0 +1,55 @@
+package rbac
+
+import (
+	"strings"
+
+	dbutil "github.com/M15t/ghoul/pkg/util/db"
+
+	"github.com/imdatngo/gowhere"
+)
+
+// AllSuffix is the suffix of the actions on any object, e.g: view_all.
+// The same action without the suffix, e.g: view, is allowed on the objects owned by the user only.
+const AllSuffix = "_all"
+
+// OwnedAction returns the owner-scoped action of the action on any object, e.g: view_all => view
+func OwnedAction(action string) string {
+	return strings.TrimSuffix(action, AllSuffix)
+}
+
+// EnforceOwner checks the permission of the subject to perform the action on an object owned by the ownerID user.
+// The action on any object is checked first, then its owner-scoped action if the user uid owns the object.
+func EnforceOwner(e Intf, sub, obj, action string, uid, ownerID int) error {
+	if e.Enforce(sub, obj, action) {
+		return nil
+	}
+	if owned := OwnedAction(action); owned != action && uid != 0 && uid == ownerID && e.Enforce(sub, obj, owned) {
+		return nil
+	}
+	return ErrForbiddenAction
+}
+
+// EnforceList checks the permission of the subject to list the objects.
+// If only the owner-scoped action is allowed, the filter of `lq` is narrowed to the objects whose ownerField column
+// is the user uid. `lq` may be nil, the narrowed one is returned.
+func EnforceList(e Intf, sub, obj, action string, uid int, ownerField string, lq *dbutil.ListQueryCondition) (*dbutil.ListQueryCondition, error) {
+	if e.Enforce(sub, obj, action) {
+		return lq, nil
+	}
+	owned := OwnedAction(action)
+	if owned == action || ownerField == "" || uid == 0 || !e.Enforce(sub, obj, owned) {
+		return nil, ErrForbiddenAction
+	}
+
+	if lq == nil {
+		lq = &dbutil.ListQueryCondition{}
+	}
+	cond := map[string]interface{}{ownerField: uid}
+	if lq.Filter == nil {
+		lq.Filter = gowhere.Where(cond)
+	} else {
+		lq.Filter.And(cond)
+	}
+
+	return lq, nil
+}
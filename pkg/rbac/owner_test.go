@@ -0,0 +1,62 @@
+package rbac_test
+
+import (
+	"testing"
+
+	"github.com/M15t/ghoul/pkg/rbac"
+	dbutil "github.com/M15t/ghoul/pkg/util/db"
+
+	"github.com/imdatngo/gowhere"
+	"github.com/stretchr/testify/assert"
+)
+
+func newOwnerRBAC() *rbac.RBAC {
+	r := rbac.NewWithConfig(rbac.Config{})
+	r.AddPolicy("admin", "post", "*")
+	r.AddPolicy("user", "post", "view")
+	r.AddPolicy("user", "post", "update")
+	return r
+}
+
+func TestOwnedAction(t *testing.T) {
+	assert.Equal(t, "view", rbac.OwnedAction("view_all"))
+	assert.Equal(t, "view", rbac.OwnedAction("view"))
+}
+
+func TestEnforceOwner(t *testing.T) {
+	r := newOwnerRBAC()
+
+	assert.Nil(t, rbac.EnforceOwner(r, "admin", "post", "view_all", 1, 2))
+	assert.Nil(t, rbac.EnforceOwner(r, "user", "post", "view_all", 1, 1))
+	assert.Nil(t, rbac.EnforceOwner(r, "user", "post", "update_all", 1, 1))
+	assert.Equal(t, rbac.ErrForbiddenAction, rbac.EnforceOwner(r, "user", "post", "view_all", 1, 2))
+	assert.Equal(t, rbac.ErrForbiddenAction, rbac.EnforceOwner(r, "user", "post", "delete_all", 1, 1))
+	// the owner-scoped actions do not fall back any further
+	assert.Equal(t, rbac.ErrForbiddenAction, rbac.EnforceOwner(r, "user", "post", "delete", 1, 1))
+	// unknown owners are never owned
+	assert.Equal(t, rbac.ErrForbiddenAction, rbac.EnforceOwner(r, "user", "post", "view_all", 0, 0))
+}
+
+func TestEnforceList(t *testing.T) {
+	r := newOwnerRBAC()
+
+	lq := &dbutil.ListQueryCondition{Filter: gowhere.Where(map[string]interface{}{"title": "x"})}
+	got, err := rbac.EnforceList(r, "admin", "post", "view_all", 1, "user_id", lq)
+	assert.Nil(t, err)
+	assert.Equal(t, lq, got)
+	assert.Equal(t, []interface{}{"x"}, got.Filter.Vars())
+
+	got, err = rbac.EnforceList(r, "user", "post", "view_all", 1, "user_id", lq)
+	assert.Nil(t, err)
+	assert.Contains(t, got.Filter.SQL(), "user_id")
+	assert.Equal(t, []interface{}{"x", 1}, got.Filter.Vars())
+
+	got, err = rbac.EnforceList(r, "user", "post", "view_all", 1, "user_id", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{1}, got.Filter.Vars())
+
+	_, err = rbac.EnforceList(r, "user", "post", "view_all", 1, "", nil)
+	assert.Equal(t, rbac.ErrForbiddenAction, err)
+	_, err = rbac.EnforceList(r, "guest", "post", "view_all", 1, "user_id", nil)
+	assert.Equal(t, rbac.ErrForbiddenAction, err)
+}
@@ -0,0 +1,141 @@
+package rbac
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Permission maps a route, relative to its group, to the RBAC object & action required to access it
+type Permission struct {
+	Method string
+	Path   string
+	Object string
+	Action string
+	// Owned allows the route with the owner-scoped action too (e.g: view for view_all), see OwnedAction.
+	// Only set it when the handler checks the ownership, see EnforceOwner & EnforceList.
+	Owned bool
+}
+
+// Routes is the table of the route permissions, enforced by the Middleware
+type Routes struct {
+	mu    sync.RWMutex
+	perms map[string]Permission
+}
+
+// NewRoutes creates new empty route permission table
+func NewRoutes() *Routes {
+	return &Routes{perms: map[string]Permission{}}
+}
+
+// Register adds the permissions of the routes mounted under the prefix, e.g: /v1/countries.
+// Registering the same route again replaces its permission.
+func (r *Routes) Register(prefix string, perms ...Permission) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, p := range perms {
+		p.Path = prefix + p.Path
+		r.perms[routeKey(p.Method, p.Path)] = p
+	}
+}
+
+// Lookup returns the permission of the route, the path is the route path (e.g: /v1/countries/:id), not the request URL
+func (r *Routes) Lookup(method, path string) (Permission, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.perms[routeKey(method, path)]
+	return p, ok
+}
+
+// All returns all registered permissions, sorted by path then method
+func (r *Routes) All() []Permission {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	perms := make([]Permission, 0, len(r.perms))
+	for _, p := range r.perms {
+		perms = append(perms, p)
+	}
+	sort.Slice(perms, func(i, j int) bool {
+		if perms[i].Path != perms[j].Path {
+			return perms[i].Path < perms[j].Path
+		}
+		return perms[i].Method < perms[j].Method
+	})
+	return perms
+}
+
+// Access levels of a role to a route
+const (
+	AccessAll   = "all"
+	AccessOwned = "owned"
+	AccessNone  = "-"
+)
+
+// Access returns the access level of the subject to the route permission.
+// The owner-scoped action is checked for the owned routes only, see Permission.Owned.
+func Access(e Intf, sub string, p Permission) string {
+	if e.Enforce(sub, p.Object, p.Action) {
+		return AccessAll
+	}
+	if !p.Owned {
+		return AccessNone
+	}
+	if owned := OwnedAction(p.Action); owned != p.Action && e.Enforce(sub, p.Object, owned) {
+		return AccessOwned
+	}
+	return AccessNone
+}
+
+// PrintMatrix writes the route-to-permission matrix of the roles, one route per line, for auditing
+func (r *Routes) PrintMatrix(w io.Writer, e Intf, roles ...string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "METHOD\tPATH\tOBJECT\tACTION\t%s\n", strings.Join(roles, "\t"))
+	for _, p := range r.All() {
+		access := make([]string, len(roles))
+		for i, role := range roles {
+			access[i] = Access(e, role, p)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", p.Method, p.Path, p.Object, p.Action, strings.Join(access, "\t"))
+	}
+	return tw.Flush()
+}
+
+// MiddlewareConfig represents the route permission middleware configuration
+type MiddlewareConfig struct {
+	Routes   *Routes
+	Enforcer Intf
+	// Subject returns the RBAC subject of the request, e.g: the role of the authenticated user
+	Subject func(c echo.Context) string
+}
+
+// Middleware returns the middleware enforcing the permission of the matched route before its handler runs.
+// The routes without permission are passed through.
+// The owned routes (see Permission.Owned) are allowed if the owner-scoped action is, e.g: view for view_all,
+// their handler is then responsible to check the ownership, see EnforceOwner & EnforceList.
+func Middleware(cfg MiddlewareConfig) echo.MiddlewareFunc {
+	if cfg.Routes == nil || cfg.Enforcer == nil || cfg.Subject == nil {
+		panic("rbac: routes, enforcer and subject are required")
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			p, ok := cfg.Routes.Lookup(c.Request().Method, c.Path())
+			if !ok {
+				return next(c)
+			}
+			if Access(cfg.Enforcer, cfg.Subject(c), p) == AccessNone {
+				return ErrForbiddenAction
+			}
+			return next(c)
+		}
+	}
+}
+
+func routeKey(method, path string) string {
+	return method + " " + path
+}
@@ -0,0 +1,95 @@
+package rbac_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/M15t/ghoul/pkg/rbac"
+	"github.com/M15t/ghoul/pkg/server"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRoutes() *rbac.Routes {
+	routes := rbac.NewRoutes()
+	routes.Register("/v1/posts",
+		rbac.Permission{Method: http.MethodGet, Path: "", Object: "post", Action: "view_all", Owned: true},
+		rbac.Permission{Method: http.MethodGet, Path: "/:id", Object: "post", Action: "view_all", Owned: true},
+		rbac.Permission{Method: http.MethodDelete, Path: "/:id", Object: "post", Action: "delete_all", Owned: true},
+		// not owned, the handler does not check the ownership
+		rbac.Permission{Method: http.MethodPatch, Path: "/:id", Object: "post", Action: "update_all"},
+	)
+	return routes
+}
+
+func TestRoutes(t *testing.T) {
+	routes := newRoutes()
+
+	p, ok := routes.Lookup(http.MethodGet, "/v1/posts/:id")
+	assert.True(t, ok)
+	assert.Equal(t, rbac.Permission{Method: http.MethodGet, Path: "/v1/posts/:id", Object: "post", Action: "view_all", Owned: true}, p)
+	_, ok = routes.Lookup(http.MethodPut, "/v1/posts/:id")
+	assert.False(t, ok)
+
+	all := routes.All()
+	assert.Len(t, all, 4)
+	assert.Equal(t, "/v1/posts", all[0].Path)
+	assert.Equal(t, http.MethodDelete, all[1].Method)
+}
+
+func TestMiddleware(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = server.NewErrorHandler(e).Handle
+	g := e.Group("/v1/posts")
+	g.Use(rbac.Middleware(rbac.MiddlewareConfig{
+		Routes:   newRoutes(),
+		Enforcer: newOwnerRBAC(),
+		Subject:  func(c echo.Context) string { return c.Request().Header.Get("X-Role") },
+	}))
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	g.GET("", ok)
+	g.GET("/:id", ok)
+	g.DELETE("/:id", ok)
+	g.PATCH("/:id", ok)
+	g.PUT("/:id", ok)
+
+	cases := []struct {
+		name   string
+		role   string
+		method string
+		url    string
+		want   int
+	}{
+		{"admin is allowed", "admin", http.MethodDelete, "/v1/posts/1", http.StatusOK},
+		{"owner-scoped action is allowed", "user", http.MethodGet, "/v1/posts/1", http.StatusOK},
+		{"missing action is forbidden", "user", http.MethodDelete, "/v1/posts/1", http.StatusForbidden},
+		{"unknown role is forbidden", "guest", http.MethodGet, "/v1/posts", http.StatusForbidden},
+		{"owner-scoped action is forbidden on the route without owner", "user", http.MethodPatch, "/v1/posts/1", http.StatusForbidden},
+		{"unregistered route is passed through", "guest", http.MethodPut, "/v1/posts/1", http.StatusOK},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			req.Header.Set("X-Role", tt.role)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
+
+func TestPrintMatrix(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, newRoutes().PrintMatrix(&buf, newOwnerRBAC(), "admin", "user"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 5)
+	assert.Equal(t, []string{"METHOD", "PATH", "OBJECT", "ACTION", "admin", "user"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"GET", "/v1/posts", "post", "view_all", "all", "owned"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"DELETE", "/v1/posts/:id", "post", "delete_all", "all", "-"}, strings.Fields(lines[2]))
+	assert.Equal(t, []string{"PATCH", "/v1/posts/:id", "post", "update_all", "all", "-"}, strings.Fields(lines[4]))
+}
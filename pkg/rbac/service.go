@@ -2,6 +2,7 @@ package rbac
 
 import (
 	"net/http"
+	"sync"
 
 	"github.com/M15t/ghoul/pkg/rbac/casbinadapter"
 	"github.com/M15t/ghoul/pkg/server"
@@ -20,15 +21,25 @@ var (
 
 // Config represents the config for RBAC service
 type Config struct {
-	Model     model.Model
-	Adapter   persist.Adapter
-	GormDB    *gorm.DB
+	Model   model.Model
+	Adapter persist.Adapter
+	GormDB  *gorm.DB
+	// Table stores the policies when GormDB is given, defaults to casbinadapter.DefaultTable
+	Table     string
 	EnableLog bool
+	// Watcher reloads the policies when they are changed by the other instances
+	Watcher persist.Watcher
 }
 
-// RBAC is RBAC application service
+// RBAC is RBAC application service.
+// The enforcer is not exposed, all its usages go through the methods guarded by the mutex.
 type RBAC struct {
-	*casbin.Enforcer
+	enforcer *casbin.Enforcer
+	// mu guards the policies, which are reloaded by the watcher while being enforced
+	mu     sync.RWMutex
+	poller Poller
+	// attrs is set for the ABAC model, whose attributes may be omitted when enforcing
+	attrs bool
 }
 
 // Intf represents common interface for the RBAC service
@@ -36,9 +47,10 @@ type Intf interface {
 	Enforce(rvals ...interface{}) bool
 }
 
-// DefaultConfig represents the default configuration
+// DefaultConfig represents the default configuration.
+// The nil model defaults to a new NewRBACModel(), the model holds the policies so it may not be shared.
 var DefaultConfig = Config{
-	Model:     NewRBACModel(),
+	Model:     nil,
 	Adapter:   nil,
 	GormDB:    nil,
 	EnableLog: true,
@@ -54,11 +66,14 @@ func NewWithConfig(cfg Config) *RBAC {
 	if cfg.Model == nil {
 		cfg.Model = DefaultConfig.Model
 	}
+	if cfg.Model == nil {
+		cfg.Model = NewRBACModel()
+	}
 	if cfg.GormDB == nil {
 		cfg.GormDB = DefaultConfig.GormDB
 	}
 	if cfg.GormDB != nil {
-		cfg.Adapter = casbinadapter.NewAdapter(cfg.GormDB)
+		cfg.Adapter = casbinadapter.NewAdapterWithTable(cfg.GormDB, cfg.Table)
 	} else if cfg.Adapter == nil {
 		cfg.Adapter = DefaultConfig.Adapter
 	}
@@ -70,7 +85,161 @@ func NewWithConfig(cfg Config) *RBAC {
 		ce = casbin.NewEnforcer(cfg.Model, cfg.EnableLog)
 	}
 
-	return &RBAC{ce}
+	ce.AddFunction(ConditionFunc, evalCondition)
+	tokens := ce.GetModel()["r"]["r"].Tokens
+	r := &RBAC{enforcer: ce, attrs: len(tokens) > 0 && tokens[len(tokens)-1] == attrsToken}
+	if cfg.Watcher != nil {
+		ce.SetWatcher(cfg.Watcher)
+		// replace the default callback by the guarded reload
+		cfg.Watcher.SetUpdateCallback(func(string) { r.LoadPolicy() })
+		if p, ok := cfg.Watcher.(Poller); ok {
+			r.poller = p
+		}
+	}
+
+	return r
+}
+
+// Enforce decides whether the subject may perform the action on the object.
+// With the ABAC model, enforcing sub, obj, act only is evaluated with empty attributes.
+func (s *RBAC) Enforce(rvals ...interface{}) bool {
+	if s.attrs && len(rvals) == 3 {
+		rvals = append(rvals, Attributes{})
+	}
+	s.poll()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.enforcer.Enforce(rvals...)
+}
+
+// LoadPolicy reloads the policies from the adapter
+func (s *RBAC) LoadPolicy() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enforcer.LoadPolicy()
+}
+
+// GetPolicy returns all the policies
+func (s *RBAC) GetPolicy() [][]string {
+	s.poll()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.enforcer.GetPolicy()
+}
+
+// GetFilteredPolicy returns the policies matching the field filters
+func (s *RBAC) GetFilteredPolicy(fieldIndex int, fieldValues ...string) [][]string {
+	s.poll()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.enforcer.GetFilteredPolicy(fieldIndex, fieldValues...)
+}
+
+// GetGroupingPolicy returns all the role inheritance rules
+func (s *RBAC) GetGroupingPolicy() [][]string {
+	s.poll()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.enforcer.GetGroupingPolicy()
+}
+
+// GetImplicitRolesForUser returns the roles of the subject, including the inherited ones
+func (s *RBAC) GetImplicitRolesForUser(name string, domain ...string) []string {
+	s.poll()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.enforcer.GetImplicitRolesForUser(name, domain...)
+}
+
+// GetImplicitPermissionsForUser returns the policies of the subject, including the ones of the inherited roles
+func (s *RBAC) GetImplicitPermissionsForUser(user string, domain ...string) [][]string {
+	s.poll()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.enforcer.GetImplicitPermissionsForUser(user, domain...)
+}
+
+// GetModel returns the model, holding the policies.
+// Note: it is not guarded, reading the policies from it may race with their changes
+func (s *RBAC) GetModel() model.Model {
+	return s.enforcer.GetModel()
+}
+
+// PrintPolicy logs the policies
+func (s *RBAC) PrintPolicy() {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.enforcer.GetModel().PrintPolicy()
+}
+
+// AddPolicy adds a policy, persisted by the adapter.
+// Returns false if the condition of the ABAC policy is invalid, see ValidateCondition
+func (s *RBAC) AddPolicy(params ...interface{}) bool {
+	if s.validatePolicy(params) != nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enforcer.AddPolicy(params...)
+}
+
+// RemovePolicy removes a policy, persisted by the adapter
+func (s *RBAC) RemovePolicy(params ...interface{}) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enforcer.RemovePolicy(params...)
+}
+
+// AddGroupingPolicy adds a role inheritance rule, persisted by the adapter
+func (s *RBAC) AddGroupingPolicy(params ...interface{}) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enforcer.AddGroupingPolicy(params...)
+}
+
+// RemoveGroupingPolicy removes a role inheritance rule, persisted by the adapter
+func (s *RBAC) RemoveGroupingPolicy(params ...interface{}) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enforcer.RemoveGroupingPolicy(params...)
+}
+
+// AddPolicySafe adds a policy, persists it & notifies the other instances
+func (s *RBAC) AddPolicySafe(params ...interface{}) (bool, error) {
+	if err := s.validatePolicy(params); err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enforcer.AddPolicySafe(params...)
+}
+
+// RemovePolicySafe removes a policy, persists it & notifies the other instances
+func (s *RBAC) RemovePolicySafe(params ...interface{}) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enforcer.RemovePolicySafe(params...)
+}
+
+// AddGroupingPolicySafe adds a role inheritance rule, persists it & notifies the other instances
+func (s *RBAC) AddGroupingPolicySafe(params ...interface{}) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enforcer.AddGroupingPolicySafe(params...)
+}
+
+// RemoveGroupingPolicySafe removes a role inheritance rule, persists it & notifies the other instances
+func (s *RBAC) RemoveGroupingPolicySafe(params ...interface{}) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enforcer.RemoveGroupingPolicySafe(params...)
+}
+
+// poll lets the polling watcher check for the policy changes
+func (s *RBAC) poll() {
+	if s.poller != nil {
+		s.poller.Poll()
+	}
 }
 
 // NewRBACModel initializes the RBAC casbin model
@@ -106,3 +275,15 @@ func NewRBACWithDomainModel() model.Model {
 	m.AddDef("m", "m", `g(r.sub, p.sub, r.dom) && r.dom == p.dom && r.obj == p.obj && r.act == p.act`)
 	return m
 }
+
+// NewRBACWithWildcardDomainModel initializes the RBAC with domain model, e.g: for multi-tenancy.
+// The policies & roles inheritance of the "*" domain apply to every domain, "*" object & action match any.
+func NewRBACWithWildcardDomainModel() model.Model {
+	m := casbin.NewModel()
+	m.AddDef("r", "r", "sub, dom, obj, act")
+	m.AddDef("p", "p", "sub, dom, obj, act")
+	m.AddDef("g", "g", "_, _, _")
+	m.AddDef("e", "e", "some(where (p.eft == allow))")
+	m.AddDef("m", "m", `(g(r.sub, p.sub, r.dom) || g(r.sub, p.sub, "*")) && (r.dom == p.dom || p.dom == "*") && (r.obj == p.obj || p.obj == "*") && (r.act == p.act || p.act == "*")`)
+	return m
+}
@@ -0,0 +1,62 @@
+package rbac_test
+
+import (
+	"testing"
+
+	"github.com/M15t/ghoul/pkg/rbac"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDomainModel(t *testing.T) {
+	r := rbac.NewWithConfig(rbac.Config{Model: rbac.NewRBACWithDomainModel()})
+	r.AddPolicy("member", "1", "report", "view")
+	r.AddPolicy("owner", "*", "*", "*")
+	r.AddGroupingPolicy("admin", "member", "1")
+
+	assert.True(t, r.Enforce("member", "1", "report", "view"))
+	assert.True(t, r.Enforce("admin", "1", "report", "view"))
+	assert.False(t, r.Enforce("member", "2", "report", "view"))
+	assert.False(t, r.Enforce("admin", "2", "report", "view"))
+
+	// "*" is not a wildcard
+	assert.False(t, r.Enforce("owner", "1", "report", "view"))
+	assert.True(t, r.Enforce("owner", "*", "*", "*"))
+}
+
+func TestWildcardDomainModel(t *testing.T) {
+	r := rbac.NewWithConfig(rbac.Config{Model: rbac.NewRBACWithWildcardDomainModel()})
+	r.AddPolicy("member", "*", "report", "view")
+	r.AddPolicy("owner", "*", "*", "*")
+	r.AddPolicy("auditor", "1", "log", "view")
+	r.AddGroupingPolicy("admin", "member", "*")
+	r.AddGroupingPolicy("admin", "auditor", "2")
+
+	// the "*" domain applies to every domain
+	assert.True(t, r.Enforce("member", "1", "report", "view"))
+	assert.True(t, r.Enforce("owner", "2", "log", "delete"))
+	assert.True(t, r.Enforce("admin", "1", "report", "view"))
+	assert.False(t, r.Enforce("member", "1", "report", "delete"))
+
+	// the others apply to their domain only
+	assert.True(t, r.Enforce("auditor", "1", "log", "view"))
+	assert.False(t, r.Enforce("auditor", "2", "log", "view"))
+	assert.False(t, r.Enforce("admin", "1", "log", "view"))
+}
+
+func TestGetImplicitPermissionsForUser(t *testing.T) {
+	r := rbac.NewWithConfig(rbac.Config{})
+	r.AddPolicy("user", "post", "view")
+	r.AddPolicy("admin", "post", "*")
+	r.AddPolicy("superadmin", "*", "*")
+	r.AddGroupingPolicy("admin", "user")
+	r.AddGroupingPolicy("superadmin", "admin")
+
+	assert.ElementsMatch(t, [][]string{{"user", "post", "view"}}, r.GetImplicitPermissionsForUser("user"))
+	assert.ElementsMatch(t, [][]string{
+		{"superadmin", "*", "*"},
+		{"admin", "post", "*"},
+		{"user", "post", "view"},
+	}, r.GetImplicitPermissionsForUser("superadmin"))
+	assert.Empty(t, r.GetImplicitPermissionsForUser("guest"))
+}
@@ -0,0 +1,177 @@
+package rbac
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// PolicyUpdatedEvent is the event of the notifications published on the policy changes
+const PolicyUpdatedEvent = "rbac.policy_updated"
+
+// seenRetention is how long the received message IDs are remembered, longer than the minimum SQS retention period
+const seenRetention = 5 * time.Minute
+
+// DefaultQueueRetention is the default retention period of the SQS queue, the minimum allowed by SQS
+const DefaultQueueRetention = 60 * time.Second
+
+// Publisher publishes the notifications to a SNS topic, implemented by snsutil.Service
+type Publisher interface {
+	Publish(topic string, message string) (string, error)
+}
+
+// Receiver receives the notifications from a SQS queue without deleting them, implemented by sqsutil.Service
+type Receiver interface {
+	PeekMessages(queueURL string) (*sqs.ReceiveMessageOutput, error)
+}
+
+// SNSWatcherConfig represents the config of the SNS watcher
+type SNSWatcherConfig struct {
+	// TopicARN is the SNS topic the policy changes are published to
+	TopicARN string
+	// QueueURL is the SQS queue subscribed to the topic. Every instance must see every message,
+	// so the queue is only peeked, set its retention period to the minimum (60 seconds) to expire them.
+	// Every peek increases the receive count of the messages, the queue must not have a redrive policy (dead-letter queue).
+	QueueURL string
+	// Interval is the minimum interval between the queue receives
+	Interval time.Duration
+	// Retention is the retention period of the queue, DefaultQueueRetention by default.
+	// The peeks are short polls sampling only some of the SQS servers, and the instances frozen longer than the retention
+	// never see the expired messages, so the policies are fully reloaded when not reloaded for longer than it.
+	Retention time.Duration
+}
+
+// SNSWatcher notifies the policy changes by SNS, received by every instance from a SQS queue subscribed to the topic
+type SNSWatcher struct {
+	pub      Publisher
+	recv     Receiver
+	cfg      SNSWatcherConfig
+	throttle throttle
+	closed   atomic.Bool
+	reloaded atomic.Int64
+
+	mu       sync.Mutex
+	callback func(string)
+	seen     map[string]time.Time
+}
+
+// notification is the message published on the policy changes
+type notification struct {
+	Event string    `json:"event"`
+	At    time.Time `json:"at"`
+}
+
+// snsEnvelope wraps the messages delivered from SNS to SQS, unless the raw delivery is enabled
+type snsEnvelope struct {
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+}
+
+// NewSNSWatcher creates new SNS notification watcher
+func NewSNSWatcher(pub Publisher, recv Receiver, cfg SNSWatcherConfig) *SNSWatcher {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultPollInterval
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = DefaultQueueRetention
+	}
+	w := &SNSWatcher{pub: pub, recv: recv, cfg: cfg, seen: map[string]time.Time{}}
+	w.throttle.interval = cfg.Interval
+	return w
+}
+
+// SetUpdateCallback sets the callback reloading the policies, the current policies are considered loaded
+func (w *SNSWatcher) SetUpdateCallback(cb func(string)) error {
+	w.reloaded.Store(time.Now().UnixNano())
+	w.mu.Lock()
+	w.callback = cb
+	w.mu.Unlock()
+	return nil
+}
+
+// Update publishes the notification after the policies are changed
+func (w *SNSWatcher) Update() error {
+	msg, err := json.Marshal(notification{Event: PolicyUpdatedEvent, At: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = w.pub.Publish(w.cfg.TopicARN, string(msg))
+	return err
+}
+
+// Close stops calling the callback
+func (w *SNSWatcher) Close() {
+	w.closed.Store(true)
+}
+
+// Poll calls the callback once if any new notification is received, or if the policies have not been reloaded
+// for longer than the queue retention, as notifications may have been missed.
+// The queue is received at most once per interval, the errors are retried by the next poll.
+func (w *SNSWatcher) Poll() {
+	if w.closed.Load() || !w.throttle.allow() {
+		return
+	}
+
+	now := time.Now()
+	stale := now.Sub(time.Unix(0, w.reloaded.Load())) >= w.cfg.Retention
+	out, err := w.recv.PeekMessages(w.cfg.QueueURL)
+	if err != nil || out == nil {
+		if stale {
+			w.reload("")
+		}
+		return
+	}
+
+	w.mu.Lock()
+	for id, t := range w.seen {
+		if now.Sub(t) > seenRetention {
+			delete(w.seen, id)
+		}
+	}
+	updated := ""
+	for _, m := range out.Messages {
+		if m.MessageId == nil || m.Body == nil {
+			continue
+		}
+		if _, ok := w.seen[*m.MessageId]; ok {
+			continue
+		}
+		w.seen[*m.MessageId] = now
+		if isPolicyUpdated(*m.Body) {
+			updated = *m.MessageId
+		}
+	}
+	w.mu.Unlock()
+
+	if updated != "" || stale {
+		w.reload(updated)
+	}
+}
+
+// reload calls the callback reloading the policies
+func (w *SNSWatcher) reload(id string) {
+	w.reloaded.Store(time.Now().UnixNano())
+
+	w.mu.Lock()
+	cb := w.callback
+	w.mu.Unlock()
+	if cb != nil {
+		cb(id)
+	}
+}
+
+// isPolicyUpdated checks whether the message body, raw or wrapped by SNS, is a policy change notification
+func isPolicyUpdated(body string) bool {
+	var env snsEnvelope
+	if err := json.Unmarshal([]byte(body), &env); err == nil && env.Type == "Notification" {
+		body = env.Message
+	}
+	var n notification
+	if err := json.Unmarshal([]byte(body), &n); err != nil {
+		return false
+	}
+	return n.Event == PolicyUpdatedEvent
+}
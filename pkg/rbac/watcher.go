@@ -0,0 +1,32 @@
+package rbac
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// DefaultPollInterval is the default interval of checking for the policy changes
+const DefaultPollInterval = 5 * time.Second
+
+// Poller is implemented by the watchers checking for the policy changes on demand.
+// RBAC polls before reading the policies, instead of watching in background goroutines,
+// which are frozen between the invocations on AWS Lambda.
+type Poller interface {
+	Poll()
+}
+
+// throttle allows one caller per interval
+type throttle struct {
+	interval time.Duration
+	last     atomic.Int64
+}
+
+// allow returns true if the interval has elapsed since the last allowed call
+func (t *throttle) allow() bool {
+	now := time.Now().UnixNano()
+	last := t.last.Load()
+	if now-last < int64(t.interval) {
+		return false
+	}
+	return t.last.CompareAndSwap(last, now)
+}
@@ -0,0 +1,118 @@
+package rbac_test
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/M15t/ghoul/pkg/rbac"
+	"github.com/M15t/ghoul/pkg/rbac/casbinadapter"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const testInterval = 20 * time.Millisecond
+
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "rbac.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&casbinadapter.CasbinRule{}, &rbac.CasbinVersion{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// assertPropagated changes the policies on the first instance, then checks the second one reloads them
+func assertPropagated(t *testing.T, a, b *rbac.RBAC) {
+	assert.False(t, b.Enforce("admin", "country", "view"))
+
+	added, err := a.AddPolicySafe("admin", "country", "view")
+	assert.Nil(t, err)
+	assert.True(t, added)
+	assert.True(t, a.Enforce("admin", "country", "view"))
+
+	time.Sleep(2 * testInterval)
+	assert.True(t, b.Enforce("admin", "country", "view"))
+
+	removed, err := a.RemovePolicySafe("admin", "country", "view")
+	assert.Nil(t, err)
+	assert.True(t, removed)
+
+	time.Sleep(2 * testInterval)
+	assert.False(t, b.Enforce("admin", "country", "view"))
+}
+
+func TestDBWatcher(t *testing.T) {
+	db := newTestDB(t)
+	newRBAC := func() *rbac.RBAC {
+		return rbac.NewWithConfig(rbac.Config{GormDB: db, Watcher: rbac.NewDBWatcher(db, testInterval)})
+	}
+
+	assertPropagated(t, newRBAC(), newRBAC())
+
+	var v rbac.CasbinVersion
+	assert.Nil(t, db.First(&v).Error)
+	assert.Equal(t, int64(2), v.Version)
+}
+
+// fakeBus delivers the published messages to the subscribed queue, wrapped by the SNS envelope
+type fakeBus struct {
+	mu       sync.Mutex
+	messages []*sqs.Message
+}
+
+func (b *fakeBus) Publish(topic string, message string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := strconv.Itoa(len(b.messages) + 1)
+	body, _ := json.Marshal(map[string]string{"Type": "Notification", "TopicArn": topic, "Message": message})
+	b.messages = append(b.messages, &sqs.Message{MessageId: aws.String(id), Body: aws.String(string(body))})
+	return id, nil
+}
+
+func (b *fakeBus) PeekMessages(queueURL string) (*sqs.ReceiveMessageOutput, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return &sqs.ReceiveMessageOutput{Messages: append([]*sqs.Message{}, b.messages...)}, nil
+}
+
+func TestSNSWatcher(t *testing.T) {
+	db := newTestDB(t)
+	bus := &fakeBus{}
+	cfg := rbac.SNSWatcherConfig{TopicARN: "arn:aws:sns:ap-southeast-1:0:rbac", QueueURL: "https://sqs.test/rbac", Interval: testInterval}
+	newRBAC := func() *rbac.RBAC {
+		return rbac.NewWithConfig(rbac.Config{GormDB: db, Watcher: rbac.NewSNSWatcher(bus, bus, cfg)})
+	}
+
+	assertPropagated(t, newRBAC(), newRBAC())
+
+	// unrelated messages are ignored
+	reloaded := 0
+	w := rbac.NewSNSWatcher(bus, bus, cfg)
+	w.SetUpdateCallback(func(string) { reloaded++ })
+	bus.messages = []*sqs.Message{{MessageId: aws.String("x"), Body: aws.String(`{"event":"other"}`)}}
+	w.Poll()
+	assert.Equal(t, 0, reloaded)
+
+	// reloaded anyway once the notifications may have expired unseen
+	cfg.Retention = 3 * testInterval
+	w = rbac.NewSNSWatcher(bus, bus, cfg)
+	w.SetUpdateCallback(func(string) { reloaded++ })
+	w.Poll()
+	assert.Equal(t, 0, reloaded)
+	time.Sleep(cfg.Retention)
+	w.Poll()
+	assert.Equal(t, 1, reloaded)
+	time.Sleep(2 * testInterval)
+	w.Poll()
+	assert.Equal(t, 1, reloaded)
+}
@@ -16,6 +16,8 @@ const (
 	GenericErrorType = "GENERIC"
 	// ValidationErrorType type of common errors
 	ValidationErrorType = "VALIDATION"
+	// ConflictErrorType type of the errors caused by concurrent modifications
+	ConflictErrorType = "CONFLICT"
 )
 
 // ErrorResponse represents the error response
@@ -57,6 +59,12 @@ func NewHTTPValidationError(message string) *HTTPError {
 	return &HTTPError{Code: http.StatusBadRequest, Type: ValidationErrorType, Message: message}
 }
 
+// NewHTTPConflictError creates a new HTTPError instance for the record modified since the client read it,
+// e.g: the If-Match header does not match the current version
+func NewHTTPConflictError(message string) *HTTPError {
+	return &HTTPError{Code: http.StatusPreconditionFailed, Type: ConflictErrorType, Message: message}
+}
+
 // Error makes it compatible with `error` interface
 func (he *HTTPError) Error() string {
 	return fmt.Sprintf("code=%d, type=%s, message=%s", he.Code, he.Type, he.Message)
@@ -0,0 +1,48 @@
+package jwt
+
+import (
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// claimsCtxKey is the echo.Context key where the middleware stores the token claims
+const claimsCtxKey = "jwt.claims"
+
+// Claims represents the typed claims of the token:
+// the registered claims (sub, iss, aud, exp, nbf, iat, jti) plus the custom ones of the application
+type Claims struct {
+	jwt.RegisteredClaims
+	// SessionID is the login session that the token is issued for
+	SessionID string `json:"sid,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Email     string `json:"email,omitempty"`
+	Role      string `json:"role,omitempty"`
+	// Scope restricts the token to the space separated scopes, e.g: "read write".
+	// Empty means unrestricted, as for interactive logins
+	Scope string `json:"scope,omitempty"`
+	// Actor is the party acting on behalf of the subject (RFC 8693), set on impersonation
+	Actor *Actor `json:"act,omitempty"`
+	// Tenant binds the token to a tenant, e.g: an organization ID
+	Tenant string `json:"org,omitempty"`
+	// IssuedAtMs is the issuance time in milliseconds, `iat` is in seconds only.
+	// The revocations of the subject are checked against it, see Service.RevokeSubject
+	IssuedAtMs int64 `json:"iat_ms,omitempty"`
+}
+
+// Actor represents the acting party of a delegated token
+type Actor struct {
+	Subject  string `json:"sub"`
+	Username string `json:"username,omitempty"`
+}
+
+// GetClaims returns the claims of the authenticated token stored in the context by the middleware.
+// The second return value is false if the request is not authenticated by a token.
+func GetClaims(c echo.Context) (*Claims, bool) {
+	claims, ok := c.Get(claimsCtxKey).(*Claims)
+	return claims, ok && claims != nil
+}
+
+// SetClaims stores the claims into the context
+func SetClaims(c echo.Context, claims *Claims) {
+	c.Set(claimsCtxKey, claims)
+}
@@ -1,38 +1,94 @@
 package jwt
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/M15t/ghoul/pkg/server"
+	"github.com/M15t/ghoul/pkg/util/crypter"
 
 	jwt "github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 )
 
+// Custom errors
+var (
+	ErrUnauthorized      = server.NewHTTPError(http.StatusUnauthorized, "UNAUTHORIZED", "Your session is unauthorized or has expired.")
+	ErrNoRevocationStore = errors.New("jwt revocation store is not configured")
+	errTokenRevoked      = errors.New("token revoked")
+)
+
+// Config represents the configuration for JWT service
+type Config struct {
+	// Signing algorithm, e.g: HS256. Ignored if KeySet is given
+	Algorithm string
+	// Secret key used for signing with HMAC algorithm. Ignored if KeySet is given
+	Secret string
+	// KeySet holds the keys for asymmetric algorithms or key rotation
+	KeySet *KeySet
+	// Duration (in seconds) for which the jwt token is valid
+	Duration int
+	// Issuer is set to the `iss` claim of generated tokens, and required on parsing if not empty
+	Issuer string
+	// Audience is set to the `aud` claim of generated tokens, and required on parsing if not empty
+	Audience string
+	// Leeway is the allowed clock skew when validating `exp`, `nbf` & `iat` claims
+	Leeway time.Duration
+	// RevocationStore holds the deny-list of revoked tokens. Optional, no revocation check if nil
+	RevocationStore RevocationStore
+}
+
 // New generates new JWT service necessery for auth middleware
 func New(algo, secret string, duration int) *Service {
-	signingMethod := jwt.GetSigningMethod(algo)
-	if signingMethod == nil {
-		panic("invalid jwt signing method")
+	return NewWithConfig(Config{Algorithm: algo, Secret: secret, Duration: duration})
+}
+
+// NewWithConfig generates new JWT service with custom configuration
+func NewWithConfig(cfg Config) *Service {
+	if cfg.KeySet == nil {
+		key, err := NewHMACKey("", cfg.Algorithm, cfg.Secret)
+		if err != nil {
+			panic("invalid jwt signing method")
+		}
+		cfg.KeySet = NewKeySet(key)
+	}
+	if cfg.KeySet.Active() == nil {
+		panic(ErrNoActiveKey)
+	}
+	opts := []jwt.ParserOption{jwt.WithExpirationRequired(), jwt.WithIssuedAt(), jwt.WithLeeway(cfg.Leeway)}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
 	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+
 	return &Service{
-		algo:     signingMethod,
-		key:      []byte(secret),
-		duration: time.Duration(duration) * time.Second,
+		keys:     cfg.KeySet,
+		duration: time.Duration(cfg.Duration) * time.Second,
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+		parser:   jwt.NewParser(opts...),
+		store:    cfg.RevocationStore,
 	}
 }
 
 // Service provides a Json-Web-Token authentication implementation
 type Service struct {
-	// Secret key used for signing.
-	key []byte
+	// Keys used for signing & verifying.
+	keys *KeySet
 	// Duration (in seconds) for which the jwt token is valid.
 	duration time.Duration
-	// Service signing algorithm
-	algo jwt.SigningMethod
+	// Issuer & audience of the tokens
+	issuer   string
+	audience string
+	// Parser with the validation options
+	parser *jwt.Parser
+	// Deny-list of revoked tokens
+	store RevocationStore
 }
 
 // MWFunc makes JWT implement the Middleware interface.
@@ -44,14 +100,20 @@ func (j *Service) MWFunc() echo.MiddlewareFunc {
 				if err != nil {
 					c.Logger().Errorf("error parsing token: %+v", err)
 				}
-				return server.NewHTTPError(http.StatusUnauthorized, "UNAUTHORIZED", "Your session is unauthorized or has expired.").SetInternal(err)
+				return ErrUnauthorized.SetInternal(err)
 			}
 
-			claims := token.Claims.(jwt.MapClaims)
-			for key, val := range claims {
-				c.Set(key, val)
+			claims := token.Claims.(*Claims)
+			revoked, err := j.isRevoked(claims)
+			if err != nil {
+				return server.NewHTTPInternalError("Error checking token revocation").SetInternal(err)
+			}
+			if revoked {
+				return ErrUnauthorized.SetInternal(errTokenRevoked)
 			}
 
+			SetClaims(c, claims)
+
 			return next(c)
 		}
 	}
@@ -71,26 +133,103 @@ func (j *Service) ParseTokenFromHeader(c echo.Context) (*jwt.Token, error) {
 	return j.ParseToken(parts[1])
 }
 
-// ParseToken parses token from string
+// ParseToken parses token from string, verified by the key matching the `kid` header (or the active key if missing).
+// The token claims are of *Claims type.
 func (j *Service) ParseToken(input string) (*jwt.Token, error) {
-	return jwt.Parse(input, func(token *jwt.Token) (interface{}, error) {
-		if j.algo != token.Method {
+	return j.parser.ParseWithClaims(input, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		key := j.keys.Active()
+		if kid, ok := token.Header["kid"].(string); ok {
+			key = j.keys.Lookup(kid)
+		}
+		if key == nil || key.Retired {
+			return nil, ErrKeyNotFound
+		}
+		if key.Method != token.Method {
 			return nil, fmt.Errorf("token method mismatched")
 		}
-		return j.key, nil
+		return key.verifyKey, nil
 	})
 }
 
-// GenerateToken generates new Service token and populates it with user data
-func (j *Service) GenerateToken(claims map[string]interface{}, expire *time.Time) (string, int, error) {
+// GenerateToken generates new Service token and populates it with user data.
+// The registered claims `exp`, `iat`, `nbf`, `jti`, `iss` & `aud` are filled if missing, so is `iat_ms`.
+func (j *Service) GenerateToken(claims *Claims, expire *time.Time) (string, int, error) {
+	now := time.Now()
 	if expire == nil {
-		expTime := time.Now().Add(j.duration)
+		expTime := now.Add(j.duration)
 		expire = &expTime
 	}
-	claims["exp"] = expire.Unix()
+	claims.ExpiresAt = jwt.NewNumericDate(*expire)
+	if claims.IssuedAt == nil {
+		claims.IssuedAt = jwt.NewNumericDate(now)
+		if claims.IssuedAtMs == 0 {
+			claims.IssuedAtMs = now.UnixMilli()
+		}
+	}
+	if claims.IssuedAtMs == 0 {
+		claims.IssuedAtMs = claims.IssuedAt.UnixMilli()
+	}
+	if claims.NotBefore == nil {
+		claims.NotBefore = claims.IssuedAt
+	}
+	if claims.ID == "" {
+		claims.ID = crypter.UID()
+	}
+	if claims.Issuer == "" {
+		claims.Issuer = j.issuer
+	}
+	if len(claims.Audience) == 0 && j.audience != "" {
+		claims.Audience = jwt.ClaimStrings{j.audience}
+	}
+
+	key := j.keys.Active()
+	if key.signKey == nil {
+		return "", 0, ErrVerifyOnlyKey
+	}
+	token := jwt.NewWithClaims(key.Method, claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+	tokenString, err := token.SignedString(key.signKey)
+
+	return tokenString, int(expire.Sub(now).Seconds()), err
+}
 
-	token := jwt.NewWithClaims(j.algo, jwt.MapClaims(claims))
-	tokenString, err := token.SignedString(j.key)
+// JWKS returns the public keys to verify the tokens
+func (j *Service) JWKS() *JWKS {
+	return j.keys.JWKS()
+}
 
-	return tokenString, int(expire.Sub(time.Now()).Seconds()), err
+// RevokeToken adds the token ID to the deny-list until the token expires
+func (j *Service) RevokeToken(jti string, expiresAt time.Time) error {
+	if j.store == nil {
+		return ErrNoRevocationStore
+	}
+	return j.store.RevokeToken(jti, expiresAt)
+}
+
+// RevokeSubject denies all tokens issued to the subject until now, compared in milliseconds by the `iat_ms` claim
+func (j *Service) RevokeSubject(sub string) error {
+	if j.store == nil {
+		return ErrNoRevocationStore
+	}
+	// at the precision of `iat_ms`, the tokens issued in the current millisecond are denied
+	until := time.Now().Truncate(time.Millisecond)
+	return j.store.RevokeSubject(sub, until, until.Add(j.duration))
+}
+
+// isRevoked checks the token claims against the deny-list
+func (j *Service) isRevoked(claims *Claims) (bool, error) {
+	if j.store == nil {
+		return false, nil
+	}
+	var issuedAt time.Time
+	switch {
+	case claims.IssuedAtMs > 0:
+		issuedAt = time.UnixMilli(claims.IssuedAtMs)
+	case claims.IssuedAt != nil:
+		// issued without `iat_ms`, the tokens issued in the second of the revocation are denied
+		issuedAt = claims.IssuedAt.Time
+	}
+	return j.store.IsRevoked(claims.ID, claims.Subject, issuedAt)
 }
@@ -0,0 +1,262 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+// Custom errors
+var (
+	ErrKeyNotFound   = errors.New("signing key not found")
+	ErrNoActiveKey   = errors.New("no active signing key")
+	ErrVerifyOnlyKey = errors.New("signing key has no private part")
+)
+
+// Key represents a single key of the keyset.
+// HMAC keys hold the same secret for both signing & verifying, the asymmetric ones hold the private & public key.
+type Key struct {
+	// ID is set as the `kid` header of the signed tokens
+	ID string
+	// Method is the signing algorithm of the key
+	Method jwt.SigningMethod
+	// Retired keys are no longer accepted to verify tokens
+	Retired bool
+
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// NewHMACKey creates new symmetric key for HS256, HS384 or HS512 algorithm
+func NewHMACKey(kid, algo, secret string) (*Key, error) {
+	method, ok := jwt.GetSigningMethod(algo).(*jwt.SigningMethodHMAC)
+	if !ok {
+		return nil, fmt.Errorf("invalid hmac signing method: %s", algo)
+	}
+	return &Key{ID: kid, Method: method, signKey: []byte(secret), verifyKey: []byte(secret)}, nil
+}
+
+// ParseKeyPEM parses the PEM encoded private key (signing & verifying) or public key (verifying only)
+// for RS*, PS*, ES* or EdDSA algorithm
+func ParseKeyPEM(kid, algo string, data []byte) (*Key, error) {
+	method := jwt.GetSigningMethod(algo)
+	if method == nil {
+		return nil, fmt.Errorf("invalid jwt signing method: %s", algo)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("invalid PEM data for key %q", kid)
+	}
+	isPublic := strings.Contains(block.Type, "PUBLIC KEY")
+
+	key := &Key{ID: kid, Method: method}
+	var err error
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if isPublic {
+			key.verifyKey, err = jwt.ParseRSAPublicKeyFromPEM(data)
+		} else {
+			var pk *rsa.PrivateKey
+			if pk, err = jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+				key.signKey, key.verifyKey = pk, &pk.PublicKey
+			}
+		}
+	case *jwt.SigningMethodECDSA:
+		if isPublic {
+			key.verifyKey, err = jwt.ParseECPublicKeyFromPEM(data)
+		} else {
+			var pk *ecdsa.PrivateKey
+			if pk, err = jwt.ParseECPrivateKeyFromPEM(data); err == nil {
+				key.signKey, key.verifyKey = pk, &pk.PublicKey
+			}
+		}
+	case *jwt.SigningMethodEd25519:
+		if isPublic {
+			key.verifyKey, err = jwt.ParseEdPublicKeyFromPEM(data)
+		} else {
+			var pk crypto.PrivateKey
+			if pk, err = jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+				key.signKey, key.verifyKey = pk, pk.(ed25519.PrivateKey).Public()
+			}
+		}
+	default:
+		return nil, fmt.Errorf("signing method %s does not use PEM keys", algo)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing key %q: %w", kid, err)
+	}
+
+	return key, nil
+}
+
+// LoadKeyFile loads the PEM encoded key from file, the file name without extension is used as the key ID
+func LoadKeyFile(path, algo string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	kid := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return ParseKeyPEM(kid, algo, data)
+}
+
+// NewKeySet creates new keyset, the first key is the active one
+func NewKeySet(keys ...*Key) *KeySet {
+	ks := &KeySet{}
+	for _, k := range keys {
+		ks.Add(k)
+	}
+	return ks
+}
+
+// LoadKeySet loads the keyset from PEM files. See LoadKeyFile for the key IDs.
+// `active` is the ID of the signing key, default to the first one. The `retired` keys are rejected on verifying.
+func LoadKeySet(algo string, files []string, active string, retired []string) (*KeySet, error) {
+	ks := NewKeySet()
+	for _, f := range files {
+		key, err := LoadKeyFile(f, algo)
+		if err != nil {
+			return nil, err
+		}
+		ks.Add(key)
+	}
+	if active != "" {
+		if err := ks.SetActive(active); err != nil {
+			return nil, err
+		}
+	}
+	for _, kid := range retired {
+		if err := ks.Retire(kid); err != nil {
+			return nil, err
+		}
+	}
+	return ks, nil
+}
+
+// KeySet holds all keys used for signing & verifying tokens. Only the active key is used for signing,
+// all the non-retired keys are accepted for verifying, which allows rotating keys without invalidating issued tokens.
+type KeySet struct {
+	keys   []*Key
+	active *Key
+}
+
+// Add adds the key to the keyset, it becomes the active key if there is none
+func (ks *KeySet) Add(key *Key) {
+	ks.keys = append(ks.keys, key)
+	if ks.active == nil && !key.Retired {
+		ks.active = key
+	}
+}
+
+// SetActive sets the signing key
+func (ks *KeySet) SetActive(kid string) error {
+	key := ks.Lookup(kid)
+	if key == nil {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, kid)
+	}
+	if key.Retired {
+		return fmt.Errorf("cannot activate retired key: %s", kid)
+	}
+	ks.active = key
+	return nil
+}
+
+// Retire marks the key as retired, tokens signed by it are no longer valid
+func (ks *KeySet) Retire(kid string) error {
+	key := ks.Lookup(kid)
+	if key == nil {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, kid)
+	}
+	if key == ks.active {
+		return fmt.Errorf("cannot retire the active key: %s", kid)
+	}
+	key.Retired = true
+	return nil
+}
+
+// Active returns the signing key
+func (ks *KeySet) Active() *Key {
+	return ks.active
+}
+
+// Lookup returns the key by ID, or nil if not found
+func (ks *KeySet) Lookup(kid string) *Key {
+	for _, k := range ks.keys {
+		if k.ID == kid {
+			return k
+		}
+	}
+	return nil
+}
+
+// JWK represents a JSON Web Key (RFC 7517) of a public key
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC & OKP
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS represents a JSON Web Key Set
+// swagger:model
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns public parts of all non-retired asymmetric keys
+func (ks *KeySet) JWKS() *JWKS {
+	set := &JWKS{Keys: []JWK{}}
+	for _, k := range ks.keys {
+		if k.Retired {
+			continue
+		}
+		if jwk, ok := k.jwk(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+func (k *Key) jwk() (JWK, bool) {
+	enc := base64.RawURLEncoding.EncodeToString
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+
+	switch pub := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = enc(pub.N.Bytes())
+		jwk.E = enc(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = enc(pub.X.FillBytes(make([]byte, size)))
+		jwk.Y = enc(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = enc(pub)
+	default:
+		// symmetric keys must never be published
+		return jwk, false
+	}
+
+	return jwk, true
+}
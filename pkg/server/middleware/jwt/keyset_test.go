@@ -0,0 +1,117 @@
+package jwt_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/M15t/ghoul/pkg/server/middleware/jwt"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeKeyFile(t *testing.T, dir, kid string, key interface{}) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, kid+".pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestKeySet(t *testing.T) {
+	rsaKey1, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rsaKey2, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	cases := []struct {
+		name    string
+		algo    string
+		keys    []interface{}
+		wantKty string
+	}{
+		{name: "RS256", algo: "RS256", keys: []interface{}{rsaKey1, rsaKey2}, wantKty: "RSA"},
+		{name: "ES256", algo: "ES256", keys: []interface{}{ecKey}, wantKty: "EC"},
+		{name: "EdDSA", algo: "EdDSA", keys: []interface{}{edKey}, wantKty: "OKP"},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var files []string
+			for i, k := range tt.keys {
+				files = append(files, writeKeyFile(t, dir, tt.name+"-"+string(rune('a'+i)), k))
+			}
+
+			ks, err := jwt.LoadKeySet(tt.algo, files, "", nil)
+			assert.Nil(t, err)
+			j := jwt.NewWithConfig(jwt.Config{KeySet: ks, Duration: 60})
+
+			token, _, err := j.GenerateToken(&jwt.Claims{Username: "superadmin"}, nil)
+			assert.Nil(t, err)
+			parsed, err := j.ParseToken(token)
+			assert.Nil(t, err)
+			assert.True(t, parsed.Valid)
+			assert.Equal(t, tt.name+"-a", parsed.Header["kid"])
+
+			jwks := j.JWKS()
+			assert.Len(t, jwks.Keys, len(tt.keys))
+			assert.Equal(t, tt.wantKty, jwks.Keys[0].Kty)
+			assert.Equal(t, tt.algo, jwks.Keys[0].Alg)
+			assert.Equal(t, tt.name+"-a", jwks.Keys[0].Kid)
+		})
+	}
+
+	t.Run("Rotation", func(t *testing.T) {
+		dir := t.TempDir()
+		files := []string{writeKeyFile(t, dir, "old", rsaKey1), writeKeyFile(t, dir, "new", rsaKey2)}
+
+		oldKs, _ := jwt.LoadKeySet("RS256", files, "old", nil)
+		oldToken, _, _ := jwt.NewWithConfig(jwt.Config{KeySet: oldKs, Duration: 60}).GenerateToken(&jwt.Claims{Username: "superadmin"}, nil)
+
+		// tokens signed by the previous key are still accepted after rotation
+		newKs, _ := jwt.LoadKeySet("RS256", files, "new", nil)
+		j := jwt.NewWithConfig(jwt.Config{KeySet: newKs, Duration: 60})
+		_, err := j.ParseToken(oldToken)
+		assert.Nil(t, err)
+		newToken, _, _ := j.GenerateToken(&jwt.Claims{Username: "superadmin"}, nil)
+		parsed, _ := j.ParseToken(newToken)
+		assert.Equal(t, "new", parsed.Header["kid"])
+
+		// until the previous key is retired
+		retiredKs, _ := jwt.LoadKeySet("RS256", files, "new", []string{"old"})
+		j = jwt.NewWithConfig(jwt.Config{KeySet: retiredKs, Duration: 60})
+		_, err = j.ParseToken(oldToken)
+		assert.ErrorIs(t, err, jwt.ErrKeyNotFound)
+		assert.Len(t, j.JWKS().Keys, 1)
+
+		// the active key cannot be retired
+		_, err = jwt.LoadKeySet("RS256", files, "new", []string{"new"})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Verify only key", func(t *testing.T) {
+		der, _ := x509.MarshalPKIXPublicKey(&rsaKey1.PublicKey)
+		key, err := jwt.ParseKeyPEM("pub", "RS256", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+		assert.Nil(t, err)
+		j := jwt.NewWithConfig(jwt.Config{KeySet: jwt.NewKeySet(key), Duration: 60})
+		_, _, err = j.GenerateToken(&jwt.Claims{Username: "superadmin"}, nil)
+		assert.Equal(t, jwt.ErrVerifyOnlyKey, err)
+	})
+
+	t.Run("HMAC keys are not published", func(t *testing.T) {
+		j := jwt.New("HS256", "jwtsecret", 60)
+		assert.Empty(t, j.JWKS().Keys)
+	})
+}
@@ -0,0 +1,143 @@
+package jwt
+
+import (
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RevocationStore represents the deny-list storage of revoked tokens
+type RevocationStore interface {
+	// RevokeToken denies the single token by its ID (jti claim) until it expires
+	RevokeToken(jti string, expiresAt time.Time) error
+	// RevokeSubject denies all tokens of the subject (sub claim) issued until the given time, inclusive.
+	// `expiresAt` is the moment when all those tokens are expired, so the entry can be purged.
+	RevokeSubject(sub string, until time.Time, expiresAt time.Time) error
+	// IsRevoked checks whether the token is denied
+	IsRevoked(jti, sub string, issuedAt time.Time) (bool, error)
+}
+
+// NewMemoryStore creates new in-memory revocation store.
+// Note: Entries are not shared between instances, use it for single instance deployment or testing only
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		tokens:   make(map[string]time.Time),
+		subjects: make(map[string]subjectRevocation),
+	}
+}
+
+// MemoryStore is the in-memory implementation of RevocationStore
+type MemoryStore struct {
+	mu       sync.RWMutex
+	tokens   map[string]time.Time
+	subjects map[string]subjectRevocation
+}
+
+type subjectRevocation struct {
+	until     time.Time
+	expiresAt time.Time
+}
+
+// RevokeToken denies the single token by its ID until it expires
+func (s *MemoryStore) RevokeToken(jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge()
+	s.tokens[jti] = expiresAt
+	return nil
+}
+
+// RevokeSubject denies all tokens of the subject issued until the given time, inclusive
+func (s *MemoryStore) RevokeSubject(sub string, until time.Time, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge()
+	if cur, ok := s.subjects[sub]; ok && cur.until.After(until) {
+		return nil
+	}
+	s.subjects[sub] = subjectRevocation{until: until, expiresAt: expiresAt}
+	return nil
+}
+
+// IsRevoked checks whether the token is denied
+func (s *MemoryStore) IsRevoked(jti, sub string, issuedAt time.Time) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.tokens[jti]; ok && jti != "" {
+		return true, nil
+	}
+	if rev, ok := s.subjects[sub]; ok && sub != "" && !issuedAt.After(rev.until) {
+		return true, nil
+	}
+	return false, nil
+}
+
+// purge removes expired entries. The lock must be held by the caller
+func (s *MemoryStore) purge() {
+	now := time.Now()
+	for k, exp := range s.tokens {
+		if exp.Before(now) {
+			delete(s.tokens, k)
+		}
+	}
+	for k, rev := range s.subjects {
+		if rev.expiresAt.Before(now) {
+			delete(s.subjects, k)
+		}
+	}
+}
+
+// Revocation represents a deny-list entry, either a single token (JTI) or all tokens of a subject issued until RevokedBefore, inclusive
+type Revocation struct {
+	ID            int        `gorm:"primary_key"`
+	JTI           string     `gorm:"type:varchar(255);index"`
+	Subject       string     `gorm:"type:varchar(255);index"`
+	RevokedBefore *time.Time `gorm:"index"`
+	ExpiresAt     time.Time  `gorm:"index"`
+	CreatedAt     time.Time
+}
+
+// TableName overrides the table name
+func (Revocation) TableName() string {
+	return "jwt_revocations"
+}
+
+// NewDBStore creates new database backed revocation store.
+// The `jwt_revocations` table must be migrated beforehand, see Revocation model.
+func NewDBStore(db *gorm.DB) *DBStore {
+	return &DBStore{db}
+}
+
+// DBStore is the database implementation of RevocationStore, shared between all instances
+type DBStore struct {
+	db *gorm.DB
+}
+
+// RevokeToken denies the single token by its ID until it expires
+func (s *DBStore) RevokeToken(jti string, expiresAt time.Time) error {
+	return s.db.Create(&Revocation{JTI: jti, ExpiresAt: expiresAt}).Error
+}
+
+// RevokeSubject denies all tokens of the subject issued until the given time, inclusive
+func (s *DBStore) RevokeSubject(sub string, until time.Time, expiresAt time.Time) error {
+	return s.db.Create(&Revocation{Subject: sub, RevokedBefore: &until, ExpiresAt: expiresAt}).Error
+}
+
+// IsRevoked checks whether the token is denied
+func (s *DBStore) IsRevoked(jti, sub string, issuedAt time.Time) (bool, error) {
+	var count int64
+	err := s.db.Model(&Revocation{}).
+		Where("expires_at > ?", time.Now()).
+		Where(s.db.Where("jti = ? AND jti <> ''", jti).Or("subject = ? AND subject <> '' AND revoked_before >= ?", sub, issuedAt)).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// Purge permanently removes the expired entries
+func (s *DBStore) Purge() error {
+	return s.db.Where("expires_at <= ?", time.Now()).Delete(&Revocation{}).Error
+}
@@ -0,0 +1,104 @@
+// Package keyauth provides the middleware authenticating requests by API key,
+// falling back to another authentication (e.g: JWT) for requests without the key.
+package keyauth
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/M15t/ghoul/pkg/server"
+	"github.com/M15t/ghoul/pkg/server/middleware/jwt"
+
+	"github.com/labstack/echo/v4"
+)
+
+// DefaultHeader is the request header carrying the API key
+const DefaultHeader = "X-API-Key"
+
+// Scopes of API keys. The write scope implies the read scope
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// ErrInsufficientScope is returned when the scopes of the key do not allow the request
+var ErrInsufficientScope = server.NewHTTPError(http.StatusForbidden, "INSUFFICIENT_SCOPE", "The API key does not allow this request")
+
+// Validator validates the API key, returns the claims of its owner.
+// The returned error is responded as is, use an *echo.HTTPError to control the response.
+type Validator func(c echo.Context, key string) (*jwt.Claims, error)
+
+// Config represents the middleware configuration
+type Config struct {
+	// Header carrying the API key, defaults to DefaultHeader
+	Header string
+	// Validator is required
+	Validator Validator
+	// Fallback authenticates the requests without API key, e.g: jwt.Service.MWFunc().
+	// If nil, such requests are rejected as unauthorized
+	Fallback echo.MiddlewareFunc
+}
+
+// New returns the middleware authenticating requests by API key.
+// The claims returned by the validator are stored as the JWT claims, see jwt.GetClaims.
+// Safe methods (GET, HEAD, OPTIONS) require the read scope, the others require the write scope.
+func New(cfg Config) echo.MiddlewareFunc {
+	if cfg.Validator == nil {
+		panic("keyauth: validator is required")
+	}
+	if cfg.Header == "" {
+		cfg.Header = DefaultHeader
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		fallback := next
+		if cfg.Fallback != nil {
+			fallback = cfg.Fallback(next)
+		}
+
+		return func(c echo.Context) error {
+			key := strings.TrimSpace(c.Request().Header.Get(cfg.Header))
+			if key == "" {
+				if cfg.Fallback == nil {
+					return jwt.ErrUnauthorized
+				}
+				return fallback(c)
+			}
+
+			claims, err := cfg.Validator(c, key)
+			if err != nil {
+				return err
+			}
+			if !Allows(claims, c.Request().Method) {
+				return ErrInsufficientScope
+			}
+			jwt.SetClaims(c, claims)
+
+			return next(c)
+		}
+	}
+}
+
+// Allows checks whether the scope of the claims allows the request method. Unrestricted claims allow any method
+func Allows(claims *jwt.Claims, method string) bool {
+	if claims.Scope == "" {
+		return true
+	}
+
+	scopes := strings.Fields(claims.Scope)
+	for _, s := range scopes {
+		if s == ScopeWrite {
+			return true
+		}
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		for _, s := range scopes {
+			if s == ScopeRead {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,113 @@
+package keyauth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/M15t/ghoul/pkg/server"
+	"github.com/M15t/ghoul/pkg/server/middleware/jwt"
+	"github.com/M15t/ghoul/pkg/server/middleware/keyauth"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var keys = map[string]*jwt.Claims{
+	"ghl_read":  {Username: "reader", Scope: keyauth.ScopeRead},
+	"ghl_write": {Username: "writer", Scope: keyauth.ScopeWrite},
+}
+
+func validator(c echo.Context, key string) (*jwt.Claims, error) {
+	claims, ok := keys[key]
+	if !ok {
+		return nil, jwt.ErrUnauthorized
+	}
+	return claims, nil
+}
+
+// fallback authenticates any request carrying the Authorization header
+func fallback(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if c.Request().Header.Get("Authorization") == "" {
+			return jwt.ErrUnauthorized
+		}
+		jwt.SetClaims(c, &jwt.Claims{Username: "bearer"})
+		return next(c)
+	}
+}
+
+func echoHandler(mw echo.MiddlewareFunc) *echo.Echo {
+	e := echo.New()
+	e.HTTPErrorHandler = server.NewErrorHandler(e).Handle
+	e.Use(mw)
+	h := func(c echo.Context) error {
+		claims, _ := jwt.GetClaims(c)
+		return c.String(http.StatusOK, claims.Username)
+	}
+	e.GET("/hello", h)
+	e.POST("/hello", h)
+	return e
+}
+
+func TestNew(t *testing.T) {
+	cases := []struct {
+		name       string
+		method     string
+		key        string
+		bearer     bool
+		wantStatus int
+		wantUser   string
+	}{
+		{name: "no credentials", method: http.MethodGet, wantStatus: http.StatusUnauthorized},
+		{name: "fallback", method: http.MethodGet, bearer: true, wantStatus: http.StatusOK, wantUser: "bearer"},
+		{name: "invalid key", method: http.MethodGet, key: "ghl_invalid", bearer: true, wantStatus: http.StatusUnauthorized},
+		{name: "read key reads", method: http.MethodGet, key: "ghl_read", wantStatus: http.StatusOK, wantUser: "reader"},
+		{name: "read key writes", method: http.MethodPost, key: "ghl_read", wantStatus: http.StatusForbidden},
+		{name: "write key reads", method: http.MethodGet, key: "ghl_write", wantStatus: http.StatusOK, wantUser: "writer"},
+		{name: "write key writes", method: http.MethodPost, key: "ghl_write", wantStatus: http.StatusOK, wantUser: "writer"},
+	}
+
+	e := echoHandler(keyauth.New(keyauth.Config{Validator: validator, Fallback: fallback}))
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/hello", nil)
+			if tt.key != "" {
+				req.Header.Set(keyauth.DefaultHeader, tt.key)
+			}
+			if tt.bearer {
+				req.Header.Set("Authorization", "Bearer x")
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantUser != "" {
+				assert.Equal(t, tt.wantUser, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestNewWithoutFallback(t *testing.T) {
+	e := echoHandler(keyauth.New(keyauth.Config{Header: "X-Key", Validator: validator}))
+
+	req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+	req.Header.Set("Authorization", "Bearer x")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/hello", nil)
+	req.Header.Set("X-Key", "ghl_read")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestAllows(t *testing.T) {
+	assert.True(t, keyauth.Allows(&jwt.Claims{}, http.MethodDelete))
+	assert.True(t, keyauth.Allows(&jwt.Claims{Scope: "read"}, http.MethodHead))
+	assert.False(t, keyauth.Allows(&jwt.Claims{Scope: "read"}, http.MethodPatch))
+	assert.True(t, keyauth.Allows(&jwt.Claims{Scope: "read write"}, http.MethodPatch))
+	assert.False(t, keyauth.Allows(&jwt.Claims{Scope: "other"}, http.MethodGet))
+}
@@ -44,10 +44,12 @@ func TestCORS(t *testing.T) {
 	defer ts.Close()
 	var cl http.Client
 	req, _ := http.NewRequest("OPTIONS", ts.URL+"/hello", nil)
+	req.Header.Set("Origin", "http://localhost:3000")
+	req.Header.Set("Access-Control-Request-Method", "PATCH")
 	resp, _ := cl.Do(req)
 	assert.Equal(t, "86400", resp.Header.Get("Access-Control-Max-Age"))
 	assert.Equal(t, "POST,GET,PUT,DELETE,PATCH,HEAD", resp.Header.Get("Access-Control-Allow-Methods"))
-	assert.Equal(t, "Origin,Content-Type,Accept,Authorization", resp.Header.Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "Origin,Content-Type,Accept,Authorization,If-Match,X-Organization-ID,X-API-Key", resp.Header.Get("Access-Control-Allow-Headers"))
 	assert.Equal(t, "true", resp.Header.Get("Access-Control-Allow-Credentials"))
 	// assert.Equal(t, "Content-Length", resp.Header.Get("Access-Control-Expose-Headers"))
 	// assert.Equal(t, "*", resp.Header.Get("Access-Control-Allow-Origin"))
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/M15t/ghoul/pkg/server/middleware/jwt"
 	dblogger "github.com/M15t/ghoul/pkg/util/db/logger"
 	"github.com/M15t/ghoul/pkg/util/threadsafe"
 	"github.com/labstack/echo/v4"
@@ -30,6 +31,7 @@ var (
 		"cookie":        {},
 		"set-cookie":    {},
 		"x-auth-token":  {},
+		"x-api-key":     {},
 		"x-csrf-token":  {},
 		"x-xsrf-token":  {},
 	}
@@ -55,6 +57,9 @@ type Config struct {
 	WithSpanID         bool
 	WithTraceID        bool
 	WithDBQueries      bool
+	// WithUser logs the ID of the authenticated user as `user_id`.
+	// The impersonator is always logged as `actor_id`, regardless of this option
+	WithUser bool
 
 	Filters []Filter
 }
@@ -208,6 +213,16 @@ func NewWithConfig(logger *slog.Logger, config Config) echo.MiddlewareFunc {
 				}
 			}
 
+			// authenticated user
+			if claims, ok := jwt.GetClaims(c); ok {
+				if config.WithUser {
+					baseAttributes = append(baseAttributes, slog.String("user_id", claims.Subject))
+				}
+				if claims.Actor != nil {
+					baseAttributes = append(baseAttributes, slog.String("actor_id", claims.Actor.Subject))
+				}
+			}
+
 			// request body
 			if config.WithRequestBody {
 				// proceed body dump
@@ -1,9 +1,17 @@
 package slogger
 
 import (
+	"bytes"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/M15t/ghoul/pkg/server/middleware/jwt"
+
+	jwtgo "github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -33,3 +41,40 @@ func TestMiddlewareFuncIsReturned(t *testing.T) {
 	// Assert that the returned value is a MiddlewareFunc
 	assert.NotNil(t, middlewareFunc)
 }
+
+func TestUserAttributes(t *testing.T) {
+	cases := []struct {
+		name      string
+		withUser  bool
+		claims    *jwt.Claims
+		wantUser  bool
+		wantActor bool
+	}{
+		{name: "anonymous", withUser: true},
+		{name: "user", withUser: true, claims: &jwt.Claims{RegisteredClaims: jwtgo.RegisteredClaims{Subject: "2"}}, wantUser: true},
+		{name: "user not logged", claims: &jwt.Claims{RegisteredClaims: jwtgo.RegisteredClaims{Subject: "2"}}},
+		{
+			name:      "impersonated",
+			claims:    &jwt.Claims{RegisteredClaims: jwtgo.RegisteredClaims{Subject: "2"}, Actor: &jwt.Actor{Subject: "1"}},
+			wantActor: true,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			e := echo.New()
+			e.Use(NewWithConfig(slog.New(slog.NewJSONHandler(buf, nil)), Config{WithUser: tt.withUser}))
+			e.GET("/", func(c echo.Context) error {
+				if tt.claims != nil {
+					jwt.SetClaims(c, tt.claims)
+				}
+				return c.NoContent(http.StatusOK)
+			})
+			e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+			assert.Equal(t, tt.wantUser, strings.Contains(buf.String(), `"user_id":"2"`))
+			assert.Equal(t, tt.wantActor, strings.Contains(buf.String(), `"actor_id":"1"`))
+		})
+	}
+}
@@ -0,0 +1,87 @@
+// Package tenant provides the middleware resolving the tenant of the authenticated requests,
+// from a request header or the tenant claim of the token.
+package tenant
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/M15t/ghoul/pkg/server"
+	"github.com/M15t/ghoul/pkg/server/middleware/jwt"
+
+	"github.com/labstack/echo/v4"
+)
+
+// DefaultHeader is the request header carrying the tenant ID
+const DefaultHeader = "X-Organization-ID"
+
+// ctxKey is the context key of the resolved tenant
+const ctxKey = "tenant"
+
+// ErrTenantMismatch is returned when the header does not match the tenant the token is bound to
+var ErrTenantMismatch = server.NewHTTPError(http.StatusForbidden, "TENANT_MISMATCH", "The token is bound to another organization")
+
+// Tenant represents the resolved tenant of the request
+type Tenant struct {
+	ID string
+	// Role is the role of the authenticated user in the tenant
+	Role string
+}
+
+// Resolver checks the authenticated user belongs to the tenant, returns the user role in it.
+// The returned error is responded as is, use an *echo.HTTPError to control the response.
+type Resolver func(c echo.Context, id string) (role string, err error)
+
+// Config represents the middleware configuration
+type Config struct {
+	// Header carrying the tenant ID, defaults to DefaultHeader
+	Header string
+	// Resolver is required
+	Resolver Resolver
+}
+
+// New returns the middleware resolving the tenant of the request, which must be authenticated already.
+// The tenant is given by the header or the tenant claim of the token, both must match if given.
+// Requests without tenant are passed through, the handlers requiring one should check Get.
+func New(cfg Config) echo.MiddlewareFunc {
+	if cfg.Resolver == nil {
+		panic("tenant: resolver is required")
+	}
+	if cfg.Header == "" {
+		cfg.Header = DefaultHeader
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id := strings.TrimSpace(c.Request().Header.Get(cfg.Header))
+			if claims, ok := jwt.GetClaims(c); ok && claims.Tenant != "" {
+				if id != "" && id != claims.Tenant {
+					return ErrTenantMismatch
+				}
+				id = claims.Tenant
+			}
+			if id == "" {
+				return next(c)
+			}
+
+			role, err := cfg.Resolver(c, id)
+			if err != nil {
+				return err
+			}
+			Set(c, &Tenant{ID: id, Role: role})
+
+			return next(c)
+		}
+	}
+}
+
+// Get returns the tenant of the request, the second return value is false if there is none
+func Get(c echo.Context) (*Tenant, bool) {
+	t, ok := c.Get(ctxKey).(*Tenant)
+	return t, ok && t != nil
+}
+
+// Set stores the tenant into the context
+func Set(c echo.Context, t *Tenant) {
+	c.Set(ctxKey, t)
+}
@@ -0,0 +1,78 @@
+package tenant_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/M15t/ghoul/pkg/server"
+	"github.com/M15t/ghoul/pkg/server/middleware/jwt"
+	"github.com/M15t/ghoul/pkg/server/middleware/tenant"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var errNotMember = server.NewHTTPError(http.StatusForbidden, "NOT_MEMBER", "Not a member")
+
+// resolver lets the user "jane" in the tenant "1" only
+func resolver(c echo.Context, id string) (string, error) {
+	claims, _ := jwt.GetClaims(c)
+	if claims.Username != "jane" || id != "1" {
+		return "", errNotMember
+	}
+	return "owner", nil
+}
+
+func request(claims *jwt.Claims, header string) *httptest.ResponseRecorder {
+	e := echo.New()
+	e.HTTPErrorHandler = server.NewErrorHandler(e).Handle
+	auth := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			jwt.SetClaims(c, claims)
+			return next(c)
+		}
+	}
+	e.Use(auth, tenant.New(tenant.Config{Resolver: resolver}))
+	e.GET("/hello", func(c echo.Context) error {
+		t, ok := tenant.Get(c)
+		if !ok {
+			return c.String(http.StatusOK, "none")
+		}
+		return c.String(http.StatusOK, t.ID+":"+t.Role)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+	if header != "" {
+		req.Header.Set(tenant.DefaultHeader, header)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestNew(t *testing.T) {
+	cases := []struct {
+		name     string
+		claims   *jwt.Claims
+		header   string
+		wantCode int
+		wantBody string
+	}{
+		{name: "no tenant", claims: &jwt.Claims{Username: "jane"}, wantCode: http.StatusOK, wantBody: "none"},
+		{name: "by header", claims: &jwt.Claims{Username: "jane"}, header: "1", wantCode: http.StatusOK, wantBody: "1:owner"},
+		{name: "by claim", claims: &jwt.Claims{Username: "jane", Tenant: "1"}, wantCode: http.StatusOK, wantBody: "1:owner"},
+		{name: "matching header & claim", claims: &jwt.Claims{Username: "jane", Tenant: "1"}, header: "1", wantCode: http.StatusOK, wantBody: "1:owner"},
+		{name: "mismatching header & claim", claims: &jwt.Claims{Username: "jane", Tenant: "1"}, header: "2", wantCode: http.StatusForbidden},
+		{name: "not member", claims: &jwt.Claims{Username: "john"}, header: "1", wantCode: http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := request(tc.claims, tc.header)
+			assert.Equal(t, tc.wantCode, rec.Code)
+			if tc.wantBody != "" {
+				assert.Equal(t, tc.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
@@ -3,9 +3,11 @@ package server
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"time"
 
 	"github.com/M15t/ghoul/pkg/server/middleware/secure"
@@ -26,6 +28,9 @@ type Config struct {
 	WriteTimeout int
 	Debug        bool
 	AllowOrigins []string
+	// TrustedProxies are the CIDR ranges of the proxies setting the X-Forwarded-For header, e.g: the load balancer.
+	// The client IP is the peer address when empty, which is the source IP given by API Gateway on Lambda
+	TrustedProxies []string
 }
 
 var (
@@ -73,6 +78,7 @@ func New(cfg *Config) *echo.Echo {
 	e.HTTPErrorHandler = NewErrorHandler(e).Handle
 	e.Binder = NewBinder()
 	e.Debug = cfg.Debug
+	e.IPExtractor = NewIPExtractor(cfg.TrustedProxies)
 	// if e.Debug {
 	// 	e.Logger.SetLevel(log.DEBUG)
 	// 	e.Use(secure.BodyDump())
@@ -88,6 +94,38 @@ func New(cfg *Config) *echo.Echo {
 	return e
 }
 
+// NewIPExtractor returns the extractor of the client IP, which must not be spoofable by the client.
+// The X-Forwarded-For header is only used behind the given trusted proxies, it panics on invalid CIDR ranges.
+func NewIPExtractor(trustedProxies []string) echo.IPExtractor {
+	if len(trustedProxies) == 0 {
+		return remoteIP
+	}
+
+	opts := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, cidr := range trustedProxies {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			panic(fmt.Sprintf("server: invalid trusted proxy range %q: %v", cidr, err))
+		}
+		opts = append(opts, echo.TrustIPRange(ipNet))
+	}
+	xff := echo.ExtractIPFromXFFHeader(opts...)
+	return func(req *http.Request) string {
+		if ip := xff(req); ip != "" {
+			return ip
+		}
+		return remoteIP(req)
+	}
+}
+
+// remoteIP returns the IP of the peer, the Lambda adapter sets it without port
+func remoteIP(req *http.Request) string {
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
+
 // Start starts echo server
 func Start(e *echo.Echo, isDevelopment bool) {
 	// hide verbose logs
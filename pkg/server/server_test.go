@@ -1,9 +1,14 @@
 package server_test
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/M15t/ghoul/pkg/server"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
 )
 
 // Improve tests
@@ -15,3 +20,22 @@ func TestNew(t *testing.T) {
 		t.Errorf("Server should not be nil")
 	}
 }
+
+func TestNewIPExtractor(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderXForwardedFor, "1.1.1.1, 2.2.2.2")
+
+	req.RemoteAddr = "10.0.0.1:1234"
+	assert.Equal(t, "10.0.0.1", server.NewIPExtractor(nil)(req), "the header is ignored without trusted proxies")
+	assert.Equal(t, "2.2.2.2", server.NewIPExtractor([]string{"10.0.0.0/8"})(req))
+	assert.Equal(t, "1.1.1.1", server.NewIPExtractor([]string{"10.0.0.0/8", "2.2.2.2/32"})(req))
+
+	req.RemoteAddr = "3.3.3.3:1234"
+	assert.Equal(t, "3.3.3.3", server.NewIPExtractor([]string{"10.0.0.0/8"})(req), "the header is ignored from untrusted peers")
+
+	// the Lambda adapter sets the source IP without port
+	req.RemoteAddr = "4.4.4.4"
+	assert.Equal(t, "4.4.4.4", server.NewIPExtractor(nil)(req))
+
+	assert.Panics(t, func() { server.NewIPExtractor([]string{"invalid"}) })
+}
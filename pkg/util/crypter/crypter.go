@@ -1,21 +1,92 @@
 package crypter
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
 	"github.com/segmentio/ksuid"
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// New initalizes crypter service
+// Password hashing algorithms
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+// ErrInvalidHash is returned when the hash format is not recognized
+var ErrInvalidHash = errors.New("crypter: invalid hash format")
+
+// Argon2Params holds the argon2id parameters
+type Argon2Params struct {
+	// Time is the number of iterations
+	Time uint32
+	// Memory is the memory usage in KiB
+	Memory uint32
+	// Threads is the degree of parallelism
+	Threads uint8
+	// SaltLength & KeyLength in bytes
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+// Config represents the configuration of password hashing
+type Config struct {
+	// Algorithm of the new hashes: bcrypt (default) or argon2id.
+	// Hashes of both algorithms are verifiable regardless.
+	Algorithm string
+	// BcryptCost defaults to bcrypt.DefaultCost
+	BcryptCost int
+	// Argon2 defaults to DefaultArgon2Params
+	Argon2 Argon2Params
+}
+
+// DefaultArgon2Params are the recommended parameters of RFC 9106 for memory constrained environments
+var DefaultArgon2Params = Argon2Params{Time: 3, Memory: 64 * 1024, Threads: 2, SaltLength: 16, KeyLength: 32}
+
+// DefaultConfig hashes passwords using bcrypt with the default cost
+var DefaultConfig = Config{Algorithm: AlgorithmBcrypt, BcryptCost: bcrypt.DefaultCost, Argon2: DefaultArgon2Params}
+
+// New initalizes crypter service with default config
 func New() *Service {
-	return &Service{}
+	return NewWithConfig(DefaultConfig)
+}
+
+// NewWithConfig initalizes crypter service with given config
+func NewWithConfig(cfg Config) *Service {
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = DefaultConfig.Algorithm
+	}
+	if cfg.Algorithm != AlgorithmBcrypt && cfg.Algorithm != AlgorithmArgon2id {
+		panic("invalid password hashing algorithm")
+	}
+	if cfg.BcryptCost == 0 {
+		cfg.BcryptCost = DefaultConfig.BcryptCost
+	}
+	if cfg.Argon2 == (Argon2Params{}) {
+		cfg.Argon2 = DefaultConfig.Argon2
+	}
+	return &Service{cfg: cfg}
 }
 
 // Service holds crypter methods
-type Service struct{}
+type Service struct {
+	cfg Config
+}
 
-// HashPassword hashes the password using bcrypt
-func (*Service) HashPassword(password string) string {
-	return HashPassword(password)
+// HashPassword hashes the password using the configured algorithm
+func (s *Service) HashPassword(password string) (string, error) {
+	if s.cfg.Algorithm == AlgorithmArgon2id {
+		return hashArgon2id(password, s.cfg.Argon2)
+	}
+	return hashBcrypt(password, s.cfg.BcryptCost)
 }
 
 // CompareHashAndPassword matches hash with password. Returns true if hash and password match.
@@ -23,21 +94,53 @@ func (*Service) CompareHashAndPassword(hash, password string) bool {
 	return CompareHashAndPassword(hash, password)
 }
 
+// NeedsRehash checks whether the hash was created by another algorithm or weaker parameters than the configured ones,
+// so that it should be replaced by a new hash once the password is known (e.g: on login)
+func (s *Service) NeedsRehash(hash string) bool {
+	if strings.HasPrefix(hash, "$"+AlgorithmArgon2id+"$") {
+		if s.cfg.Algorithm != AlgorithmArgon2id {
+			return true
+		}
+		params, _, _, err := decodeArgon2id(hash)
+		return err != nil || params.Time < s.cfg.Argon2.Time || params.Memory < s.cfg.Argon2.Memory ||
+			params.Threads < s.cfg.Argon2.Threads || params.KeyLength < s.cfg.Argon2.KeyLength
+	}
+
+	if s.cfg.Algorithm != AlgorithmBcrypt {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < s.cfg.BcryptCost
+}
+
 // UID returns unique string ID
 func (*Service) UID() string {
 	return UID()
 }
 
+// HashToken hashes the token using sha256
+func (*Service) HashToken(token string) string {
+	return HashToken(token)
+}
+
 ///// Static functions /////
 
-// HashPassword hashes the password using bcrypt
-func HashPassword(password string) string {
-	hashedPW, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(hashedPW)
+// HashPassword hashes the password using bcrypt with the default cost
+func HashPassword(password string) (string, error) {
+	return hashBcrypt(password, bcrypt.DefaultCost)
 }
 
-// CompareHashAndPassword matches hash with password. Returns true if hash and password match.
+// CompareHashAndPassword matches hash with password, the algorithm is detected from the hash.
+// Returns true if hash and password match.
 func CompareHashAndPassword(hash, password string) bool {
+	if strings.HasPrefix(hash, "$"+AlgorithmArgon2id+"$") {
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false
+		}
+		other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, params.KeyLength)
+		return subtle.ConstantTimeCompare(key, other) == 1
+	}
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
 }
 
@@ -45,3 +148,59 @@ func CompareHashAndPassword(hash, password string) bool {
 func UID() string {
 	return ksuid.New().String()
 }
+
+// HashToken hashes the token using sha256, returns hex encoded string.
+// Use it for high entropy random tokens only, never for passwords!
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func hashBcrypt(password string, cost int) (string, error) {
+	hashedPW, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedPW), nil
+}
+
+// hashArgon2id returns the hash in the PHC string format: $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func hashArgon2id(password string, p Argon2Params) (string, error) {
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, p.KeyLength)
+
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", AlgorithmArgon2id, argon2.Version, p.Memory, p.Time, p.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func decodeArgon2id(hash string) (*Argon2Params, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != AlgorithmArgon2id {
+		return nil, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, nil, nil, ErrInvalidHash
+	}
+
+	p := new(Argon2Params)
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+
+	return p, salt, key, nil
+}
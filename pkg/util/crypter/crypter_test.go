@@ -0,0 +1,73 @@
+package crypter_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/M15t/ghoul/pkg/util/crypter"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var lightArgon2 = crypter.Argon2Params{Time: 1, Memory: 1024, Threads: 1, SaltLength: 16, KeyLength: 32}
+
+func TestHashPassword(t *testing.T) {
+	cases := []struct {
+		name       string
+		cfg        crypter.Config
+		wantPrefix string
+	}{
+		{
+			name:       "Bcrypt",
+			cfg:        crypter.Config{Algorithm: crypter.AlgorithmBcrypt, BcryptCost: bcrypt.MinCost},
+			wantPrefix: "$2a$04$",
+		},
+		{
+			name:       "Argon2id",
+			cfg:        crypter.Config{Algorithm: crypter.AlgorithmArgon2id, Argon2: lightArgon2},
+			wantPrefix: "$argon2id$v=19$m=1024,t=1,p=1$",
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			s := crypter.NewWithConfig(tt.cfg)
+			hash, err := s.HashPassword("superadmin123!@#")
+			assert.Nil(t, err)
+			assert.True(t, strings.HasPrefix(hash, tt.wantPrefix), hash)
+			assert.True(t, s.CompareHashAndPassword(hash, "superadmin123!@#"))
+			assert.False(t, s.CompareHashAndPassword(hash, "superadmin123"))
+			assert.False(t, s.NeedsRehash(hash))
+		})
+	}
+
+	t.Run("Invalid algorithm", func(t *testing.T) {
+		assert.Panics(t, func() {
+			crypter.NewWithConfig(crypter.Config{Algorithm: "md5"})
+		})
+	})
+}
+
+func TestNeedsRehash(t *testing.T) {
+	bcryptMin := crypter.NewWithConfig(crypter.Config{Algorithm: crypter.AlgorithmBcrypt, BcryptCost: bcrypt.MinCost})
+	bcryptMore := crypter.NewWithConfig(crypter.Config{Algorithm: crypter.AlgorithmBcrypt, BcryptCost: bcrypt.MinCost + 1})
+	argonLight := crypter.NewWithConfig(crypter.Config{Algorithm: crypter.AlgorithmArgon2id, Argon2: lightArgon2})
+	heavier := lightArgon2
+	heavier.Time = 2
+	argonHeavy := crypter.NewWithConfig(crypter.Config{Algorithm: crypter.AlgorithmArgon2id, Argon2: heavier})
+
+	bcryptHash, _ := bcryptMin.HashPassword("password")
+	argonHash, _ := argonLight.HashPassword("password")
+
+	assert.True(t, bcryptMore.NeedsRehash(bcryptHash), "bcrypt cost increased")
+	assert.True(t, argonLight.NeedsRehash(bcryptHash), "bcrypt to argon2id")
+	assert.True(t, bcryptMin.NeedsRehash(argonHash), "argon2id to bcrypt")
+	assert.True(t, argonHeavy.NeedsRehash(argonHash), "argon2id params increased")
+	assert.False(t, argonLight.NeedsRehash(argonHash))
+
+	// hashes of any algorithm are verifiable
+	assert.True(t, crypter.CompareHashAndPassword(bcryptHash, "password"))
+	assert.True(t, crypter.CompareHashAndPassword(argonHash, "password"))
+	assert.False(t, crypter.CompareHashAndPassword("$argon2id$invalid", "password"))
+}
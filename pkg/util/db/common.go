@@ -3,6 +3,7 @@ package dbutil
 import (
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/imdatngo/gowhere"
 	"gorm.io/gorm"
@@ -34,14 +35,26 @@ type Intf interface {
 	// `output` must be a non-nil pointer of slice of the model. e.g: `data := []*model.User{}; db.List(dbconn, &data, nil, nil)`
 	// `lq` can be nil, then no filter & pagination are applied
 	// `count` can also be nil, then no extra query is executed to get the total count
+	// Note: the keyset pagination is used when `lq.Cursor` is set, see ListQueryCondition
 	List(db *gorm.DB, output interface{}, lq *ListQueryCondition, count *int64) error
 	// Update updates data of the records matching the given conditions.
 	// `updates` could be a model struct or map[string]interface{}
 	// Note: DB.Model must be provided in order to get the correct model/table
+	// Note: ErrVersionConflict is returned when the version in `updates` is not the current one of the versioned models
 	Update(db *gorm.DB, updates interface{}, cond ...interface{}) error
+	// UpdateRows updates the records like Update, returns the number of updated records.
+	// Note: use it instead of reading GDB.RowsAffected, GDB is shared between the concurrent requests
+	UpdateRows(db *gorm.DB, updates interface{}, cond ...interface{}) (int64, error)
 	// Delete deletes record matching given conditions.
 	// `cond` can be an instance of the model, then primary key will be used as the condition
+	// Note: the models having a gorm.DeletedAt field are soft deleted, see WithDeleted
 	Delete(db *gorm.DB, cond ...interface{}) error
+	// DeleteRows deletes the records like Delete, returns the number of deleted records.
+	DeleteRows(db *gorm.DB, cond ...interface{}) (int64, error)
+	// Restore restores the soft deleted records matching the given conditions.
+	Restore(db *gorm.DB, cond ...interface{}) error
+	// PurgeDeleted permanently deletes the records soft deleted before the given time, returns the number of deleted records
+	PurgeDeleted(db *gorm.DB, before time.Time) (int64, error)
 	// Exist checks whether there is record matching the given conditions.
 	Exist(db *gorm.DB, cond ...interface{}) (bool, error)
 	// CreateInBatches creates batch of new record on database.
@@ -51,12 +64,23 @@ type Intf interface {
 	ParseCond(cond ...interface{}) []interface{}
 }
 
+// DefaultPerPage is the page size of the keyset pagination when PerPage is not set
+const DefaultPerPage = 25
+
 // ListQueryCondition holds data used for db queries
 type ListQueryCondition struct {
 	Filter  *gowhere.Plan
 	Sort    []string
 	Page    int
 	PerPage int
+	// IncludeDeleted includes the soft deleted records, see WithDeleted
+	IncludeDeleted bool
+	// Cursor switches to the keyset pagination when not nil, Page is ignored and the total count is not queried then.
+	// Use &Cursor{} for the first page.
+	Cursor *Cursor
+	// NextCursor & PrevCursor are set by List in keyset pagination, empty when there is no page in that direction
+	NextCursor string
+	PrevCursor string
 }
 
 // Create creates a new record on database.
@@ -75,10 +99,17 @@ func (cdb *DB) View(db *gorm.DB, output interface{}, cond ...interface{}) error
 // List returns list of records retrievable after filter & pagination if given.
 func (cdb *DB) List(db *gorm.DB, output interface{}, lq *ListQueryCondition, count *int64) error {
 	if lq != nil {
+		if lq.IncludeDeleted {
+			db = db.Unscoped()
+		}
 		if lq.Filter != nil {
 			db = db.Where(lq.Filter.SQL(), lq.Filter.Vars()...)
 		}
 
+		if lq.Cursor != nil {
+			return cdb.listKeyset(db, output, lq)
+		}
+
 		if lq.PerPage > 0 {
 			db = db.Limit(lq.PerPage)
 			if lq.Page > 1 {
@@ -86,8 +117,11 @@ func (cdb *DB) List(db *gorm.DB, output interface{}, lq *ListQueryCondition, cou
 			}
 		}
 
-		if lq.Sort != nil && len(lq.Sort) > 0 {
-			// Note: It's up to who using this package to validate the sort fields!
+		if len(lq.Sort) > 0 {
+			// Note: the sort fields should be validated against the allowed ones, see NewListFields
+			if err := checkSort(lq.Sort); err != nil {
+				return err
+			}
 			db = db.Order(strings.Join(lq.Sort, ", "))
 		}
 	}
@@ -108,18 +142,83 @@ func (cdb *DB) List(db *gorm.DB, output interface{}, lq *ListQueryCondition, cou
 }
 
 // Update updates data of the records matching the given conditions.
+// The version of the versioned models is incremented, and checked when given in the updates, see VersionColumn.
 func (cdb *DB) Update(db *gorm.DB, updates interface{}, cond ...interface{}) error {
-	db = db.Model(cdb.Model)
-	if len(cond) > 0 {
-		where := parseCond(cond...)
-		db = db.Where(where[0], where[1:]...)
+	res, err := cdb.update(db, updates, cond...)
+	if res != nil {
+		cdb.GDB = res
 	}
-	cdb.GDB = db.Omit("id").Updates(updates)
-	return cdb.GDB.Error
+	return err
+}
+
+// UpdateRows updates the records like Update, returns the number of updated records
+func (cdb *DB) UpdateRows(db *gorm.DB, updates interface{}, cond ...interface{}) (int64, error) {
+	res, err := cdb.update(db, updates, cond...)
+	if res == nil {
+		return 0, err
+	}
+	return res.RowsAffected, err
+}
+
+// update updates the records like Update, returning the result of the query itself instead of sharing it through GDB
+func (cdb *DB) update(db *gorm.DB, updates interface{}, cond ...interface{}) (*gorm.DB, error) {
+	scoped := func() *gorm.DB {
+		tx := db.Model(cdb.Model)
+		if len(cond) > 0 {
+			where := parseCond(cond...)
+			tx = tx.Where(where[0], where[1:]...)
+		}
+		return tx
+	}
+
+	field, err := cdb.versionField(db)
+	if err != nil {
+		return nil, err
+	}
+	if field == nil {
+		res := scoped().Omit("id").Updates(updates)
+		return res, res.Error
+	}
+
+	updates, expected, err := versionedUpdates(db, updates, field)
+	if err != nil {
+		return nil, err
+	}
+	tx := scoped()
+	if expected != nil {
+		tx = tx.Where(field.DBName+" = ?", expected)
+	}
+	res := tx.Omit("id").Updates(updates)
+	if res.Error != nil || expected == nil || res.RowsAffected > 0 {
+		return res, res.Error
+	}
+
+	// nothing updated, either not found or modified concurrently
+	var count int64
+	if err := scoped().Count(&count).Error; err != nil {
+		return res, err
+	}
+	if count > 0 {
+		return res, ErrVersionConflict
+	}
+	return res, nil
 }
 
 // Delete deletes record matching given conditions.
 func (cdb *DB) Delete(db *gorm.DB, cond ...interface{}) error {
+	res := cdb.delete(db, cond...)
+	cdb.GDB = res
+	return res.Error
+}
+
+// DeleteRows deletes the records like Delete, returns the number of deleted records
+func (cdb *DB) DeleteRows(db *gorm.DB, cond ...interface{}) (int64, error) {
+	res := cdb.delete(db, cond...)
+	return res.RowsAffected, res.Error
+}
+
+// delete deletes the records like Delete, returning the result of the query itself instead of sharing it through GDB
+func (cdb *DB) delete(db *gorm.DB, cond ...interface{}) *gorm.DB {
 	if len(cond) == 1 {
 		newCond := cond[0]
 		cType := reflect.TypeOf(newCond)
@@ -127,13 +226,12 @@ func (cdb *DB) Delete(db *gorm.DB, cond ...interface{}) error {
 		switch cType.Kind() {
 		case reflect.Ptr:
 			where := parseCond(cond...)
-			return db.Delete(newCond, where...).Error
+			return db.Delete(newCond, where...)
 		}
 	}
 
 	where := parseCond(cond...)
-	cdb.GDB = db.Delete(cdb.Model, where...)
-	return cdb.GDB.Error
+	return db.Delete(cdb.modelPtr(), where...)
 }
 
 // Exist checks whether there is record matching the given conditions.
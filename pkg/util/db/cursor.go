@@ -0,0 +1,253 @@
+package dbutil
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ErrInvalidCursor is returned when the cursor is malformed, tampered or does not match the current sorting
+var ErrInvalidCursor = errors.New("dbutil: invalid cursor")
+
+// cursorSecret signs the cursors, it is random per process until SetCursorSecret is called, which only suits a single instance
+var cursorSecret = func() []byte {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}()
+
+// SetCursorSecret sets the key used to sign the cursors.
+// It must be shared by all the instances serving the same API, otherwise the cursors issued by one are rejected by the others.
+func SetCursorSecret(secret string) {
+	if secret != "" {
+		cursorSecret = []byte(secret)
+	}
+}
+
+// Cursor holds the position of the keyset pagination.
+// The zero value starts from the first page.
+type Cursor struct {
+	// Sort is the sorting the cursor was issued for, e.g: "name DESC, id ASC"
+	Sort string `json:"s,omitempty"`
+	// Keys are the values of the sort fields of the boundary record, the primary key is the last one. Empty for the first page
+	Keys []json.RawMessage `json:"k,omitempty"`
+	// Backward fetches the records before the boundary record
+	Backward bool `json:"b,omitempty"`
+}
+
+// Encode returns the opaque, signed string of the cursor
+func (cur *Cursor) Encode() string {
+	payload, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(signCursor(payload))
+}
+
+// DecodeCursor parses the string returned by Cursor.Encode
+func DecodeCursor(s string) (*Cursor, error) {
+	p, sig, ok := strings.Cut(s, ".")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(p)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, signCursor(payload)) {
+		return nil, ErrInvalidCursor
+	}
+
+	cur := &Cursor{}
+	if err := json.Unmarshal(payload, cur); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return cur, nil
+}
+
+func signCursor(payload []byte) []byte {
+	h := hmac.New(sha256.New, cursorSecret)
+	h.Write(payload)
+	return h.Sum(nil)
+}
+
+// keyset holds the fields the keyset pagination is sorted by, the primary key is always the last one as the tie breaker
+type keyset struct {
+	sort   string
+	fields []*schema.Field
+	desc   []bool
+}
+
+// newKeyset resolves the sorting against the model of output.
+// Note: the sort fields must not be nullable, the records having null values are skipped otherwise.
+func newKeyset(db *gorm.DB, output interface{}, sort []string) (*keyset, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(output); err != nil {
+		return nil, err
+	}
+	pk := stmt.Schema.PrioritizedPrimaryField
+	if pk == nil {
+		return nil, fmt.Errorf("dbutil: keyset pagination requires a primary key on %s", stmt.Schema.Name)
+	}
+
+	ks := &keyset{}
+	orders := []string{}
+	desc := false
+	for _, s := range sort {
+		name, dir, _ := strings.Cut(strings.TrimSpace(s), " ")
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			name = name[i+1:]
+		}
+		field := stmt.Schema.LookUpField(name)
+		if field == nil || field.DBName == "" {
+			return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidSort, name)
+		}
+		desc = strings.EqualFold(strings.TrimSpace(dir), "DESC")
+		ks.fields = append(ks.fields, field)
+		ks.desc = append(ks.desc, desc)
+		if desc {
+			orders = append(orders, field.DBName+" DESC")
+		} else {
+			orders = append(orders, field.DBName+" ASC")
+		}
+		if field == pk {
+			// the following fields would never be compared
+			break
+		}
+	}
+	if len(ks.fields) == 0 || ks.fields[len(ks.fields)-1] != pk {
+		// the primary key follows the direction of the last sort field
+		ks.fields = append(ks.fields, pk)
+		ks.desc = append(ks.desc, desc)
+	}
+
+	ks.sort = strings.Join(orders, ", ")
+	return ks, nil
+}
+
+// apply adds the ordering and the position of cur to the query
+func (ks *keyset) apply(db *gorm.DB, cur *Cursor) (*gorm.DB, error) {
+	if len(cur.Keys) > 0 {
+		if len(cur.Keys) != len(ks.fields) {
+			return nil, ErrInvalidCursor
+		}
+		keys := make([]interface{}, len(ks.fields))
+		for i, field := range ks.fields {
+			v, err := decodeCursorValue(cur.Keys[i], field)
+			if err != nil {
+				return nil, err
+			}
+			keys[i] = v
+		}
+
+		// e.g: (a > ?) OR (a = ? AND b < ?) OR (a = ? AND b = ? AND id < ?)
+		ors := make([]string, len(ks.fields))
+		vars := []interface{}{}
+		for i, field := range ks.fields {
+			ands := []string{}
+			for j := 0; j < i; j++ {
+				ands = append(ands, ks.fields[j].DBName+" = ?")
+				vars = append(vars, keys[j])
+			}
+			op := ">"
+			if ks.desc[i] != cur.Backward {
+				op = "<"
+			}
+			ands = append(ands, field.DBName+" "+op+" ?")
+			vars = append(vars, keys[i])
+			ors[i] = "(" + strings.Join(ands, " AND ") + ")"
+		}
+		db = db.Where(strings.Join(ors, " OR "), vars...)
+	}
+
+	for i, field := range ks.fields {
+		dir := " ASC"
+		if ks.desc[i] != cur.Backward {
+			dir = " DESC"
+		}
+		db = db.Order(field.DBName + dir)
+	}
+	return db, nil
+}
+
+// cursor returns the cursor pointing at the given record
+func (ks *keyset) cursor(rv reflect.Value, backward bool) *Cursor {
+	cur := &Cursor{Sort: ks.sort, Backward: backward}
+	for _, field := range ks.fields {
+		v, _ := field.ValueOf(context.Background(), rv)
+		raw, _ := json.Marshal(v)
+		cur.Keys = append(cur.Keys, raw)
+	}
+	return cur
+}
+
+// decodeCursorValue decodes the raw value into the type of the field, so that the driver binds it properly, e.g: time.Time
+func decodeCursorValue(raw json.RawMessage, field *schema.Field) (interface{}, error) {
+	v := reflect.New(field.FieldType)
+	if err := json.Unmarshal(raw, v.Interface()); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return v.Elem().Interface(), nil
+}
+
+// listKeyset lists the records after/before lq.Cursor, then sets lq.NextCursor & lq.PrevCursor
+func (cdb *DB) listKeyset(db *gorm.DB, output interface{}, lq *ListQueryCondition) error {
+	ks, err := newKeyset(db, output, lq.Sort)
+	if err != nil {
+		return err
+	}
+	cur := lq.Cursor
+	if len(cur.Keys) > 0 && cur.Sort != ks.sort {
+		return ErrInvalidCursor
+	}
+
+	perPage := lq.PerPage
+	if perPage <= 0 {
+		perPage = DefaultPerPage
+	}
+
+	db, err = ks.apply(db, cur)
+	if err != nil {
+		return err
+	}
+	// fetch one more record to know whether there is a next page
+	cdb.GDB = db.Limit(perPage + 1).Find(output)
+	if err := cdb.GDB.Error; err != nil {
+		return err
+	}
+
+	rows := reflect.Indirect(reflect.ValueOf(output))
+	hasMore := rows.Len() > perPage
+	if hasMore {
+		rows.Set(rows.Slice(0, perPage))
+	}
+	if cur.Backward {
+		swap := reflect.Swapper(rows.Interface())
+		for i, j := 0, rows.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+
+	lq.NextCursor, lq.PrevCursor = "", ""
+	if rows.Len() == 0 {
+		return nil
+	}
+	// the records before a forward cursor and after a backward cursor always exist
+	if hasMore || (cur.Backward && len(cur.Keys) > 0) {
+		lq.NextCursor = ks.cursor(rows.Index(rows.Len()-1), false).Encode()
+	}
+	if (hasMore && cur.Backward) || (!cur.Backward && len(cur.Keys) > 0) {
+		lq.PrevCursor = ks.cursor(rows.Index(0), true).Encode()
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package dbutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/imdatngo/gowhere"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type cursorRecord struct {
+	ID        int
+	Name      string
+	Score     int
+	CreatedAt time.Time
+}
+
+func names(data []*cursorRecord) []string {
+	res := []string{}
+	for _, r := range data {
+		res = append(res, r.Name)
+	}
+	return res
+}
+
+func TestCursor(t *testing.T) {
+	cur := &Cursor{Sort: "name ASC", Keys: []json.RawMessage{[]byte(`"b"`), []byte(`2`)}, Backward: true}
+	decoded, err := DecodeCursor(cur.Encode())
+	assert.Nil(t, err)
+	assert.Equal(t, cur, decoded)
+
+	for _, s := range []string{"", "abc", "abc.def", cur.Encode() + "x", "x" + cur.Encode()} {
+		_, err := DecodeCursor(s)
+		assert.ErrorIs(t, err, ErrInvalidCursor, s)
+	}
+
+	// signed by another secret
+	SetCursorSecret("secret")
+	encoded := cur.Encode()
+	SetCursorSecret("another")
+	_, err = DecodeCursor(encoded)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestListKeyset(t *testing.T) {
+	db, err := New("sqlite3", filepath.Join(t.TempDir(), "cursor.db"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Error establishing connection %v", err)
+	}
+	if err := db.AutoMigrate(&cursorRecord{}); err != nil {
+		t.Fatalf("Error migrating %v", err)
+	}
+
+	cdb := NewDB(cursorRecord{})
+	now := time.Now().UTC().Truncate(time.Second)
+	input := []*cursorRecord{}
+	for i, score := range []int{3, 1, 2, 2, 3, 1, 2} {
+		input = append(input, &cursorRecord{Name: fmt.Sprintf("r%d", i+1), Score: score, CreatedAt: now.Add(time.Duration(-i) * time.Hour)})
+	}
+	assert.Nil(t, cdb.CreateInBatches(db, input, 10))
+
+	// walks the pages forward then backward
+	walk := func(sort []string, expected [][]string) {
+		pages := [][]string{}
+		lq := &ListQueryCondition{Sort: sort, PerPage: 3, Cursor: &Cursor{}}
+		for {
+			var data []*cursorRecord
+			var count int64
+			assert.Nil(t, cdb.List(db, &data, lq, &count))
+			assert.Equal(t, int64(0), count, "not counted")
+			pages = append(pages, names(data))
+			if lq.NextCursor == "" {
+				break
+			}
+			lq.Cursor, err = DecodeCursor(lq.NextCursor)
+			assert.Nil(t, err)
+		}
+		assert.Equal(t, expected, pages, sort)
+
+		pages = [][]string{}
+		for lq.PrevCursor != "" {
+			lq.Cursor, err = DecodeCursor(lq.PrevCursor)
+			assert.Nil(t, err)
+			var data []*cursorRecord
+			assert.Nil(t, cdb.List(db, &data, lq, nil))
+			pages = append([][]string{names(data)}, pages...)
+		}
+		assert.Equal(t, expected[:len(expected)-1], pages, sort)
+	}
+
+	walk(nil, [][]string{{"r1", "r2", "r3"}, {"r4", "r5", "r6"}, {"r7"}})
+	walk([]string{"id DESC"}, [][]string{{"r7", "r6", "r5"}, {"r4", "r3", "r2"}, {"r1"}})
+	walk([]string{"score ASC"}, [][]string{{"r2", "r6", "r3"}, {"r4", "r7", "r1"}, {"r5"}})
+	walk([]string{"score DESC"}, [][]string{{"r5", "r1", "r7"}, {"r4", "r3", "r6"}, {"r2"}})
+	walk([]string{"created_at ASC"}, [][]string{{"r7", "r6", "r5"}, {"r4", "r3", "r2"}, {"r1"}})
+	walk([]string{"score DESC", "created_at ASC"}, [][]string{{"r5", "r1", "r7"}, {"r4", "r3", "r6"}, {"r2"}})
+	walk([]string{"score ASC", "name DESC"}, [][]string{{"r6", "r2", "r7"}, {"r4", "r3", "r5"}, {"r1"}})
+	walk([]string{"id DESC", "name ASC"}, [][]string{{"r7", "r6", "r5"}, {"r4", "r3", "r2"}, {"r1"}})
+
+	// filtered
+	var data []*cursorRecord
+	lq := &ListQueryCondition{Filter: gowhere.Where(map[string]interface{}{"score": 2}), PerPage: 2, Cursor: &Cursor{}}
+	assert.Nil(t, cdb.List(db, &data, lq, nil))
+	assert.Equal(t, []string{"r3", "r4"}, names(data))
+	assert.Equal(t, "", lq.PrevCursor)
+	lq.Cursor, _ = DecodeCursor(lq.NextCursor)
+	assert.Nil(t, cdb.List(db, &data, lq, nil))
+	assert.Equal(t, []string{"r7"}, names(data))
+	assert.Equal(t, "", lq.NextCursor)
+	assert.NotEqual(t, "", lq.PrevCursor)
+
+	// the cursor is bound to the sorting
+	lq = &ListQueryCondition{Sort: []string{"score ASC"}, PerPage: 3, Cursor: &Cursor{}}
+	assert.Nil(t, cdb.List(db, &data, lq, nil))
+	lq.Cursor, _ = DecodeCursor(lq.NextCursor)
+	lq.Sort = []string{"name ASC"}
+	assert.ErrorIs(t, cdb.List(db, &data, lq, nil), ErrInvalidCursor)
+
+	// unknown sort fields
+	lq = &ListQueryCondition{Sort: []string{"unknown ASC"}, Cursor: &Cursor{}}
+	assert.ErrorIs(t, cdb.List(db, &data, lq, nil), ErrInvalidSort)
+
+	// the offset pagination is kept
+	var count int64
+	assert.Nil(t, cdb.List(db, &data, &ListQueryCondition{Sort: []string{"id ASC"}, Page: 3, PerPage: 3}, &count))
+	assert.Equal(t, []string{"r7"}, names(data))
+	assert.Equal(t, int64(7), count)
+}
@@ -0,0 +1,77 @@
+package dbutil
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm/schema"
+)
+
+// ErrInvalidSort is returned by List when a sort entry is not a plain column, to prevent SQL injection
+var ErrInvalidSort = errors.New("dbutil: invalid sort")
+
+// ListTag is the struct tag declaring the fields a model may be listed by, e.g: `list:"sort,filter"`
+const ListTag = "list"
+
+// ListFields holds the fields allowed to sort and filter the list of a model.
+// Both map the names accepted in the requests, i.e: the json names, to the columns.
+type ListFields struct {
+	Sort   map[string]string
+	Filter map[string]string
+}
+
+var listFieldsCache sync.Map
+
+// NewListFields returns the list fields declared by the `list` tags of the model, including the embedded structs.
+// e.g: Name string `json:"name" list:"sort,filter"`
+func NewListFields(model interface{}) *ListFields {
+	typ := reflect.Indirect(reflect.ValueOf(model)).Type()
+	if lf, ok := listFieldsCache.Load(typ); ok {
+		return lf.(*ListFields)
+	}
+
+	sch, err := schema.Parse(model, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		panic(fmt.Sprintf("dbutil: cannot parse the list fields of %s: %v", typ, err))
+	}
+
+	lf := &ListFields{Sort: map[string]string{}, Filter: map[string]string{}}
+	for _, field := range sch.Fields {
+		tag, ok := field.Tag.Lookup(ListTag)
+		if !ok || field.DBName == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			name = field.DBName
+		}
+		for _, opt := range strings.Split(tag, ",") {
+			switch strings.TrimSpace(opt) {
+			case "sort":
+				lf.Sort[name] = field.DBName
+			case "filter":
+				lf.Filter[name] = field.DBName
+			}
+		}
+	}
+
+	listFieldsCache.Store(typ, lf)
+	return lf
+}
+
+// sortPattern matches the sorting built from the allowed fields, e.g: "name ASC"
+var sortPattern = regexp.MustCompile(`^\w+(\.\w+)?( (?i:ASC|DESC))?$`)
+
+// checkSort returns ErrInvalidSort unless all sort entries are plain columns with optional direction
+func checkSort(sort []string) error {
+	for _, s := range sort {
+		if !sortPattern.MatchString(strings.TrimSpace(s)) {
+			return fmt.Errorf("%w: %q", ErrInvalidSort, s)
+		}
+	}
+	return nil
+}
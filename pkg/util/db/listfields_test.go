@@ -0,0 +1,39 @@
+package dbutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ListBase struct {
+	ID        int       `json:"id" list:"sort,filter"`
+	CreatedAt time.Time `json:"created_at" list:"sort"`
+}
+
+type listRecord struct {
+	ListBase
+	Name     string `json:"name" list:"sort,filter"`
+	Email    string `json:"email_address" list:"filter"`
+	Password string `json:"-"`
+	Hidden   string `json:"-" list:"filter"`
+}
+
+func TestNewListFields(t *testing.T) {
+	lf := NewListFields(listRecord{})
+	assert.Equal(t, map[string]string{"id": "id", "created_at": "created_at", "name": "name"}, lf.Sort)
+	assert.Equal(t, map[string]string{"id": "id", "name": "name", "email_address": "email", "hidden": "hidden"}, lf.Filter)
+
+	// cached per model
+	assert.Same(t, lf, NewListFields(&listRecord{}))
+}
+
+func TestCheckSort(t *testing.T) {
+	assert.Nil(t, checkSort(nil))
+	assert.Nil(t, checkSort([]string{"name", "id DESC", "users.created_at asc"}))
+
+	for _, s := range []string{"", "name DESC, id", "name; DROP TABLE users", "(SELECT 1)", "name DESC NULLS FIRST"} {
+		assert.ErrorIs(t, checkSort([]string{s}), ErrInvalidSort, s)
+	}
+}
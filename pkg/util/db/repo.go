@@ -0,0 +1,181 @@
+package dbutil
+
+import (
+	"iter"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// RepoIntf represents the typed repository interface of the model T, implemented by Repo
+type RepoIntf[T any] interface {
+	// Create creates a new record on database
+	Create(db *gorm.DB, rec *T) error
+	// Get returns single record matching the given conditions.
+	// Note: RecordNotFound error is returned when there is no record that matches the conditions
+	Get(db *gorm.DB, cond ...interface{}) (*T, error)
+	// List returns list of records retrievable after filter & pagination if given, see Intf.List
+	List(db *gorm.DB, lq *ListQueryCondition, count *int64) ([]*T, error)
+	// Update updates data of the records matching the given conditions, see Intf.Update
+	Update(db *gorm.DB, updates interface{}, cond ...interface{}) error
+	// Delete deletes the records matching given conditions, see Intf.Delete
+	Delete(db *gorm.DB, cond ...interface{}) error
+	// Restore restores the soft deleted records matching the given conditions
+	Restore(db *gorm.DB, cond ...interface{}) error
+	// PurgeDeleted permanently deletes the records soft deleted before the given time, returns the number of deleted records
+	PurgeDeleted(db *gorm.DB, before time.Time) (int64, error)
+	// Exists checks whether there is record matching the given conditions
+	Exists(db *gorm.DB, cond ...interface{}) (bool, error)
+	// Upsert creates the record, or updates the existing one conflicting on the given columns, see Repo.Upsert
+	Upsert(db *gorm.DB, rec *T, conflictColumns []string, updateColumns ...string) error
+	// All streams the records matching the given conditions, see Repo.All
+	All(db *gorm.DB, cond ...interface{}) iter.Seq2[*T, error]
+}
+
+// NewRepo creates new typed repository of the model T. e.g: dbutil.NewRepo[model.User]()
+func NewRepo[T any]() *Repo[T] {
+	var model T
+	return &Repo[T]{DB: NewDB(model)}
+}
+
+// Repo represents the typed repository of the model T
+type Repo[T any] struct {
+	// DB is the untyped instance the repository is built on, for the usages not covered yet
+	DB *DB
+}
+
+// Create creates a new record on database
+func (r *Repo[T]) Create(db *gorm.DB, rec *T) error {
+	return r.DB.Create(db, rec)
+}
+
+// Get returns single record matching the given conditions.
+// Note: RecordNotFound error is returned when there is no record that matches the conditions
+func (r *Repo[T]) Get(db *gorm.DB, cond ...interface{}) (*T, error) {
+	rec := new(T)
+	if err := r.DB.View(db, rec, cond...); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// List returns list of records retrievable after filter & pagination if given, see DB.List
+func (r *Repo[T]) List(db *gorm.DB, lq *ListQueryCondition, count *int64) ([]*T, error) {
+	data := []*T{}
+	if err := r.DB.List(db, &data, lq, count); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Update updates data of the records matching the given conditions, see DB.Update.
+// `updates` could be a map[string]interface{} or T
+func (r *Repo[T]) Update(db *gorm.DB, updates interface{}, cond ...interface{}) error {
+	return r.DB.Update(db, updates, cond...)
+}
+
+// Delete deletes the records matching given conditions, see DB.Delete
+func (r *Repo[T]) Delete(db *gorm.DB, cond ...interface{}) error {
+	return r.DB.Delete(db, cond...)
+}
+
+// Restore restores the soft deleted records matching the given conditions, see DB.Restore
+func (r *Repo[T]) Restore(db *gorm.DB, cond ...interface{}) error {
+	return r.DB.Restore(db, cond...)
+}
+
+// PurgeDeleted permanently deletes the records soft deleted before the given time, returns the number of deleted records
+func (r *Repo[T]) PurgeDeleted(db *gorm.DB, before time.Time) (int64, error) {
+	return r.DB.PurgeDeleted(db, before)
+}
+
+// Exists checks whether there is record matching the given conditions
+func (r *Repo[T]) Exists(db *gorm.DB, cond ...interface{}) (bool, error) {
+	return r.DB.Exist(db, cond...)
+}
+
+// Upsert creates the record, or updates the existing one conflicting on the given columns, e.g: a unique index.
+// All the columns but the primary key & creation time are updated unless `updateColumns` are given.
+// The version of the versioned models is incremented on update, see VersionColumn.
+func (r *Repo[T]) Upsert(db *gorm.DB, rec *T, conflictColumns []string, updateColumns ...string) error {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(rec); err != nil {
+		return err
+	}
+
+	onConflict := clause.OnConflict{}
+	for _, col := range conflictColumns {
+		onConflict.Columns = append(onConflict.Columns, clause.Column{Name: col})
+	}
+	if len(updateColumns) == 0 {
+		updateColumns = upsertColumns(stmt.Schema, conflictColumns)
+	}
+	onConflict.DoUpdates = clause.AssignmentColumns(updateColumns)
+	if field := stmt.Schema.LookUpField(VersionColumn); field != nil {
+		onConflict.DoUpdates = append(onConflict.DoUpdates, clause.Assignment{
+			Column: clause.Column{Name: field.DBName},
+			Value:  clause.Expr{SQL: "? + 1", Vars: []interface{}{clause.Column{Table: clause.CurrentTable, Name: field.DBName}}},
+		})
+	}
+
+	r.DB.GDB = db.Clauses(onConflict).Create(rec)
+	return r.DB.GDB.Error
+}
+
+// upsertColumns returns the columns updated by Upsert by default
+func upsertColumns(sch *schema.Schema, conflictColumns []string) []string {
+	skip := map[string]bool{VersionColumn: true}
+	for _, col := range conflictColumns {
+		skip[col] = true
+	}
+
+	cols := []string{}
+	for _, field := range sch.Fields {
+		if field.DBName == "" || field.PrimaryKey || field.AutoCreateTime > 0 || !field.Updatable || skip[field.DBName] {
+			continue
+		}
+		cols = append(cols, field.DBName)
+	}
+	return cols
+}
+
+// All streams the records matching the given conditions, without loading them all in memory.
+// The iteration stops at the first error, e.g:
+//
+//	for rec, err := range repo.All(db) {
+//		if err != nil {
+//			return err
+//		}
+//	}
+func (r *Repo[T]) All(db *gorm.DB, cond ...interface{}) iter.Seq2[*T, error] {
+	return func(yield func(*T, error) bool) {
+		tx := db.Model(new(T))
+		if len(cond) > 0 {
+			where := parseCond(cond...)
+			tx = tx.Where(where[0], where[1:]...)
+		}
+
+		rows, err := tx.Rows()
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			rec := new(T)
+			if err := tx.ScanRows(rows, rec); err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(rec, nil) {
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
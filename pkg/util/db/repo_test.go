@@ -0,0 +1,92 @@
+package dbutil
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type repoRecord struct {
+	ID        int
+	CreatedAt time.Time
+	Code      string `gorm:"uniqueIndex"`
+	Name      string
+	Version   int `gorm:"not null;default:1"`
+	DeletedAt gorm.DeletedAt
+}
+
+// the repository implements the interface
+var _ RepoIntf[repoRecord] = (*Repo[repoRecord])(nil)
+
+func TestRepo(t *testing.T) {
+	db, err := New("sqlite3", filepath.Join(t.TempDir(), "repo.db"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Error establishing connection %v", err)
+	}
+	if err := db.AutoMigrate(&repoRecord{}); err != nil {
+		t.Fatalf("Error migrating %v", err)
+	}
+
+	repo := NewRepo[repoRecord]()
+	for _, code := range []string{"a", "b", "c"} {
+		assert.Nil(t, repo.Create(db, &repoRecord{Code: code, Name: "name " + code}))
+	}
+
+	rec, err := repo.Get(db, map[string]interface{}{"code": "b"})
+	assert.Nil(t, err)
+	assert.Equal(t, "name b", rec.Name)
+	_, err = repo.Get(db, map[string]interface{}{"code": "x"})
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	var count int64
+	data, err := repo.List(db, &ListQueryCondition{Sort: []string{"code DESC"}, PerPage: 2}, &count)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), count)
+	assert.Equal(t, "c", data[0].Code)
+	assert.Len(t, data, 2)
+
+	assert.Nil(t, repo.Update(db, map[string]interface{}{"name": "B"}, rec.ID))
+	rec, _ = repo.Get(db, rec.ID)
+	assert.Equal(t, "B", rec.Name)
+	assert.Equal(t, 2, rec.Version)
+
+	assert.Nil(t, repo.Delete(db, map[string]interface{}{"code": "c"}))
+	existed, err := repo.Exists(db, map[string]interface{}{"code": "c"})
+	assert.Nil(t, err)
+	assert.False(t, existed)
+
+	// upserted by the unique code
+	assert.Nil(t, repo.Upsert(db, &repoRecord{Code: "b", Name: "upserted"}, []string{"code"}))
+	assert.Nil(t, repo.Upsert(db, &repoRecord{Code: "d", Name: "inserted"}, []string{"code"}))
+	rec, _ = repo.Get(db, map[string]interface{}{"code": "b"})
+	assert.Equal(t, "upserted", rec.Name)
+	assert.Equal(t, 3, rec.Version)
+	assert.Nil(t, repo.Upsert(db, &repoRecord{Code: "b", Name: "ignored"}, []string{"code"}, "deleted_at"))
+	rec, _ = repo.Get(db, map[string]interface{}{"code": "b"})
+	assert.Equal(t, "upserted", rec.Name)
+	assert.Equal(t, 4, rec.Version)
+
+	// streamed, excluding the deleted records
+	codes := []string{}
+	for rec, err := range repo.All(db.Order("code")) {
+		assert.Nil(t, err)
+		codes = append(codes, rec.Code)
+	}
+	assert.Equal(t, []string{"a", "b", "d"}, codes)
+
+	codes = []string{}
+	for rec, err := range repo.All(db, map[string]interface{}{"code__in": []string{"a", "d"}}) {
+		assert.Nil(t, err)
+		codes = append(codes, rec.Code)
+		break
+	}
+	assert.Len(t, codes, 1)
+
+	assert.Nil(t, repo.Restore(db, map[string]interface{}{"code": "c"}))
+	rec, err = repo.Get(db, map[string]interface{}{"code": "c"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, rec.Version, "restoring increments the version")
+}
@@ -0,0 +1,82 @@
+package dbutil
+
+import (
+	"errors"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrSoftDeleteNotSupported is returned when restoring or purging the deleted records of a model without gorm.DeletedAt field
+var ErrSoftDeleteNotSupported = errors.New("dbutil: the model is not soft deleted")
+
+var deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+
+// WithDeleted returns the DB including the soft deleted records in the queries of the soft deleted models.
+// Note: the records are deleted permanently by DB.Delete with it.
+// It is a reusable session, like WithTenant.
+func WithDeleted(db *gorm.DB) *gorm.DB {
+	return db.Unscoped().Session(&gorm.Session{})
+}
+
+// Restore restores the soft deleted records matching the given conditions.
+func (cdb *DB) Restore(db *gorm.DB, cond ...interface{}) error {
+	column, err := cdb.deletedAtColumn(db)
+	if err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{column: nil}
+	field, err := cdb.versionField(db)
+	if err != nil {
+		return err
+	}
+	if field != nil {
+		// restoring modifies the record, the versions read before must not be accepted anymore
+		updates[field.DBName] = gorm.Expr(field.DBName + " + 1")
+	}
+
+	db = db.Unscoped().Model(cdb.Model).Where(column + " IS NOT NULL")
+	if len(cond) > 0 {
+		where := parseCond(cond...)
+		db = db.Where(where[0], where[1:]...)
+	}
+	res := db.Updates(updates)
+	cdb.GDB = res
+	return res.Error
+}
+
+// PurgeDeleted permanently deletes the records soft deleted before the given time, returns the number of deleted records
+func (cdb *DB) PurgeDeleted(db *gorm.DB, before time.Time) (int64, error) {
+	column, err := cdb.deletedAtColumn(db)
+	if err != nil {
+		return 0, err
+	}
+
+	res := db.Unscoped().Where(column+" < ?", before).Delete(cdb.modelPtr())
+	cdb.GDB = res
+	return res.RowsAffected, res.Error
+}
+
+// deletedAtColumn returns the soft delete column of the model
+func (cdb *DB) deletedAtColumn(db *gorm.DB) (string, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(cdb.Model); err != nil {
+		return "", err
+	}
+	for _, f := range stmt.Schema.Fields {
+		if f.FieldType == deletedAtType {
+			return f.DBName, nil
+		}
+	}
+	return "", ErrSoftDeleteNotSupported
+}
+
+// modelPtr returns a pointer of the model, as required by the soft & permanent deletions
+func (cdb *DB) modelPtr() interface{} {
+	if reflect.TypeOf(cdb.Model).Kind() == reflect.Ptr {
+		return cdb.Model
+	}
+	return reflect.New(reflect.TypeOf(cdb.Model)).Interface()
+}
@@ -0,0 +1,84 @@
+package dbutil
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type softRecord struct {
+	ID        int
+	Name      string
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+type hardRecord struct {
+	ID   int
+	Name string
+}
+
+func TestSoftDelete(t *testing.T) {
+	db, err := New("sqlite3", filepath.Join(t.TempDir(), "soft.db"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Error establishing connection %v", err)
+	}
+	if err := db.AutoMigrate(&softRecord{}, &hardRecord{}); err != nil {
+		t.Fatalf("Error migrating %v", err)
+	}
+
+	cdb := NewDB(softRecord{})
+	assert.Nil(t, cdb.CreateInBatches(db, []*softRecord{{Name: "a"}, {Name: "b"}, {Name: "c"}}, 10))
+	rows, err := cdb.DeleteRows(db, map[string]interface{}{"name": "a"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), rows)
+
+	// the deleted records are excluded
+	rec := new(softRecord)
+	assert.ErrorIs(t, cdb.View(db, rec, map[string]interface{}{"name": "a"}), gorm.ErrRecordNotFound)
+	existed, err := cdb.Exist(db, map[string]interface{}{"name": "a"})
+	assert.Nil(t, err)
+	assert.False(t, existed)
+	assert.Nil(t, cdb.Update(db, map[string]interface{}{"name": "x"}, map[string]interface{}{"name": "a"}))
+	assert.Equal(t, int64(0), cdb.GDB.RowsAffected)
+
+	var data []*softRecord
+	var count int64
+	assert.Nil(t, cdb.List(db, &data, nil, &count))
+	assert.Equal(t, int64(2), count)
+
+	// unless included
+	assert.Nil(t, cdb.List(db, &data, &ListQueryCondition{IncludeDeleted: true}, &count))
+	assert.Equal(t, int64(3), count)
+	existed, err = cdb.Exist(WithDeleted(db), map[string]interface{}{"name": "a"})
+	assert.Nil(t, err)
+	assert.True(t, existed)
+
+	// restored
+	assert.Nil(t, cdb.Restore(db, map[string]interface{}{"name": "a"}))
+	assert.Equal(t, int64(1), cdb.GDB.RowsAffected)
+	assert.Nil(t, cdb.View(db, rec, map[string]interface{}{"name": "a"}))
+	assert.False(t, rec.DeletedAt.Valid)
+	// the records which are not deleted are not restored
+	assert.Nil(t, cdb.Restore(db, rec.ID))
+	assert.Equal(t, int64(0), cdb.GDB.RowsAffected)
+
+	// purged when deleted before the time only
+	assert.Nil(t, cdb.Delete(db, map[string]interface{}{"name": "b"}))
+	purged, err := cdb.PurgeDeleted(db, time.Now().Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), purged)
+	purged, err = cdb.PurgeDeleted(db, time.Now().Add(time.Second))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), purged)
+	assert.Nil(t, cdb.List(db, &data, &ListQueryCondition{IncludeDeleted: true}, &count))
+	assert.Equal(t, int64(2), count)
+
+	// the other models are not soft deleted
+	hdb := NewDB(hardRecord{})
+	assert.ErrorIs(t, hdb.Restore(db, 1), ErrSoftDeleteNotSupported)
+	_, err = hdb.PurgeDeleted(db, time.Now())
+	assert.ErrorIs(t, err, ErrSoftDeleteNotSupported)
+}
@@ -0,0 +1,90 @@
+package dbutil
+
+import (
+	"errors"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Tenanted is implemented by the models whose tenant column is not the default one of RegisterTenantScope.
+// The models having the default column are scoped without implementing it.
+type Tenanted interface {
+	// TenantColumn returns the column of the tenant ID, e.g: tenant_id.
+	// An empty column shares the model by all tenants, e.g: for the data copied to all of them
+	TenantColumn() string
+}
+
+// ErrTenantRequired is returned when querying a tenanted model without a tenant
+var ErrTenantRequired = errors.New("dbutil: tenant is required")
+
+const (
+	tenantSettingKey = "dbutil:tenant"
+	// allTenants disables the tenant scope
+	allTenants = -1
+)
+
+// WithTenant returns the DB scoping the queries of the tenanted models to the tenant.
+// It is a reusable session, the setting is kept by the queries & transactions chained from it.
+func WithTenant(db *gorm.DB, tenantID int) *gorm.DB {
+	return db.Set(tenantSettingKey, tenantID).Session(&gorm.Session{})
+}
+
+// WithoutTenant returns the DB querying the tenanted models of all tenants, e.g: for the platform admins
+func WithoutTenant(db *gorm.DB) *gorm.DB {
+	return db.Set(tenantSettingKey, allTenants).Session(&gorm.Session{})
+}
+
+// RegisterTenantScope registers the callbacks scoping every query of the tenanted models to the tenant of the DB:
+// the new records are assigned to the tenant, the others are filtered by it.
+// The models having the `column`, e.g: organization_id, are tenanted by default, see Tenanted for the others.
+// The queries fail with ErrTenantRequired if there is no tenant, so a tenant can never read the rows of the others,
+// the queries of all tenants must opt out explicitly with WithoutTenant.
+func RegisterTenantScope(db *gorm.DB, column string) error {
+	cb := db.Callback()
+	if err := cb.Create().Before("gorm:create").Register("dbutil:tenant", tenantScope(column, true)); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("gorm:query").Register("dbutil:tenant", tenantScope(column, false)); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("dbutil:tenant", tenantScope(column, false)); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("dbutil:tenant", tenantScope(column, false)); err != nil {
+		return err
+	}
+	return cb.Row().Before("gorm:row").Register("dbutil:tenant", tenantScope(column, false))
+}
+
+// tenantScope returns the callback scoping the statement to the tenant
+func tenantScope(column string, create bool) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Error != nil || db.Statement.Schema == nil {
+			return
+		}
+		col := column
+		if tm, ok := reflect.New(db.Statement.Schema.ModelType).Interface().(Tenanted); ok {
+			col = tm.TenantColumn()
+		}
+		if col == "" || db.Statement.Schema.LookUpField(col) == nil {
+			return
+		}
+
+		v, _ := db.Get(tenantSettingKey)
+		tenantID, _ := v.(int)
+		switch {
+		case tenantID == allTenants:
+			return
+		case tenantID <= 0:
+			db.AddError(ErrTenantRequired)
+		case create:
+			db.Statement.SetColumn(col, tenantID, true)
+		default:
+			db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+				clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: col}, Value: tenantID},
+			}})
+		}
+	}
+}
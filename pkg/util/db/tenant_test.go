@@ -0,0 +1,135 @@
+package dbutil
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type tenantRecord struct {
+	ID             int
+	OrganizationID int
+	Name           string
+}
+
+type tenantNote struct {
+	ID       int
+	TenantID int
+	Body     string
+}
+
+func (tenantNote) TenantColumn() string {
+	return "tenant_id"
+}
+
+type sharedRecord struct {
+	ID   int
+	Name string
+}
+
+type sharedTemplate struct {
+	ID             int
+	OrganizationID int
+	Name           string
+}
+
+func (sharedTemplate) TenantColumn() string {
+	return ""
+}
+
+func TestTenantScope(t *testing.T) {
+	db, err := New("sqlite3", filepath.Join(t.TempDir(), "tenant.db"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Error establishing connection %v", err)
+	}
+	if err := db.AutoMigrate(&tenantRecord{}); err != nil {
+		t.Fatalf("Error migrating %v", err)
+	}
+	assert.Nil(t, RegisterTenantScope(db, "organization_id"))
+
+	cdb := NewDB(tenantRecord{})
+	t1, t2 := WithTenant(db, 1), WithTenant(db, 2)
+
+	// the new records are assigned to the tenant, whatever they are given
+	assert.Nil(t, cdb.Create(t1, &tenantRecord{Name: "a"}))
+	assert.Nil(t, cdb.Create(t1, &tenantRecord{Name: "b", OrganizationID: 2}))
+	assert.Nil(t, cdb.CreateInBatches(t2, []*tenantRecord{{Name: "c"}, {Name: "d"}}, 10))
+
+	var data []*tenantRecord
+	var count int64
+	assert.Nil(t, cdb.List(t1, &data, nil, &count))
+	assert.Equal(t, int64(2), count)
+	for _, r := range data {
+		assert.Equal(t, 1, r.OrganizationID)
+	}
+
+	// kept by the transactions
+	assert.Nil(t, Transaction(t2, func(tx *gorm.DB) error {
+		return cdb.List(tx, &data, nil, &count)
+	}))
+	assert.Equal(t, int64(2), count)
+
+	rec := new(tenantRecord)
+	assert.ErrorIs(t, cdb.View(t2, rec, map[string]interface{}{"name": "a"}), gorm.ErrRecordNotFound)
+	existed, err := cdb.Exist(t2, map[string]interface{}{"name": "a"})
+	assert.Nil(t, err)
+	assert.False(t, existed)
+
+	assert.Nil(t, cdb.Update(t2, map[string]interface{}{"name": "x"}, map[string]interface{}{"name": "a"}))
+	assert.Equal(t, int64(0), cdb.GDB.RowsAffected)
+	assert.Nil(t, cdb.Delete(t2, map[string]interface{}{"name": "b"}))
+	assert.Equal(t, int64(0), cdb.GDB.RowsAffected)
+
+	// no tenant, no rows
+	assert.ErrorIs(t, cdb.List(db, &data, nil, nil), ErrTenantRequired)
+	assert.ErrorIs(t, cdb.Create(db, &tenantRecord{Name: "e"}), ErrTenantRequired)
+	assert.ErrorIs(t, db.Model(&tenantRecord{}).Where("id > 0").Update("name", "y").Error, ErrTenantRequired)
+
+	// all tenants on purpose
+	assert.Nil(t, cdb.List(WithoutTenant(db), &data, nil, &count))
+	assert.Equal(t, int64(4), count)
+}
+
+func TestTenantScopeModels(t *testing.T) {
+	db, err := New("sqlite3", filepath.Join(t.TempDir(), "tenant.db"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Error establishing connection %v", err)
+	}
+	if err := db.AutoMigrate(&tenantNote{}, &sharedRecord{}, &sharedTemplate{}); err != nil {
+		t.Fatalf("Error migrating %v", err)
+	}
+	assert.Nil(t, RegisterTenantScope(db, "organization_id"))
+
+	// every tenanted model is scoped by its own column
+	ndb := NewDB(tenantNote{})
+	assert.Nil(t, ndb.Create(WithTenant(db, 1), &tenantNote{Body: "a"}))
+	assert.Nil(t, ndb.Create(WithTenant(db, 2), &tenantNote{Body: "b"}))
+
+	var notes []*tenantNote
+	var count int64
+	assert.Nil(t, ndb.List(WithTenant(db, 2), &notes, nil, &count))
+	assert.Equal(t, int64(1), count)
+	assert.Equal(t, tenantNote{ID: 2, TenantID: 2, Body: "b"}, *notes[0])
+	assert.ErrorIs(t, ndb.List(db, &notes, nil, nil), ErrTenantRequired)
+
+	// the others are shared by all tenants
+	sdb := NewDB(sharedRecord{})
+	assert.Nil(t, sdb.Create(db, &sharedRecord{Name: "a"}))
+	assert.Nil(t, sdb.Create(WithTenant(db, 1), &sharedRecord{Name: "b"}))
+
+	var data []*sharedRecord
+	assert.Nil(t, sdb.List(WithTenant(db, 2), &data, nil, &count))
+	assert.Equal(t, int64(2), count)
+
+	// so are the models opting out explicitly, even having the tenant column
+	tdb := NewDB(sharedTemplate{})
+	assert.Nil(t, tdb.Create(db, &sharedTemplate{Name: "a"}))
+	assert.Nil(t, tdb.Create(WithTenant(db, 1), &sharedTemplate{Name: "b", OrganizationID: 2}))
+
+	var templates []*sharedTemplate
+	assert.Nil(t, tdb.List(WithTenant(db, 1), &templates, nil, &count))
+	assert.Equal(t, int64(2), count)
+	assert.Equal(t, 2, templates[1].OrganizationID)
+}
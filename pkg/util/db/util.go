@@ -1,6 +1,7 @@
 package dbutil
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/imdatngo/gowhere"
@@ -40,7 +41,7 @@ func Transaction(db *gorm.DB, fn InTransaction) (err error) {
 		if r := recover(); r != nil {
 			switch x := r.(type) {
 			case string:
-				err = fmt.Errorf(x)
+				err = errors.New(x)
 			case error:
 				err = x
 			default:
@@ -48,7 +49,8 @@ func Transaction(db *gorm.DB, fn InTransaction) (err error) {
 			}
 		}
 		if err != nil {
-			err = tx.Rollback().Error
+			// keep the original error, the rollback one is secondary
+			tx.Rollback()
 		} else {
 			err = tx.Commit().Error
 		}
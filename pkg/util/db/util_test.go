@@ -0,0 +1,69 @@
+package dbutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestTransaction(t *testing.T) {
+	type record struct {
+		ID   int
+		Name string
+	}
+	db, err := New("sqlite3", "file::memory:", &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Error establishing connection %v", err)
+	}
+	if err := db.AutoMigrate(&record{}); err != nil {
+		t.Fatalf("Error migrating %v", err)
+	}
+
+	errFailed := errors.New("failed")
+	cases := []struct {
+		name      string
+		fn        InTransaction
+		wantErr   error
+		wantCount int64
+	}{
+		{
+			name: "Committed",
+			fn: func(tx *gorm.DB) error {
+				return tx.Create(&record{Name: "committed"}).Error
+			},
+			wantCount: 1,
+		},
+		{
+			name: "Rolled back with the original error",
+			fn: func(tx *gorm.DB) error {
+				if err := tx.Create(&record{Name: "rolledback"}).Error; err != nil {
+					return err
+				}
+				return errFailed
+			},
+			wantErr:   errFailed,
+			wantCount: 1,
+		},
+		{
+			name: "Rolled back on panic",
+			fn: func(tx *gorm.DB) error {
+				tx.Create(&record{Name: "panic"})
+				panic("panic")
+			},
+			wantErr:   errors.New("panic"),
+			wantCount: 1,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Transaction(db, tt.fn)
+			assert.Equal(t, tt.wantErr, err)
+			var count int64
+			db.Model(&record{}).Count(&count)
+			assert.Equal(t, tt.wantCount, count)
+		})
+	}
+}
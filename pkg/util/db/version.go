@@ -0,0 +1,72 @@
+package dbutil
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ErrVersionConflict is returned by Update when the record exists but its version is not the expected one,
+// i.e: it was updated since the expected version was read
+var ErrVersionConflict = errors.New("dbutil: version conflict")
+
+// VersionColumn is the column of the row version.
+// DB.Update increments it on the models having it, and checks it when the updates contain it, for optimistic concurrency control.
+const VersionColumn = "version"
+
+// versionField returns the version field of the model, nil if the model is not versioned
+func (cdb *DB) versionField(db *gorm.DB) (*schema.Field, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(cdb.Model); err != nil {
+		return nil, err
+	}
+	return stmt.Schema.LookUpField(VersionColumn), nil
+}
+
+// versionedUpdates returns a copy of the updates incrementing the version, with the expected version if given.
+// The struct updates are converted to map, skipping the zero fields like gorm does.
+func versionedUpdates(db *gorm.DB, updates interface{}, field *schema.Field) (map[string]interface{}, interface{}, error) {
+	res := map[string]interface{}{}
+	switch u := updates.(type) {
+	case map[string]interface{}:
+		for k, v := range u {
+			res[k] = v
+		}
+	default:
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(updates); err != nil {
+			return nil, nil, err
+		}
+		rv := reflect.Indirect(reflect.ValueOf(updates))
+		for _, f := range stmt.Schema.Fields {
+			if f.DBName == "" || f.PrimaryKey || !f.Updatable {
+				continue
+			}
+			if v, zero := f.ValueOf(context.Background(), rv); !zero {
+				res[f.DBName] = v
+			}
+		}
+	}
+
+	var expected interface{}
+	for _, key := range []string{field.DBName, field.Name} {
+		v, ok := res[key]
+		if !ok {
+			continue
+		}
+		delete(res, key)
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				continue
+			}
+			v = rv.Elem().Interface()
+		}
+		expected = v
+	}
+	res[field.DBName] = gorm.Expr(field.DBName + " + 1")
+
+	return res, expected, nil
+}
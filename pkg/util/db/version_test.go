@@ -0,0 +1,66 @@
+package dbutil
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type versionedRecord struct {
+	ID      int
+	Name    string
+	Code    string
+	Version int `gorm:"not null;default:1"`
+}
+
+func TestUpdateVersion(t *testing.T) {
+	db, err := New("sqlite3", filepath.Join(t.TempDir(), "version.db"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Error establishing connection %v", err)
+	}
+	if err := db.AutoMigrate(&versionedRecord{}, &hardRecord{}); err != nil {
+		t.Fatalf("Error migrating %v", err)
+	}
+
+	cdb := NewDB(versionedRecord{})
+	rec := &versionedRecord{Name: "a"}
+	assert.Nil(t, cdb.Create(db, rec))
+	assert.Equal(t, 1, rec.Version)
+
+	// incremented on every update
+	updates := map[string]interface{}{"name": "b"}
+	assert.Nil(t, cdb.Update(db, updates, rec.ID))
+	assert.Equal(t, map[string]interface{}{"name": "b"}, updates, "not modified")
+	assert.Nil(t, cdb.Update(db, versionedRecord{Code: "x"}, rec.ID))
+	assert.Nil(t, cdb.View(db, rec, rec.ID))
+	assert.Equal(t, versionedRecord{ID: rec.ID, Name: "b", Code: "x", Version: 3}, *rec)
+
+	// checked when given
+	version := 3
+	assert.Nil(t, cdb.Update(db, map[string]interface{}{"name": "c", "version": &version}, rec.ID))
+	assert.ErrorIs(t, cdb.Update(db, map[string]interface{}{"name": "d", "version": &version}, rec.ID), ErrVersionConflict)
+	assert.ErrorIs(t, cdb.Update(db, versionedRecord{Name: "d", Version: 3}, rec.ID), ErrVersionConflict)
+	assert.Nil(t, cdb.Update(db, versionedRecord{Name: "d", Version: 4}, rec.ID))
+	assert.Nil(t, cdb.Update(db, map[string]interface{}{"name": "e", "version": nil}, rec.ID))
+	assert.Nil(t, cdb.View(db, rec, rec.ID))
+	assert.Equal(t, "e", rec.Name)
+	assert.Equal(t, 6, rec.Version)
+
+	// not found is not a conflict
+	rows, err := cdb.UpdateRows(db, map[string]interface{}{"name": "f", "version": 6}, rec.ID+1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), rows)
+	rows, err = cdb.UpdateRows(db, map[string]interface{}{"name": "f", "version": 6}, rec.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), rows)
+
+	// the models without version are unchanged
+	hdb := NewDB(hardRecord{})
+	hrec := &hardRecord{Name: "a"}
+	assert.Nil(t, hdb.Create(db, hrec))
+	assert.Nil(t, hdb.Update(db, map[string]interface{}{"name": "b"}, hrec.ID))
+	assert.Nil(t, hdb.View(db, hrec, hrec.ID))
+	assert.Equal(t, "b", hrec.Name)
+}
@@ -2,6 +2,7 @@ package httputil
 
 import (
 	"encoding/json"
+	"fmt"
 	"strconv"
 	"strings"
 
@@ -30,6 +31,37 @@ func ReqIDint64(c echo.Context) (int64, error) {
 	return id, nil
 }
 
+// ETag returns the strong entity tag of the record version, e.g: "3"
+func ETag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// SetETag sets the ETag header of the response to the record version
+func SetETag(c echo.Context, version int) {
+	c.Response().Header().Set("ETag", ETag(version))
+}
+
+// ReqIfMatch returns the version in the If-Match header, nil when the header is missing or "*"
+func ReqIfMatch(c echo.Context) (*int, error) {
+	tag := strings.TrimSpace(c.Request().Header.Get("If-Match"))
+	if tag == "" || tag == "*" {
+		return nil, nil
+	}
+	// the weak tags never match, see RFC 9110 section 13.1.1
+	if strings.HasPrefix(tag, "W/") {
+		return nil, server.NewHTTPConflictError("The record has been modified, please reload and try again")
+	}
+	unquoted, err := strconv.Unquote(tag)
+	if err != nil {
+		return nil, server.NewHTTPValidationError("Invalid If-Match header").SetInternal(err)
+	}
+	version, err := strconv.Atoi(unquoted)
+	if err != nil {
+		return nil, server.NewHTTPValidationError("Invalid If-Match header").SetInternal(err)
+	}
+	return &version, nil
+}
+
 // TrimSpacePointer trims leading and trailing spaces from a pointer string
 func TrimSpacePointer(s *string) *string {
 	if s == nil {
@@ -58,28 +90,40 @@ type ListRequest struct {
 	// Current page number
 	// default: 1
 	Page int `json:"p,omitempty" query:"p"`
-	// Field name for sorting
+	// Comma separated field names for sorting, prefixed by - for descending order. E.g: name,-created_at
 	// default:
 	Sort string `json:"s,omitempty" query:"s"`
-	// Sort direction, must be one of ASC, DESC
+	// Sort direction of the fields without prefix, must be one of ASC, DESC
 	// default:
 	Order string `json:"o,omitempty" query:"o"`
 	// JSON string of filter. E.g: {"field_name":"value"}
 	// default:
 	Filter string `json:"f,omitempty" query:"f"`
+	// Includes the deleted records, requires the permission to restore them
+	// default: false
+	IncludeDeleted bool `json:"include_deleted,omitempty" query:"include_deleted"`
+	// Cursor of the keyset pagination, returned as next_cursor/prev_cursor. Pass it empty to get the first page.
+	// The page number is ignored and the total count is not returned when it is given.
+	// default:
+	Cursor string `json:"c,omitempty" query:"c"`
 }
 
-// ReqListQuery parses url query string for listing request
-func ReqListQuery(c echo.Context) (*dbutil.ListQueryCondition, error) {
+// ReqListQuery parses url query string for listing request.
+// The sort & filter fields are validated against the allowed `fields` of the resource, see dbutil.NewListFields
+func ReqListQuery(c echo.Context, fields *dbutil.ListFields) (*dbutil.ListQueryCondition, error) {
 	lr := &ListRequest{}
 	if err := c.Bind(lr); err != nil {
 		return nil, err
 	}
+	if fields == nil {
+		fields = &dbutil.ListFields{}
+	}
 
 	lq := &dbutil.ListQueryCondition{
-		Page:    lr.Page,
-		PerPage: lr.Limit,
-		Filter:  gowhere.WithConfig(gowhere.Config{Strict: true}),
+		Page:           lr.Page,
+		PerPage:        lr.Limit,
+		Filter:         gowhere.WithConfig(gowhere.Config{Strict: true, ColumnAliases: fields.Filter}),
+		IncludeDeleted: lr.IncludeDeleted,
 	}
 
 	if lr.Filter != "" {
@@ -89,19 +133,69 @@ func ReqListQuery(c echo.Context) (*dbutil.ListQueryCondition, error) {
 			return nil, server.NewHTTPValidationError("Invalid filter, expecting JSON string").SetInternal(err)
 		}
 
+		if err := checkFilter(filter, fields.Filter); err != nil {
+			return nil, err
+		}
 		if err := lq.Filter.Where(filter).Build().Error; err != nil {
 			return nil, server.NewHTTPValidationError("Cannot parse filter").SetInternal(err)
 		}
 	}
 
 	if lr.Sort != "" {
-		sortField := lr.Sort
-		sortOrder := "ASC" // default
-		if lr.Order != "" && strings.ToLower(lr.Order) == "desc" {
-			sortOrder = "DESC"
+		defaultOrder := "ASC"
+		if strings.ToLower(lr.Order) == "desc" {
+			defaultOrder = "DESC"
+		}
+		for _, sortField := range strings.Split(lr.Sort, ",") {
+			sortField = strings.TrimSpace(sortField)
+			sortOrder := defaultOrder
+			switch {
+			case strings.HasPrefix(sortField, "-"):
+				sortField, sortOrder = sortField[1:], "DESC"
+			case strings.HasPrefix(sortField, "+"):
+				sortField, sortOrder = sortField[1:], "ASC"
+			}
+			column, ok := fields.Sort[sortField]
+			if !ok {
+				return nil, server.NewHTTPValidationError(fmt.Sprintf("Invalid sort field: %s", sortField))
+			}
+			lq.Sort = append(lq.Sort, column+" "+sortOrder)
+		}
+	}
+
+	if c.QueryParams().Has("c") {
+		lq.Cursor = &dbutil.Cursor{}
+		if lr.Cursor != "" {
+			cur, err := dbutil.DecodeCursor(lr.Cursor)
+			if err != nil {
+				return nil, server.NewHTTPValidationError("Invalid cursor").SetInternal(err)
+			}
+			lq.Cursor = cur
 		}
-		lq.Sort = []string{sortField + " " + sortOrder}
 	}
 
 	return lq, nil
 }
+
+// checkFilter returns validation error unless all the fields of the filter are allowed.
+// Only the map conditions and the lists of them are accepted, the raw conditions are not.
+func checkFilter(filter interface{}, allowed map[string]string) error {
+	switch f := filter.(type) {
+	case map[string]interface{}:
+		for key := range f {
+			field, _, _ := strings.Cut(key, "__")
+			if _, ok := allowed[field]; !ok {
+				return server.NewHTTPValidationError(fmt.Sprintf("Invalid filter field: %s", field))
+			}
+		}
+	case []interface{}:
+		for _, cond := range f {
+			if err := checkFilter(cond, allowed); err != nil {
+				return err
+			}
+		}
+	default:
+		return server.NewHTTPValidationError("Invalid filter, expecting JSON object or array of objects")
+	}
+	return nil
+}
@@ -0,0 +1,356 @@
+// Package oidc implements the relying party side of the OpenID Connect authorization code flow with PKCE (RFC 7636).
+// The provider metadata is discovered from the issuer, the ID tokens are verified against the published JWKS.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Custom errors
+var (
+	ErrInvalidConfig  = errors.New("oidc: issuer, client ID and redirect URL are required")
+	ErrIssuerMismatch = errors.New("oidc: discovered issuer does not match the configured one")
+	ErrNoIDToken      = errors.New("oidc: token response has no id_token")
+	ErrInvalidNonce   = errors.New("oidc: invalid nonce")
+	ErrInvalidAZP     = errors.New("oidc: invalid authorized party")
+	ErrKeyNotFound    = errors.New("oidc: signing key not found")
+)
+
+// DefaultScopes are requested if none is configured
+var DefaultScopes = []string{"openid", "email", "profile"}
+
+// jwksRefreshInterval limits the JWKS refetching on unknown key IDs
+const jwksRefreshInterval = time.Minute
+
+// supportedAlgs are the accepted ID token signing algorithms, symmetric ones are never accepted
+var supportedAlgs = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// Config represents the configuration of an OpenID provider
+type Config struct {
+	// Name identifies the provider, e.g: google
+	Name string `json:"name"`
+	// Issuer is the issuer URL, the metadata is discovered at `{Issuer}/.well-known/openid-configuration`
+	Issuer       string `json:"issuer"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	// RedirectURL is where the provider sends the authorization code back
+	RedirectURL string `json:"redirect_url"`
+	// Scopes defaults to DefaultScopes
+	Scopes []string `json:"scopes"`
+	// Leeway is the allowed clock skew when validating the ID token time claims
+	Leeway time.Duration `json:"-"`
+	// HTTPClient defaults to a client with 10 seconds timeout
+	HTTPClient *http.Client `json:"-"`
+}
+
+// Metadata represents the provider metadata (OpenID Connect Discovery 1.0)
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Token represents the token endpoint response
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	IDToken      string `json:"id_token"`
+}
+
+// IDToken represents the claims of a verified ID token
+type IDToken struct {
+	jwt.RegisteredClaims
+	Nonce         string `json:"nonce"`
+	AZP           string `json:"azp"`
+	Email         string `json:"email"`
+	EmailVerified Bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+	Picture       string `json:"picture"`
+}
+
+// Bool is a boolean claim which some providers encode as string
+type Bool bool
+
+// UnmarshalJSON accepts both true and "true"
+func (b *Bool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*b = true
+	case "false", "", "null":
+		*b = false
+	default:
+		return fmt.Errorf("oidc: invalid boolean %s", data)
+	}
+	return nil
+}
+
+// Error represents an OAuth2 error response
+type Error struct {
+	StatusCode  int
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *Error) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("oidc: %s: %s", e.Code, e.Description)
+	}
+	return fmt.Sprintf("oidc: %s (status %d)", e.Code, e.StatusCode)
+}
+
+// NewProvider creates a new provider client. The metadata is discovered lazily on the first use
+func NewProvider(cfg Config) (*Provider, error) {
+	if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, ErrInvalidConfig
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = DefaultScopes
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Provider{cfg: cfg}, nil
+}
+
+// Provider represents an OpenID provider client
+type Provider struct {
+	cfg Config
+
+	mu            sync.Mutex
+	meta          *Metadata
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+}
+
+// Name returns the provider name
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+// Discover fetches the provider metadata once, then returns the cached one
+func (p *Provider) Discover(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.discover(ctx)
+}
+
+func (p *Provider) discover(ctx context.Context) (*Metadata, error) {
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	meta := new(Metadata)
+	if err := p.getJSON(ctx, strings.TrimRight(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", meta); err != nil {
+		return nil, err
+	}
+	if strings.TrimRight(meta.Issuer, "/") != strings.TrimRight(p.cfg.Issuer, "/") {
+		return nil, ErrIssuerMismatch
+	}
+	p.meta = meta
+
+	return meta, nil
+}
+
+// AuthCodeURL returns the URL of the provider consent page.
+// `state` & `nonce` must be random values bound to the login attempt, `verifier` is the PKCE code verifier.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	meta, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	return meta.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange exchanges the authorization code for the tokens
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (*Token, error) {
+	meta, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+	if p.cfg.ClientSecret != "" {
+		form.Set("client_secret", p.cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	tok := new(Token)
+	if err := p.do(req, tok); err != nil {
+		return nil, err
+	}
+	if tok.IDToken == "" {
+		return nil, ErrNoIDToken
+	}
+
+	return tok, nil
+}
+
+// VerifyIDToken verifies the signature & claims of the raw ID token, which must carry the given nonce
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, nonce string) (*IDToken, error) {
+	meta, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(supportedAlgs),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(p.cfg.Leeway),
+	)
+	claims := new(IDToken)
+	if _, err := parser.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, kid)
+	}); err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, ErrInvalidNonce
+	}
+	if len(claims.Audience) > 1 && claims.AZP != p.cfg.ClientID {
+		return nil, ErrInvalidAZP
+	}
+
+	return claims, nil
+}
+
+// key returns the public key of the given ID, refetching the JWKS if the key is unknown (e.g: rotated by the provider)
+func (p *Provider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if k := p.lookupKey(kid); k != nil {
+		return k, nil
+	}
+	if !p.keysFetchedAt.IsZero() && time.Since(p.keysFetchedAt) < jwksRefreshInterval {
+		return nil, ErrKeyNotFound
+	}
+
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	set := new(JWKS)
+	if err := p.getJSON(ctx, meta.JWKSURI, set); err != nil {
+		return nil, err
+	}
+	p.keys = set.PublicKeys()
+	p.keysFetchedAt = time.Now()
+
+	if k := p.lookupKey(kid); k != nil {
+		return k, nil
+	}
+	return nil, ErrKeyNotFound
+}
+
+// lookupKey finds the cached key by ID. The only key is used if the token has no key ID
+func (p *Provider) lookupKey(kid string) crypto.PublicKey {
+	if kid == "" && len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k
+		}
+	}
+	return p.keys[kid]
+}
+
+func (p *Provider) getJSON(ctx context.Context, u string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	return p.do(req, out)
+}
+
+func (p *Provider) do(req *http.Request, out interface{}) error {
+	resp, err := p.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		e := &Error{StatusCode: resp.StatusCode}
+		if json.Unmarshal(body, e) != nil || e.Code == "" {
+			e.Code = http.StatusText(resp.StatusCode)
+		}
+		return e
+	}
+
+	return json.Unmarshal(body, out)
+}
+
+///// PKCE & random values /////
+
+// RandomString returns a random URL-safe string of 256 bits entropy, usable as state, nonce or PKCE code verifier
+func RandomString() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Challenge returns the S256 PKCE code challenge of the verifier
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
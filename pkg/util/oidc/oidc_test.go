@@ -0,0 +1,288 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/M15t/ghoul/pkg/util/oidc"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	clientID     = "ghoul"
+	clientSecret = "s3cr3t"
+	redirectURL  = "https://app.ghoul.test/oauth/stub/callback"
+)
+
+// stubIdP is a minimal OpenID provider issuing the codes right away on /authorize
+type stubIdP struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+	claims jwt.MapClaims
+
+	mu    sync.Mutex
+	codes map[string]url.Values
+}
+
+func newStubIdP(t *testing.T) *stubIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &stubIdP{key: key, kid: "k1", codes: map[string]url.Values{}}
+	idp.claims = jwt.MapClaims{
+		"sub":            "1234567890",
+		"email":          "jane@ghoul.test",
+		"email_verified": true,
+		"name":           "Jane Doe",
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		enc := base64.RawURLEncoding.EncodeToString
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": idp.kid, "use": "sig", "alg": "RS256",
+			"n": enc(key.N.Bytes()), "e": enc(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		code := oidc.RandomString()
+		idp.mu.Lock()
+		idp.codes[code] = q
+		idp.mu.Unlock()
+		http.Redirect(w, r, q.Get("redirect_uri")+"?code="+code+"&state="+q.Get("state"), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		idp.mu.Lock()
+		auth, ok := idp.codes[r.PostForm.Get("code")]
+		delete(idp.codes, r.PostForm.Get("code"))
+		idp.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if !ok || r.PostForm.Get("client_id") != clientID || r.PostForm.Get("client_secret") != clientSecret ||
+			r.PostForm.Get("redirect_uri") != auth.Get("redirect_uri") ||
+			oidc.Challenge(r.PostForm.Get("code_verifier")) != auth.Get("code_challenge") {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "bad code"})
+			return
+		}
+
+		claims := jwt.MapClaims{
+			"iss":   idp.URL,
+			"aud":   clientID,
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": auth.Get("nonce"),
+		}
+		for k, v := range idp.claims {
+			claims[k] = v
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "at",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idp.sign(t, claims),
+		})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+
+	return idp
+}
+
+func (idp *stubIdP) sign(t *testing.T, claims jwt.MapClaims) string {
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tok.Header["kid"] = idp.kid
+	raw, err := tok.SignedString(idp.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// authorize follows the consent page URL, returns the code given back to the redirect URL
+func (idp *stubIdP) authorize(t *testing.T, authURL string) string {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc.Query().Get("code")
+}
+
+func newProvider(t *testing.T, idp *stubIdP) *oidc.Provider {
+	p, err := oidc.NewProvider(oidc.Config{
+		Name:         "stub",
+		Issuer:       idp.URL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestNewProvider(t *testing.T) {
+	_, err := oidc.NewProvider(oidc.Config{Name: "stub", ClientID: clientID})
+	assert.Equal(t, oidc.ErrInvalidConfig, err)
+
+	p, err := oidc.NewProvider(oidc.Config{Name: "stub", Issuer: "https://idp.test", ClientID: clientID, RedirectURL: redirectURL})
+	assert.Nil(t, err)
+	assert.Equal(t, "stub", p.Name())
+}
+
+func TestDiscover(t *testing.T) {
+	idp := newStubIdP(t)
+	meta, err := newProvider(t, idp).Discover(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, idp.URL+"/token", meta.TokenEndpoint)
+
+	// the issuer must match the discovered one
+	p, _ := oidc.NewProvider(oidc.Config{Issuer: idp.URL + "/other", ClientID: clientID, RedirectURL: redirectURL})
+	_, err = p.Discover(context.Background())
+	assert.NotNil(t, err)
+}
+
+func TestAuthCodeFlow(t *testing.T) {
+	ctx := context.Background()
+	idp := newStubIdP(t)
+	p := newProvider(t, idp)
+
+	state, nonce, verifier := oidc.RandomString(), oidc.RandomString(), oidc.RandomString()
+	authURL, err := p.AuthCodeURL(ctx, state, nonce, verifier)
+	assert.Nil(t, err)
+
+	u, _ := url.Parse(authURL)
+	q := u.Query()
+	assert.Equal(t, idp.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+	assert.Equal(t, "code", q.Get("response_type"))
+	assert.Equal(t, clientID, q.Get("client_id"))
+	assert.Equal(t, redirectURL, q.Get("redirect_uri"))
+	assert.Equal(t, "openid email profile", q.Get("scope"))
+	assert.Equal(t, state, q.Get("state"))
+	assert.Equal(t, nonce, q.Get("nonce"))
+	assert.Equal(t, oidc.Challenge(verifier), q.Get("code_challenge"))
+	assert.Equal(t, "S256", q.Get("code_challenge_method"))
+
+	t.Run("wrong verifier", func(t *testing.T) {
+		code := idp.authorize(t, authURL)
+		_, err := p.Exchange(ctx, code, oidc.RandomString())
+		if assert.IsType(t, &oidc.Error{}, err) {
+			assert.Equal(t, "invalid_grant", err.(*oidc.Error).Code)
+		}
+	})
+
+	t.Run("success", func(t *testing.T) {
+		code := idp.authorize(t, authURL)
+		tok, err := p.Exchange(ctx, code, verifier)
+		assert.Nil(t, err)
+
+		idt, err := p.VerifyIDToken(ctx, tok.IDToken, nonce)
+		assert.Nil(t, err)
+		assert.Equal(t, "1234567890", idt.Subject)
+		assert.Equal(t, "jane@ghoul.test", idt.Email)
+		assert.True(t, bool(idt.EmailVerified))
+		assert.Equal(t, "Jane Doe", idt.Name)
+
+		_, err = p.VerifyIDToken(ctx, tok.IDToken, oidc.RandomString())
+		assert.Equal(t, oidc.ErrInvalidNonce, err)
+	})
+
+	t.Run("code reused", func(t *testing.T) {
+		code := idp.authorize(t, authURL)
+		_, err := p.Exchange(ctx, code, verifier)
+		assert.Nil(t, err)
+		_, err = p.Exchange(ctx, code, verifier)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	ctx := context.Background()
+	idp := newStubIdP(t)
+	p := newProvider(t, idp)
+	now := time.Now()
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":            idp.URL,
+			"aud":            clientID,
+			"sub":            "42",
+			"iat":            now.Unix(),
+			"exp":            now.Add(time.Hour).Unix(),
+			"nonce":          "n",
+			"email_verified": "true",
+		}
+	}
+
+	idt, err := p.VerifyIDToken(ctx, idp.sign(t, valid()), "n")
+	assert.Nil(t, err)
+	assert.True(t, bool(idt.EmailVerified))
+
+	cases := map[string]func(jwt.MapClaims){
+		"wrong issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.test" },
+		"wrong audience": func(c jwt.MapClaims) { c["aud"] = "other" },
+		"expired":        func(c jwt.MapClaims) { c["exp"] = now.Add(-time.Minute).Unix() },
+		"no expiration":  func(c jwt.MapClaims) { delete(c, "exp") },
+		"wrong azp":      func(c jwt.MapClaims) { c["aud"] = []string{clientID, "other"}; c["azp"] = "other" },
+	}
+	for name, mutate := range cases {
+		t.Run(name, func(t *testing.T) {
+			claims := valid()
+			mutate(claims)
+			_, err := p.VerifyIDToken(ctx, idp.sign(t, claims), "n")
+			assert.NotNil(t, err)
+		})
+	}
+
+	t.Run("unknown key", func(t *testing.T) {
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, valid())
+		tok.Header["kid"] = "unknown"
+		raw, _ := tok.SignedString(idp.key)
+		_, err := p.VerifyIDToken(ctx, raw, "n")
+		assert.ErrorIs(t, err, oidc.ErrKeyNotFound)
+	})
+
+	t.Run("symmetric algorithm", func(t *testing.T) {
+		tok := jwt.NewWithClaims(jwt.SigningMethodHS256, valid())
+		tok.Header["kid"] = idp.kid
+		raw, _ := tok.SignedString([]byte(clientSecret))
+		_, err := p.VerifyIDToken(ctx, raw, "n")
+		assert.NotNil(t, err)
+	})
+}
+
+func TestChallenge(t *testing.T) {
+	// RFC 7636 Appendix B
+	assert.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", oidc.Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"))
+}
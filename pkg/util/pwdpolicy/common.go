@@ -0,0 +1,26 @@
+package pwdpolicy
+
+// commonPasswords are the most common passwords found in breaches, always denied
+var commonPasswords = map[string]struct{}{
+	"000000": {}, "1111": {}, "111111": {}, "11111111": {}, "112233": {}, "121212": {}, "123123": {},
+	"123321": {}, "1234": {}, "12345": {}, "123456": {}, "1234567": {}, "12345678": {}, "123456789": {},
+	"1234567890": {}, "123abc": {}, "123qwe": {}, "131313": {}, "159753": {}, "1q2w3e4r": {}, "1q2w3e4r5t": {},
+	"1qaz2wsx": {}, "1qazxsw2": {}, "2000": {}, "555555": {}, "654321": {}, "666666": {}, "696969": {},
+	"777777": {}, "7777777": {}, "987654321": {}, "aaaaaa": {}, "abc123": {}, "abc12345": {}, "abcd1234": {},
+	"access": {}, "admin": {}, "admin123": {}, "administrator": {}, "amanda": {}, "andrew": {}, "asdf1234": {},
+	"asdfgh": {}, "ashley": {}, "austin": {}, "baseball": {}, "baseball1": {}, "batman": {}, "biteme": {},
+	"buster": {}, "changeme": {}, "changeme123": {}, "charlie": {}, "cheese": {}, "chelsea": {}, "computer": {},
+	"dallas": {}, "daniel": {}, "demo": {}, "dragon": {}, "dragon1": {}, "football": {}, "football1": {},
+	"football123": {}, "freedom": {}, "george": {}, "ginger": {}, "guest": {}, "harley": {}, "hockey": {},
+	"hunter": {}, "iloveyou": {}, "iloveyou1": {}, "jennifer": {}, "jessica": {}, "jordan": {}, "joshua": {},
+	"killer": {}, "klaster": {}, "letmein": {}, "letmein1": {}, "login": {}, "love": {}, "maggie": {},
+	"master": {}, "master1": {}, "matrix": {}, "matthew": {}, "michael": {}, "michelle": {}, "monkey": {},
+	"monkey1": {}, "mustang": {}, "nicole": {}, "p@ssw0rd": {}, "p@ssword": {}, "pa$$word": {}, "pass": {},
+	"passw0rd": {}, "password": {}, "password1": {}, "password12": {}, "password123": {}, "password1234": {},
+	"pepper": {}, "princess": {}, "princess1": {}, "q1w2e3r4": {}, "qazwsx": {}, "qwe123": {}, "qwerty": {},
+	"qwerty1": {}, "qwerty123": {}, "qwertyuiop": {}, "ranger": {}, "robert": {}, "root": {}, "secret": {},
+	"shadow": {}, "soccer": {}, "starwars": {}, "summer": {}, "sunshine": {}, "sunshine1": {}, "superman": {},
+	"superman1": {}, "taylor": {}, "test": {}, "test123": {}, "thomas": {}, "thunder": {}, "tigger": {},
+	"toor": {}, "trustno1": {}, "trustno11": {}, "user": {}, "user123": {}, "welcome": {}, "welcome1": {},
+	"welcome123": {}, "yankees": {}, "zaq12wsx": {}, "zxcvbn": {}, "zxcvbnm": {},
+}
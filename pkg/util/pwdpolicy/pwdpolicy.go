@@ -0,0 +1,128 @@
+// Package pwdpolicy validates passwords against a configurable policy
+package pwdpolicy
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Policy represents the password policy
+type Policy struct {
+	// MinLength & MaxLength in characters, zero means no limit
+	MinLength int
+	MaxLength int
+	// Required character classes
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// Denylist holds extra forbidden passwords, in addition to the common ones. Case insensitive
+	Denylist []string
+	// HistorySize is the number of last passwords which may not be reused, zero disables the check
+	HistorySize int
+}
+
+// DefaultPolicy requires at least 8 characters of mixed classes, and no reuse of the last 5 passwords
+var DefaultPolicy = Policy{
+	MinLength:    8,
+	MaxLength:    72,
+	RequireUpper: true,
+	RequireLower: true,
+	RequireDigit: true,
+	HistorySize:  5,
+}
+
+// Error lists the violated rules of the policy
+type Error struct {
+	Violations []string
+}
+
+// Error makes it compatible with `error` interface
+func (e *Error) Error() string {
+	return "Password " + strings.Join(e.Violations, ", ")
+}
+
+// New creates new policy, denylist entries are normalized
+func New(p Policy) *Policy {
+	deny := make([]string, 0, len(p.Denylist))
+	for _, v := range p.Denylist {
+		if v = strings.ToLower(strings.TrimSpace(v)); v != "" {
+			deny = append(deny, v)
+		}
+	}
+	p.Denylist = deny
+	return &p
+}
+
+// Validate checks the password against the policy.
+// `personal` are the user's data (e.g: username, email) which the password may not contain.
+// Returns *Error listing the violations, or nil if the password is valid.
+func (p *Policy) Validate(password string, personal ...string) error {
+	var violations []string
+
+	length := utf8.RuneCountInString(password)
+	if p.MinLength > 0 && length < p.MinLength {
+		violations = append(violations, "must be at least "+strconv.Itoa(p.MinLength)+" characters")
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, "must be at most "+strconv.Itoa(p.MaxLength)+" characters")
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		violations = append(violations, "must contain an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		violations = append(violations, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		violations = append(violations, "must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		violations = append(violations, "must contain a symbol")
+	}
+
+	lowered := strings.ToLower(password)
+	if p.denied(lowered) {
+		violations = append(violations, "is too common")
+	}
+	for _, v := range personal {
+		// only the local part of an email address
+		v, _, _ = strings.Cut(strings.ToLower(strings.TrimSpace(v)), "@")
+		if len(v) >= 3 && strings.Contains(lowered, v) {
+			violations = append(violations, "must not contain your personal information")
+			break
+		}
+	}
+
+	if len(violations) > 0 {
+		return &Error{Violations: violations}
+	}
+	return nil
+}
+
+func (p *Policy) denied(lowered string) bool {
+	if _, ok := commonPasswords[lowered]; ok {
+		return true
+	}
+	for _, v := range p.Denylist {
+		if v == lowered {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package pwdpolicy_test
+
+import (
+	"testing"
+
+	"github.com/M15t/ghoul/pkg/util/pwdpolicy"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	p := pwdpolicy.New(pwdpolicy.Policy{
+		MinLength:     8,
+		MaxLength:     20,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+		Denylist:      []string{" Ghoul@2026 "},
+	})
+
+	cases := []struct {
+		name           string
+		password       string
+		personal       []string
+		wantViolations []string
+	}{
+		{
+			name:     "Valid",
+			password: "Tr0ub4dor&3",
+			personal: []string{"superadmin", "superadmin@ghoul.com"},
+		},
+		{
+			name:           "Too short & missing classes",
+			password:       "abc",
+			wantViolations: []string{"must be at least 8 characters", "must contain an uppercase letter", "must contain a digit", "must contain a symbol"},
+		},
+		{
+			name:           "Too long",
+			password:       "Tr0ub4dor&3Tr0ub4dor&3",
+			wantViolations: []string{"must be at most 20 characters"},
+		},
+		{
+			name:           "Common password",
+			password:       "P@ssw0rd",
+			wantViolations: []string{"is too common"},
+		},
+		{
+			name:           "Denylist",
+			password:       "GHOUL@2026",
+			wantViolations: []string{"must contain a lowercase letter", "is too common"},
+		},
+		{
+			name:           "Personal information",
+			password:       "Superadmin#1",
+			personal:       []string{"superadmin", "superadmin@ghoul.com"},
+			wantViolations: []string{"must not contain your personal information"},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.Validate(tt.password, tt.personal...)
+			if tt.wantViolations == nil {
+				assert.Nil(t, err)
+				return
+			}
+			perr, ok := err.(*pwdpolicy.Error)
+			assert.True(t, ok)
+			assert.Equal(t, tt.wantViolations, perr.Violations)
+		})
+	}
+}
@@ -165,3 +165,15 @@ func (s *Service) SendToTopic(topic string, msg Message) (string, error) {
 	}
 	return *output.MessageId, nil
 }
+
+// Publish publishes a raw message to a topic, e.g. for the subscribed SQS queues
+func (s *Service) Publish(topic string, message string) (string, error) {
+	output, err := s.sns.Publish(&sns.PublishInput{
+		Message:  aws.String(message),
+		TopicArn: aws.String(topic),
+	})
+	if err != nil {
+		return "", err
+	}
+	return *output.MessageId, nil
+}
@@ -92,3 +92,19 @@ func (s *Service) SendMessageBatch(input *sqs.SendMessageBatchInput) (*sqs.SendM
 
 	return msgResult, nil
 }
+
+// PeekMessages gets SQS messages without hiding them from the other receivers, so every receiver sees every message
+// until it expires by the queue retention period.
+// Note: it is a short poll, which may miss some messages, and it increases the receive count of the messages
+func (s *Service) PeekMessages(queueURL string) (*sqs.ReceiveMessageOutput, error) {
+	msgResult, err := s.sqs.ReceiveMessage(&sqs.ReceiveMessageInput{
+		QueueUrl:            &queueURL,
+		MaxNumberOfMessages: aws.Int64(10),
+		VisibilityTimeout:   aws.Int64(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return msgResult, nil
+}
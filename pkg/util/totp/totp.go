@@ -0,0 +1,183 @@
+// Package totp implements the Time-based One-Time Password algorithm (RFC 6238),
+// compatible with the common authenticator apps.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Algorithm is the HMAC hash function
+type Algorithm string
+
+// Supported algorithms
+const (
+	AlgorithmSHA1   Algorithm = "SHA1"
+	AlgorithmSHA256 Algorithm = "SHA256"
+	AlgorithmSHA512 Algorithm = "SHA512"
+)
+
+// Custom errors
+var (
+	ErrInvalidSecret    = errors.New("totp: invalid base32 secret")
+	ErrInvalidAlgorithm = errors.New("totp: invalid algorithm")
+)
+
+// Opts represents the TOTP parameters
+type Opts struct {
+	// Period is the time step in seconds
+	Period uint
+	// Digits is the length of the code
+	Digits int
+	// Algorithm is the HMAC hash function
+	Algorithm Algorithm
+	// Skew is the number of periods before and after the current one that are also accepted
+	Skew uint
+}
+
+// DefaultOpts are the parameters supported by most authenticator apps, with 1 period of skew
+var DefaultOpts = Opts{Period: 30, Digits: 6, Algorithm: AlgorithmSHA1, Skew: 1}
+
+// secretSize is the length in bytes of the generated secrets, as recommended by RFC 4226
+const secretSize = 20
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random secret, base32 encoded without padding
+func GenerateSecret() (string, error) {
+	b := make([]byte, secretSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return b32.EncodeToString(b), nil
+}
+
+// GenerateCode returns the code of the given time using the default options
+func GenerateCode(secret string, t time.Time) (string, error) {
+	return GenerateCodeWithOpts(secret, t, DefaultOpts)
+}
+
+// GenerateCodeWithOpts returns the code of the given time
+func GenerateCodeWithOpts(secret string, t time.Time, opts Opts) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, counter(t, opts.Period), opts)
+}
+
+// Validate checks the code at the given time using the default options.
+// Returns the matched counter (time step), the caller should reject counters which are not greater than
+// the last accepted one to prevent replay.
+func Validate(code, secret string, t time.Time) (int64, bool) {
+	return ValidateWithOpts(code, secret, t, DefaultOpts)
+}
+
+// ValidateWithOpts checks the code at the given time, accepting `opts.Skew` periods before and after.
+// Returns the matched counter (time step).
+func ValidateWithOpts(code, secret string, t time.Time, opts Opts) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != opts.Digits {
+		return 0, false
+	}
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return 0, false
+	}
+
+	current := counter(t, opts.Period)
+	for i := -int64(opts.Skew); i <= int64(opts.Skew); i++ {
+		expected, err := hotp(key, current+i, opts)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return current + i, true
+		}
+	}
+	return 0, false
+}
+
+// URI returns the otpauth:// URI of the secret using the default options, to be rendered as QR code
+func URI(issuer, account, secret string) string {
+	return URIWithOpts(issuer, account, secret, DefaultOpts)
+}
+
+// URIWithOpts returns the otpauth:// URI of the secret, to be rendered as QR code.
+// See https://github.com/google/google-authenticator/wiki/Key-Uri-Format
+func URIWithOpts(issuer, account, secret string, opts Opts) string {
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", string(opts.Algorithm))
+	q.Set("digits", strconv.Itoa(opts.Digits))
+	q.Set("period", strconv.FormatUint(uint64(opts.Period), 10))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: q.Encode(),
+	}
+	return u.String()
+}
+
+// hotp computes the HMAC-based one-time password of the counter (RFC 4226)
+func hotp(key []byte, c int64, opts Opts) (string, error) {
+	var h func() hash.Hash
+	switch opts.Algorithm {
+	case AlgorithmSHA1, "":
+		h = sha1.New
+	case AlgorithmSHA256:
+		h = sha256.New
+	case AlgorithmSHA512:
+		h = sha512.New
+	default:
+		return "", ErrInvalidAlgorithm
+	}
+
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(c))
+	mac := hmac.New(h, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	// dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < opts.Digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", opts.Digits, bin%mod), nil
+}
+
+func counter(t time.Time, period uint) int64 {
+	if period == 0 {
+		period = DefaultOpts.Period
+	}
+	return t.Unix() / int64(period)
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(secret), " ", ""))
+	key, err := b32.DecodeString(strings.TrimRight(secret, "="))
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidSecret
+	}
+	return key, nil
+}
@@ -0,0 +1,105 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/M15t/ghoul/pkg/util/totp"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test vectors of RFC 6238 Appendix B
+func TestGenerateCodeWithOpts(t *testing.T) {
+	secrets := map[totp.Algorithm]string{
+		totp.AlgorithmSHA1:   base32.StdEncoding.EncodeToString([]byte("12345678901234567890")),
+		totp.AlgorithmSHA256: base32.StdEncoding.EncodeToString([]byte("12345678901234567890123456789012")),
+		totp.AlgorithmSHA512: base32.StdEncoding.EncodeToString([]byte("1234567890123456789012345678901234567890123456789012345678901234")),
+	}
+	cases := []struct {
+		unix int64
+		algo totp.Algorithm
+		want string
+	}{
+		{59, totp.AlgorithmSHA1, "94287082"},
+		{59, totp.AlgorithmSHA256, "46119246"},
+		{59, totp.AlgorithmSHA512, "90693936"},
+		{1111111109, totp.AlgorithmSHA1, "07081804"},
+		{1111111109, totp.AlgorithmSHA256, "68084774"},
+		{1111111109, totp.AlgorithmSHA512, "25091201"},
+		{1111111111, totp.AlgorithmSHA1, "14050471"},
+		{1111111111, totp.AlgorithmSHA256, "67062674"},
+		{1111111111, totp.AlgorithmSHA512, "99943326"},
+		{1234567890, totp.AlgorithmSHA1, "89005924"},
+		{1234567890, totp.AlgorithmSHA256, "91819424"},
+		{1234567890, totp.AlgorithmSHA512, "93441116"},
+		{2000000000, totp.AlgorithmSHA1, "69279037"},
+		{2000000000, totp.AlgorithmSHA256, "90698825"},
+		{2000000000, totp.AlgorithmSHA512, "38618901"},
+		{20000000000, totp.AlgorithmSHA1, "65353130"},
+		{20000000000, totp.AlgorithmSHA256, "77737706"},
+		{20000000000, totp.AlgorithmSHA512, "47863826"},
+	}
+
+	for _, tt := range cases {
+		t.Run(string(tt.algo)+"@"+time.Unix(tt.unix, 0).UTC().Format(time.RFC3339), func(t *testing.T) {
+			opts := totp.Opts{Period: 30, Digits: 8, Algorithm: tt.algo}
+			got, err := totp.GenerateCodeWithOpts(secrets[tt.algo], time.Unix(tt.unix, 0), opts)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+
+			_, ok := totp.ValidateWithOpts(tt.want, secrets[tt.algo], time.Unix(tt.unix, 0), opts)
+			assert.True(t, ok)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	assert.Nil(t, err)
+	assert.Len(t, secret, 32)
+
+	now := time.Unix(1700000000, 0)
+	code, err := totp.GenerateCode(secret, now)
+	assert.Nil(t, err)
+	assert.Len(t, code, 6)
+
+	cases := []struct {
+		name   string
+		code   string
+		at     time.Time
+		wantOk bool
+	}{
+		{name: "Current period", code: code, at: now, wantOk: true},
+		{name: "Previous period within skew", code: code, at: now.Add(30 * time.Second), wantOk: true},
+		{name: "Next period within skew", code: code, at: now.Add(-30 * time.Second), wantOk: true},
+		{name: "Beyond skew", code: code, at: now.Add(90 * time.Second)},
+		{name: "Wrong length", code: code[:5], at: now},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			counter, ok := totp.Validate(tt.code, secret, tt.at)
+			assert.Equal(t, tt.wantOk, ok)
+			if ok {
+				assert.Equal(t, now.Unix()/30, counter)
+			}
+		})
+	}
+
+	_, ok := totp.Validate(code, "not base32!", now)
+	assert.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	uri := totp.URI("ghoul", "superadmin@ghoul.com", "JBSWY3DPEHPK3PXP")
+	u, err := url.Parse(uri)
+	assert.Nil(t, err)
+	assert.Equal(t, "otpauth", u.Scheme)
+	assert.Equal(t, "totp", u.Host)
+	assert.Equal(t, "/ghoul:superadmin@ghoul.com", u.Path)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", u.Query().Get("secret"))
+	assert.Equal(t, "ghoul", u.Query().Get("issuer"))
+	assert.Equal(t, "6", u.Query().Get("digits"))
+}